@@ -36,6 +36,8 @@
 package addpay
 
 import (
+	"log/slog"
+
 	"github.com/mdwt/addpay-go/client"
 	"github.com/mdwt/addpay-go/logger"
 	"github.com/mdwt/addpay-go/types"
@@ -51,6 +53,11 @@ func NewDefaultLogger() types.Logger {
 	return logger.NewDefaultLogger()
 }
 
+// LoggerFromSlog creates a logger that writes through an application's slog.Logger
+func LoggerFromSlog(l *slog.Logger) types.Logger {
+	return logger.FromSlog(l)
+}
+
 // NewNoOpLogger creates a new no-op logger that discards all log messages
 func NewNoOpLogger() types.Logger {
 	return logger.NewNoOpLogger()
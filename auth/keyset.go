@@ -0,0 +1,152 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// GatewayKey is a trusted gateway public key with an optional validity window
+type GatewayKey struct {
+	ID        string
+	PublicKey *rsa.PublicKey
+	NotBefore time.Time // Optional: zero means valid from the start
+	NotAfter  time.Time // Optional: zero means valid indefinitely
+}
+
+// ParseGatewayKey parses a PEM or base64 X.509 gateway public key
+func ParseGatewayKey(id string, publicKeyData []byte, notBefore, notAfter time.Time) (GatewayKey, error) {
+	publicKey, err := parsePublicKey(publicKeyData)
+	if err != nil {
+		return GatewayKey{}, fmt.Errorf("failed to parse gateway key %s: %w", id, err)
+	}
+	return GatewayKey{
+		ID:        id,
+		PublicKey: publicKey,
+		NotBefore: notBefore,
+		NotAfter:  notAfter,
+	}, nil
+}
+
+// ValidAt reports whether the key is inside its validity window at t
+func (k GatewayKey) ValidAt(t time.Time) bool {
+	if !k.NotBefore.IsZero() && t.Before(k.NotBefore) {
+		return false
+	}
+	if !k.NotAfter.IsZero() && t.After(k.NotAfter) {
+		return false
+	}
+	return true
+}
+
+// KeySet holds the trusted gateway public keys in preference order.
+// It is safe for concurrent use and can be replaced at runtime, so a gateway
+// key rotation only needs a reload rather than a redeploy.
+type KeySet struct {
+	mu   sync.RWMutex
+	keys []GatewayKey
+}
+
+// NewKeySet creates a key set trusting the given keys in order
+func NewKeySet(keys ...GatewayKey) *KeySet {
+	s := &KeySet{}
+	s.Replace(keys...)
+	return s
+}
+
+// Replace swaps the trusted keys for a new set
+func (s *KeySet) Replace(keys ...GatewayKey) {
+	copied := append([]GatewayKey(nil), keys...)
+
+	s.mu.Lock()
+	s.keys = copied
+	s.mu.Unlock()
+}
+
+// Add appends a trusted key to the end of the set
+func (s *KeySet) Add(key GatewayKey) {
+	s.mu.Lock()
+	s.keys = append(s.keys, key)
+	s.mu.Unlock()
+}
+
+// Remove drops every key with the given ID
+func (s *KeySet) Remove(id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	kept := s.keys[:0:0]
+	for _, key := range s.keys {
+		if key.ID != id {
+			kept = append(kept, key)
+		}
+	}
+	s.keys = kept
+}
+
+// Keys returns a copy of the trusted keys in order
+func (s *KeySet) Keys() []GatewayKey {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return append([]GatewayKey(nil), s.keys...)
+}
+
+// Active returns the first key valid at t, skipping keys without a public key
+func (s *KeySet) Active(t time.Time) (GatewayKey, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, key := range s.keys {
+		if key.PublicKey != nil && key.ValidAt(t) {
+			return key, true
+		}
+	}
+	return GatewayKey{}, false
+}
+
+// PublicKey returns the public key of the first key valid at t
+func (s *KeySet) PublicKey(t time.Time) (*rsa.PublicKey, bool) {
+	key, ok := s.Active(t)
+	return key.PublicKey, ok
+}
+
+// Verify checks a base64 SHA256WithRSA signature against each key valid now,
+// in order, and returns the ID of the key that matched
+func (s *KeySet) Verify(data []byte, signature string) (string, error) {
+	sig, err := base64.StdEncoding.DecodeString(signature)
+	if err != nil {
+		return "", fmt.Errorf("failed to decode signature: %w", err)
+	}
+
+	hash := sha256.Sum256(data)
+	now := time.Now()
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var errs []error
+	for _, key := range s.keys {
+		if !key.ValidAt(now) {
+			continue
+		}
+		if key.PublicKey == nil {
+			errs = append(errs, fmt.Errorf("key %q has no public key", key.ID))
+			continue
+		}
+		if err := rsa.VerifyPKCS1v15(key.PublicKey, crypto.SHA256, hash[:], sig); err != nil {
+			errs = append(errs, fmt.Errorf("key %q: %w", key.ID, err))
+			continue
+		}
+		return key.ID, nil
+	}
+
+	if len(errs) == 0 {
+		return "", fmt.Errorf("signature verification failed: no valid gateway keys")
+	}
+	return "", fmt.Errorf("signature verification failed: %w", errors.Join(errs...))
+}
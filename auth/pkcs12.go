@@ -0,0 +1,181 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"fmt"
+	"hash"
+)
+
+// Object identifiers for PKCS#7 content and PKCS#12 bags
+var (
+	oidDataContentType          = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 1}
+	oidEncryptedDataContentType = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 6}
+	oidKeyBag                   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 12, 10, 1, 1}
+	oidPKCS8ShroudedKeyBag      = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 12, 10, 1, 2}
+	oidSHA1                     = asn1.ObjectIdentifier{1, 3, 14, 3, 2, 26}
+	oidSHA256                   = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 1}
+)
+
+// pfxPdu is the outer PKCS#12 structure
+type pfxPdu struct {
+	Version  int
+	AuthSafe contentInfo
+	MacData  macData `asn1:"optional"`
+}
+
+// contentInfo is a PKCS#7 ContentInfo
+type contentInfo struct {
+	ContentType asn1.ObjectIdentifier
+	Content     asn1.RawValue `asn1:"tag:0,explicit,optional"`
+}
+
+// encryptedData is a PKCS#7 EncryptedData
+type encryptedData struct {
+	Version              int
+	EncryptedContentInfo encryptedContentInfo
+}
+
+// encryptedContentInfo is a PKCS#7 EncryptedContentInfo
+type encryptedContentInfo struct {
+	ContentType                asn1.ObjectIdentifier
+	ContentEncryptionAlgorithm pkix.AlgorithmIdentifier
+	EncryptedContent           []byte `asn1:"tag:0,optional"`
+}
+
+// macData is the PKCS#12 integrity MAC
+type macData struct {
+	Mac        digestInfo
+	MacSalt    []byte
+	Iterations int `asn1:"optional,default:1"`
+}
+
+// digestInfo is a digest with its algorithm
+type digestInfo struct {
+	Algorithm pkix.AlgorithmIdentifier
+	Digest    []byte
+}
+
+// safeBag is a single PKCS#12 bag
+type safeBag struct {
+	ID         asn1.ObjectIdentifier
+	Value      asn1.RawValue   `asn1:"tag:0,explicit"`
+	Attributes []asn1.RawValue `asn1:"set,optional"`
+}
+
+// ParsePKCS12PrivateKey extracts the RSA private key from a DER encoded
+// PKCS#12 bundle, verifying its integrity MAC with the passphrase
+func ParsePKCS12PrivateKey(data, passphrase []byte) (*rsa.PrivateKey, error) {
+	return parsePKCS12PrivateKey(data, passphrase)
+}
+
+// isPKCS12 reports whether data looks like a DER PKCS#12 bundle
+func isPKCS12(data []byte) bool {
+	var pfx pfxPdu
+	rest, err := asn1.Unmarshal(data, &pfx)
+	return err == nil && len(rest) == 0 && pfx.Version == 3
+}
+
+// parsePKCS12PrivateKey walks the authenticated safe for a key bag
+func parsePKCS12PrivateKey(data, password []byte) (*rsa.PrivateKey, error) {
+	var pfx pfxPdu
+	if _, err := asn1.Unmarshal(data, &pfx); err != nil {
+		return nil, fmt.Errorf("failed to parse PKCS#12 bundle: %w", err)
+	}
+	if pfx.Version != 3 {
+		return nil, fmt.Errorf("unsupported PKCS#12 version %d", pfx.Version)
+	}
+	if !pfx.AuthSafe.ContentType.Equal(oidDataContentType) {
+		return nil, fmt.Errorf("unsupported PKCS#12 content type %s", pfx.AuthSafe.ContentType)
+	}
+
+	var authSafeData []byte
+	if _, err := asn1.Unmarshal(pfx.AuthSafe.Content.Bytes, &authSafeData); err != nil {
+		return nil, fmt.Errorf("failed to parse PKCS#12 content: %w", err)
+	}
+
+	if len(pfx.MacData.Mac.Algorithm.Algorithm) > 0 {
+		if err := verifyPKCS12MAC(pfx.MacData, authSafeData, password); err != nil {
+			return nil, err
+		}
+	}
+
+	var authSafe []contentInfo
+	if _, err := asn1.Unmarshal(authSafeData, &authSafe); err != nil {
+		return nil, fmt.Errorf("failed to parse PKCS#12 authenticated safe: %w", err)
+	}
+
+	for _, ci := range authSafe {
+		var contents []byte
+		switch {
+		case ci.ContentType.Equal(oidDataContentType):
+			if _, err := asn1.Unmarshal(ci.Content.Bytes, &contents); err != nil {
+				return nil, fmt.Errorf("failed to parse PKCS#12 safe contents: %w", err)
+			}
+		case ci.ContentType.Equal(oidEncryptedDataContentType):
+			var encrypted encryptedData
+			if _, err := asn1.Unmarshal(ci.Content.Bytes, &encrypted); err != nil {
+				return nil, fmt.Errorf("failed to parse PKCS#12 encrypted data: %w", err)
+			}
+			decrypted, err := decryptPBE(encrypted.EncryptedContentInfo.ContentEncryptionAlgorithm,
+				encrypted.EncryptedContentInfo.EncryptedContent, password)
+			if err != nil {
+				// Certificate bags often use legacy ciphers; skip what we cannot read
+				continue
+			}
+			contents = decrypted
+		default:
+			continue
+		}
+
+		var bags []safeBag
+		if _, err := asn1.Unmarshal(contents, &bags); err != nil {
+			return nil, fmt.Errorf("failed to parse PKCS#12 bags: %w", err)
+		}
+
+		for _, bag := range bags {
+			switch {
+			case bag.ID.Equal(oidPKCS8ShroudedKeyBag):
+				return decryptPKCS8PrivateKey(bag.Value.Bytes, password)
+			case bag.ID.Equal(oidKeyBag):
+				key, err := x509.ParsePKCS8PrivateKey(bag.Value.Bytes)
+				if err != nil {
+					return nil, fmt.Errorf("failed to parse PKCS#12 key bag: %w", err)
+				}
+				rsaKey, ok := key.(*rsa.PrivateKey)
+				if !ok {
+					return nil, fmt.Errorf("key is not an RSA private key")
+				}
+				return rsaKey, nil
+			}
+		}
+	}
+
+	return nil, fmt.Errorf("no private key found in PKCS#12 bundle")
+}
+
+// verifyPKCS12MAC checks the bundle integrity MAC (RFC 7292 appendix B)
+func verifyPKCS12MAC(mac macData, content, password []byte) error {
+	var newHash func() hash.Hash
+	switch alg := mac.Mac.Algorithm.Algorithm; {
+	case alg.Equal(oidSHA1):
+		newHash = sha1.New
+	case alg.Equal(oidSHA256):
+		newHash = sha256.New
+	default:
+		return fmt.Errorf("unsupported PKCS#12 MAC algorithm %s", alg)
+	}
+
+	key := pkcs12KDF(newHash, newHash().Size(), mac.MacSalt, bmpString(password), mac.Iterations, 3)
+	h := hmac.New(newHash, key)
+	h.Write(content)
+	if !hmac.Equal(h.Sum(nil), mac.Mac.Digest) {
+		return fmt.Errorf("PKCS#12 MAC verification failed (wrong passphrase?)")
+	}
+	return nil
+}
@@ -0,0 +1,117 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"time"
+)
+
+// RotatingSigner is a crypto.Signer that signs with the current merchant key
+// until SwitchAt and with the next key from then on. Register the next public
+// key in the merchant portal before SwitchAt so both keys overlap.
+type RotatingSigner struct {
+	current  crypto.Signer
+	next     crypto.Signer
+	switchAt time.Time
+}
+
+// NewRotatingSigner creates a signer that changes from current to next at switchAt
+func NewRotatingSigner(current, next crypto.Signer, switchAt time.Time) (RotatingSigner, error) {
+	if current == nil || next == nil {
+		return RotatingSigner{}, fmt.Errorf("current and next signers are required")
+	}
+	for _, signer := range []crypto.Signer{current, next} {
+		if _, ok := signer.Public().(*rsa.PublicKey); !ok {
+			return RotatingSigner{}, fmt.Errorf("signer does not hold an RSA key")
+		}
+	}
+	if switchAt.IsZero() {
+		return RotatingSigner{}, fmt.Errorf("switch-over time is required")
+	}
+
+	return RotatingSigner{current: current, next: next, switchAt: switchAt}, nil
+}
+
+// NewRotatingSignerFromKeys parses the current and next private keys
+// (PEM, or base64 PKCS1/PKCS8) and creates a rotating signer
+func NewRotatingSignerFromKeys(currentKey, nextKey []byte, switchAt time.Time) (RotatingSigner, error) {
+	current, err := parsePrivateKey(currentKey)
+	if err != nil {
+		return RotatingSigner{}, fmt.Errorf("failed to parse current private key: %w", err)
+	}
+	next, err := parsePrivateKey(nextKey)
+	if err != nil {
+		return RotatingSigner{}, fmt.Errorf("failed to parse next private key: %w", err)
+	}
+	return NewRotatingSigner(current, next, switchAt)
+}
+
+// SwitchAt returns the time signing changes over to the next key
+func (r RotatingSigner) SwitchAt() time.Time {
+	return r.switchAt
+}
+
+// Active returns the signer in use at t
+func (r RotatingSigner) Active(t time.Time) crypto.Signer {
+	if t.Before(r.switchAt) {
+		return r.current
+	}
+	return r.next
+}
+
+// Public returns the public key of the signer active now
+func (r RotatingSigner) Public() crypto.PublicKey {
+	return r.Active(time.Now()).Public()
+}
+
+// Sign signs digest with the signer active now
+func (r RotatingSigner) Sign(rand io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	return r.Active(time.Now()).Sign(rand, digest, opts)
+}
+
+// Decrypt decrypts with the active key, falling back to the other key so
+// data encrypted around the switch-over can still be read
+func (r RotatingSigner) Decrypt(rand io.Reader, ciphertext []byte, opts crypto.DecrypterOpts) ([]byte, error) {
+	active, other := r.current, r.next
+	if !time.Now().Before(r.switchAt) {
+		active, other = r.next, r.current
+	}
+
+	var lastErr error = fmt.Errorf("signer does not support decryption")
+	for _, signer := range []crypto.Signer{active, other} {
+		decrypter, ok := signer.(crypto.Decrypter)
+		if !ok {
+			continue
+		}
+		plaintext, err := decrypter.Decrypt(rand, ciphertext, opts)
+		if err == nil {
+			return plaintext, nil
+		}
+		lastErr = err
+	}
+	return nil, lastErr
+}
+
+// PublicKeyBase64 encodes a public key as base64 X.509 (SubjectPublicKeyInfo),
+// the form the merchant portal expects when registering a key
+func PublicKeyBase64(publicKey crypto.PublicKey) (string, error) {
+	der, err := x509.MarshalPKIXPublicKey(publicKey)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal public key: %w", err)
+	}
+	return base64.StdEncoding.EncodeToString(der), nil
+}
+
+// PublicKeyPEM encodes a public key as a PEM "PUBLIC KEY" block
+func PublicKeyPEM(publicKey crypto.PublicKey) ([]byte, error) {
+	der, err := x509.MarshalPKIXPublicKey(publicKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal public key: %w", err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}), nil
+}
@@ -12,12 +12,15 @@ import (
 	"net/url"
 	"sort"
 	"strings"
+	"time"
+
+	"github.com/mdwt/addpay-go/types"
 )
 
 // RSAAuth handles RSA key operations for AddPay authentication
 type RSAAuth struct {
-	privateKey *rsa.PrivateKey
-	publicKey  *rsa.PublicKey
+	signer      crypto.Signer
+	gatewayKeys types.GatewayKeys
 }
 
 // NewRSAAuth creates a new RSA authentication handler
@@ -33,15 +36,56 @@ func NewRSAAuth(privateKeyPEM, publicKeyPEM []byte) (RSAAuth, error) {
 	}
 
 	return RSAAuth{
-		privateKey: privateKey,
-		publicKey:  publicKey,
+		signer:      privateKey,
+		gatewayKeys: NewKeySet(GatewayKey{PublicKey: publicKey}),
 	}, nil
 }
 
+// NewRSAAuthWithSigner creates an RSA authentication handler that signs with
+// an external crypto.Signer, such as a KMS or PKCS#11 adapter. The signer
+// must hold an RSA key.
+func NewRSAAuthWithSigner(signer crypto.Signer, publicKeyPEM []byte) (RSAAuth, error) {
+	publicKey, err := parsePublicKey(publicKeyPEM)
+	if err != nil {
+		return RSAAuth{}, fmt.Errorf("failed to parse public key: %w", err)
+	}
+
+	return NewRSAAuthWithKeySet(signer, NewKeySet(GatewayKey{PublicKey: publicKey}))
+}
+
+// NewRSAAuthWithKeySet creates an RSA authentication handler that signs with
+// signer and verifies against a set of trusted gateway keys, such as a *KeySet
+func NewRSAAuthWithKeySet(signer crypto.Signer, keys types.GatewayKeys) (RSAAuth, error) {
+	if signer == nil {
+		return RSAAuth{}, fmt.Errorf("signer is nil")
+	}
+	if _, ok := signer.Public().(*rsa.PublicKey); !ok {
+		return RSAAuth{}, fmt.Errorf("signer does not hold an RSA key")
+	}
+	if set, ok := keys.(*KeySet); keys == nil || (ok && set == nil) {
+		return RSAAuth{}, fmt.Errorf("gateway key set is nil")
+	}
+
+	return RSAAuth{
+		signer:      signer,
+		gatewayKeys: keys,
+	}, nil
+}
+
+// ParsePrivateKey parses an RSA private key (PEM, or base64 PKCS1/PKCS8)
+func ParsePrivateKey(privateKeyData []byte) (*rsa.PrivateKey, error) {
+	return parsePrivateKey(privateKeyData)
+}
+
+// GatewayKeys returns the trusted gateway key set
+func (r RSAAuth) GatewayKeys() types.GatewayKeys {
+	return r.gatewayKeys
+}
+
 // Sign signs data using the private key with SHA256WithRSA (matches Java SDK)
 func (r RSAAuth) Sign(data []byte) (string, error) {
 	hash := sha256.Sum256(data)
-	signature, err := rsa.SignPKCS1v15(rand.Reader, r.privateKey, crypto.SHA256, hash[:])
+	signature, err := r.signer.Sign(rand.Reader, hash[:], crypto.SHA256)
 	if err != nil {
 		return "", fmt.Errorf("failed to sign data: %w", err)
 	}
@@ -60,26 +104,67 @@ func (r RSAAuth) SignParameters(params map[string]interface{}) (string, error) {
 	return r.Sign([]byte(signString))
 }
 
+// SignString returns the canonical string that SignParameters signs:
+// non-empty parameters other than "sign", sorted and URL-encoded
+func SignString(params map[string]interface{}) string {
+	return createSignString(filterParameters(params))
+}
+
+// FilteredParameter is a parameter left out of the sign string
+type FilteredParameter struct {
+	Key    string      `json:"key"`
+	Value  interface{} `json:"value"`
+	Reason string      `json:"reason"`
+}
+
+// ExplainParameters returns the sign string for params together with every
+// parameter that was filtered out and why
+func ExplainParameters(params map[string]interface{}) (string, []FilteredParameter) {
+	var filtered []FilteredParameter
+	for key, value := range params {
+		if reason := filterReason(key, value); reason != "" {
+			filtered = append(filtered, FilteredParameter{Key: key, Value: value, Reason: reason})
+		}
+	}
+	sort.Slice(filtered, func(i, j int) bool { return filtered[i].Key < filtered[j].Key })
+
+	return SignString(params), filtered
+}
+
 // filterParameters removes empty values and 'sign' parameter (matches Java SDK paraFilter)
 func filterParameters(params map[string]interface{}) map[string]string {
 	filtered := make(map[string]string)
 
 	for key, value := range params {
-		// Skip sign parameter and empty values
-		if key == "sign" || value == nil {
-			continue
-		}
-
-		// Convert to string and check if not empty
-		strValue := fmt.Sprintf("%v", value)
-		if strValue != "" && strValue != "0" {
-			filtered[key] = strValue
+		if filterReason(key, value) == "" {
+			filtered[key] = fmt.Sprintf("%v", value)
 		}
 	}
 
 	return filtered
 }
 
+// filterReason explains why a parameter is excluded from signing, or returns
+// an empty string if it is included
+func filterReason(key string, value interface{}) string {
+	// Skip sign parameter and empty values
+	if key == "sign" {
+		return "the sign parameter is never signed"
+	}
+	if value == nil {
+		return "value is nil"
+	}
+
+	// Convert to string and check if not empty
+	switch fmt.Sprintf("%v", value) {
+	case "":
+		return "value is empty"
+	case "0":
+		return `value formats as "0" and is treated as empty`
+	}
+	return ""
+}
+
 // createSignString creates a sorted parameter string for signing (matches Java SDK createLinkString)
 func createSignString(params map[string]string) string {
 	if len(params) == 0 {
@@ -102,24 +187,27 @@ func createSignString(params map[string]string) string {
 	return values.Encode()
 }
 
-// Verify verifies a signature using the public key
+// Verify verifies a signature against the trusted gateway keys, trying each in order
 func (r RSAAuth) Verify(data []byte, signature string) error {
-	sig, err := base64.StdEncoding.DecodeString(signature)
-	if err != nil {
-		return fmt.Errorf("failed to decode signature: %w", err)
-	}
+	_, err := r.gatewayKeys.Verify(data, signature)
+	return err
+}
 
-	hash := sha256.Sum256(data)
-	err = rsa.VerifyPKCS1v15(r.publicKey, crypto.SHA256, hash[:], sig)
-	if err != nil {
-		return fmt.Errorf("signature verification failed: %w", err)
-	}
-	return nil
+// VerifyParameters verifies a signature over parameters using the same
+// filtering and ordering as SignParameters
+func (r RSAAuth) VerifyParameters(params map[string]interface{}, signature string) error {
+	signString := createSignString(filterParameters(params))
+	return r.Verify([]byte(signString), signature)
 }
 
-// Encrypt encrypts data using the public key
+// Encrypt encrypts data using the first currently valid gateway key
 func (r RSAAuth) Encrypt(data []byte) (string, error) {
-	encrypted, err := rsa.EncryptPKCS1v15(rand.Reader, r.publicKey, data)
+	key, ok := r.gatewayKeys.PublicKey(time.Now())
+	if !ok || key == nil {
+		return "", fmt.Errorf("failed to encrypt data: no valid gateway keys")
+	}
+
+	encrypted, err := rsa.EncryptPKCS1v15(rand.Reader, key, data)
 	if err != nil {
 		return "", fmt.Errorf("failed to encrypt data: %w", err)
 	}
@@ -133,7 +221,12 @@ func (r RSAAuth) Decrypt(encryptedData string) ([]byte, error) {
 		return nil, fmt.Errorf("failed to decode encrypted data: %w", err)
 	}
 
-	decrypted, err := rsa.DecryptPKCS1v15(rand.Reader, r.privateKey, data)
+	decrypter, ok := r.signer.(crypto.Decrypter)
+	if !ok {
+		return nil, fmt.Errorf("signer does not support decryption")
+	}
+
+	decrypted, err := decrypter.Decrypt(rand.Reader, data, &rsa.PKCS1v15DecryptOptions{})
 	if err != nil {
 		return nil, fmt.Errorf("failed to decrypt data: %w", err)
 	}
@@ -0,0 +1,52 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/rsa"
+	"fmt"
+	"io"
+	"os"
+)
+
+// FileSigner is a reference crypto.Signer backed by a private key file.
+// It is intended for tests and local development; production deployments
+// should use a KMS or HSM backed signer.
+type FileSigner struct {
+	path string
+	key  *rsa.PrivateKey
+}
+
+// NewFileSigner loads a PEM or base64 encoded RSA private key from path
+func NewFileSigner(path string) (FileSigner, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return FileSigner{}, fmt.Errorf("failed to read private key file: %w", err)
+	}
+
+	key, err := parsePrivateKey(data)
+	if err != nil {
+		return FileSigner{}, fmt.Errorf("failed to parse private key file %s: %w", path, err)
+	}
+
+	return FileSigner{path: path, key: key}, nil
+}
+
+// Path returns the file the key was loaded from
+func (f FileSigner) Path() string {
+	return f.path
+}
+
+// Public returns the RSA public key
+func (f FileSigner) Public() crypto.PublicKey {
+	return &f.key.PublicKey
+}
+
+// Sign signs digest with the file-backed private key
+func (f FileSigner) Sign(rand io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	return f.key.Sign(rand, digest, opts)
+}
+
+// Decrypt decrypts ciphertext with the file-backed private key
+func (f FileSigner) Decrypt(rand io.Reader, ciphertext []byte, opts crypto.DecrypterOpts) ([]byte, error) {
+	return f.key.Decrypt(rand, ciphertext, opts)
+}
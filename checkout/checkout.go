@@ -0,0 +1,128 @@
+// Package checkout verifies customers returning from the hosted checkout page
+// so a thank-you page never trusts an unverified query string.
+package checkout
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/mdwt/addpay-go/client"
+	"github.com/mdwt/addpay-go/types"
+	"github.com/mdwt/addpay-go/webhook"
+)
+
+// Status is the normalised outcome of a checkout
+type Status = types.PaymentStatus
+
+const (
+	StatusPaid      = types.PaymentPaid
+	StatusPending   = types.PaymentPending
+	StatusFailed    = types.PaymentFailed
+	StatusCancelled = types.PaymentCancelled
+	StatusExpired   = types.PaymentExpired
+	StatusRefunded  = types.PaymentRefunded
+	StatusUnknown   = types.PaymentUnknown
+)
+
+// ParseStatus maps a gateway order status to a Status
+func ParseStatus(orderStatus string) Status {
+	return types.ParsePaymentStatus(orderStatus)
+}
+
+// Source says how a return result was established
+type Source string
+
+const (
+	SourceSignature  Source = "signature"   // the return parameters carried a valid gateway signature
+	SourceOrderQuery Source = "order_query" // the parameters were unsigned and the order was queried
+)
+
+// Return is the verified outcome of a hosted checkout redirect
+type Return struct {
+	MerchantOrderNo string  `json:"merchant_order_no"`
+	TransactionID   string  `json:"transaction_id,omitempty"`
+	Status          Status  `json:"status"`
+	OrderStatus     string  `json:"order_status"` // status as reported by the gateway
+	PriceCurrency   string  `json:"price_currency,omitempty"`
+	OrderAmount     float64 `json:"order_amount,omitempty"`
+	PaidAmount      float64 `json:"paid_amount,omitempty"`
+	Source          Source  `json:"source"`
+}
+
+// Paid reports whether the customer completed payment
+func (r Return) Paid() bool {
+	return r.Status == StatusPaid
+}
+
+// ErrMissingOrderNo is returned when an unsigned return has no order number to query
+var ErrMissingOrderNo = errors.New("return parameters have no merchant_order_no")
+
+// Verifier checks return parameters with the gateway keys of a client and
+// queries the order through it when they are unsigned
+type Verifier struct {
+	client   client.Client
+	verifier webhook.Verifier
+}
+
+// NewVerifier creates a return verifier for c
+func NewVerifier(c client.Client) Verifier {
+	return Verifier{
+		client:   c,
+		verifier: webhook.NewVerifier(c.GatewayKeys()),
+	}
+}
+
+// VerifyReturn establishes the outcome of the checkout the customer returned
+// from. Signed parameters are verified with the gateway key and a bad
+// signature is an error. Without a signature only the order number is taken
+// from the request and the status comes from an order query.
+func (v Verifier) VerifyReturn(r *http.Request) (Return, error) {
+	if err := r.ParseForm(); err != nil {
+		return Return{}, fmt.Errorf("failed to parse return parameters: %w", err)
+	}
+
+	params := make(map[string]interface{}, len(r.Form))
+	for key := range r.Form {
+		params[key] = r.Form.Get(key)
+	}
+
+	if _, signed := params["sign"]; signed {
+		n, err := v.verifier.Verify(params)
+		if err != nil {
+			return Return{}, fmt.Errorf("failed to verify return parameters: %w", err)
+		}
+		return Return{
+			MerchantOrderNo: n.MerchantOrderNo,
+			TransactionID:   n.TransactionID,
+			Status:          ParseStatus(n.OrderStatus),
+			OrderStatus:     n.OrderStatus,
+			PriceCurrency:   n.PriceCurrency,
+			OrderAmount:     n.OrderAmount,
+			PaidAmount:      n.PaidAmount,
+			Source:          SourceSignature,
+		}, nil
+	}
+
+	orderNo := r.Form.Get("merchant_order_no")
+	if orderNo == "" {
+		return Return{}, ErrMissingOrderNo
+	}
+	order, err := v.client.QueryOrder(r.Context(), types.QueryOrderRequest{MerchantOrderNo: orderNo})
+	if err != nil {
+		return Return{}, fmt.Errorf("failed to query order: %w", err)
+	}
+	if order.MerchantOrderNo == "" {
+		order.MerchantOrderNo = orderNo
+	}
+	return Return{
+		MerchantOrderNo: order.MerchantOrderNo,
+		TransactionID:   order.TransactionID,
+		Status:          ParseStatus(order.OrderStatus),
+		OrderStatus:     order.OrderStatus,
+		PriceCurrency:   order.PriceCurrency,
+		OrderAmount:     order.OrderAmount,
+		PaidAmount:      order.PaidAmount,
+		Source:          SourceOrderQuery,
+	}, nil
+}
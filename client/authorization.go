@@ -0,0 +1,102 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/mdwt/addpay-go/types"
+)
+
+// ErrAuthorizationExpired is returned when capturing an authorization that has lapsed
+var ErrAuthorizationExpired = errors.New("authorization has expired")
+
+// Authorize holds funds on a card token without capturing them
+func (c Client) Authorize(ctx context.Context, req types.AuthorizeRequest) (types.AuthorizeResponse, error) {
+	log := c.log(ctx)
+	c.applyStoreDefaults(&req.MerchantNo, &req.StoreNo)
+
+	log.Info("Authorizing payment",
+		"merchant_order_no", req.MerchantOrderNo,
+		"token", req.Token,
+		"order_amount", req.OrderAmount)
+
+	var response types.AuthorizeResponse
+	err := c.makeRequest(ctx, "POST", "/authorize", req, &response)
+	if err != nil {
+		log.Error("Authorization failed",
+			"error", err.Error(),
+			"merchant_order_no", req.MerchantOrderNo)
+		return types.AuthorizeResponse{}, err
+	}
+
+	log.Info("Payment authorized",
+		"transaction_id", response.TransactionID,
+		"status", response.AuthStatus,
+		"expires_at", response.ExpiresAt,
+		"merchant_order_no", req.MerchantOrderNo)
+	return response, nil
+}
+
+// Capture captures part or all of an authorization. A zero CaptureAmount
+// captures the full remaining amount; capturing a lapsed authorization
+// returns ErrAuthorizationExpired.
+func (c Client) Capture(ctx context.Context, req types.CaptureRequest) (types.CaptureResponse, error) {
+	log := c.log(ctx)
+	c.applyStoreDefaults(&req.MerchantNo, &req.StoreNo)
+
+	if req.CaptureAmount < 0 {
+		return types.CaptureResponse{}, fmt.Errorf("capture amount must not be negative")
+	}
+
+	log.Info("Capturing authorization",
+		"merchant_order_no", req.MerchantOrderNo,
+		"capture_no", req.CaptureNo,
+		"capture_amount", req.CaptureAmount)
+
+	var response types.CaptureResponse
+	err := c.makeRequest(ctx, "POST", "/capture", req, &response)
+	if err != nil {
+		log.Error("Capture failed",
+			"error", err.Error(),
+			"merchant_order_no", req.MerchantOrderNo)
+		return types.CaptureResponse{}, err
+	}
+	if response.AuthStatus == types.AuthStatusExpired {
+		log.Warn("Capture rejected, authorization expired",
+			"merchant_order_no", req.MerchantOrderNo)
+		return types.CaptureResponse{}, ErrAuthorizationExpired
+	}
+
+	log.Info("Authorization captured",
+		"capture_no", response.CaptureNo,
+		"status", response.AuthStatus,
+		"captured_amount", response.CapturedAmount,
+		"remaining_amount", response.RemainingAmount,
+		"merchant_order_no", req.MerchantOrderNo)
+	return response, nil
+}
+
+// Void releases the uncaptured funds of an authorization
+func (c Client) Void(ctx context.Context, req types.VoidRequest) (types.VoidResponse, error) {
+	log := c.log(ctx)
+	c.applyStoreDefaults(&req.MerchantNo, &req.StoreNo)
+
+	log.Info("Voiding authorization",
+		"merchant_order_no", req.MerchantOrderNo)
+
+	var response types.VoidResponse
+	err := c.makeRequest(ctx, "POST", "/void", req, &response)
+	if err != nil {
+		log.Error("Void failed",
+			"error", err.Error(),
+			"merchant_order_no", req.MerchantOrderNo)
+		return types.VoidResponse{}, err
+	}
+
+	log.Info("Authorization voided",
+		"transaction_id", response.TransactionID,
+		"status", response.AuthStatus,
+		"merchant_order_no", req.MerchantOrderNo)
+	return response, nil
+}
@@ -4,24 +4,32 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"log/slog"
+	"net"
 	"net/http"
 	"net/url"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/mdwt/addpay-go/auth"
 	"github.com/mdwt/addpay-go/logger"
+	"github.com/mdwt/addpay-go/redact"
 	"github.com/mdwt/addpay-go/types"
 )
 
 // Client represents the AddPay API client
 type Client struct {
-	config     types.Config
-	httpClient http.Client
-	auth       auth.RSAAuth
-	logger     types.Logger
+	config         types.Config
+	httpClient     http.Client
+	downloadClient http.Client // no overall timeout, for bodies that stream
+	auth           auth.RSAAuth
+	logger         types.Logger
+	redactor       redact.Redactor
+	clock          *clock
 }
 
 // New creates a new AddPay client
@@ -30,15 +38,42 @@ func New(config types.Config) (Client, error) {
 		return Client{}, fmt.Errorf("app_id is required")
 	}
 
+	// Fill the gateway URL from the environment preset if not provided
+	if config.GatewayURL == "" && config.Environment != "" {
+		presetURL, ok := config.Environment.GatewayURL()
+		if !ok {
+			return Client{}, fmt.Errorf("unknown environment: %s", config.Environment)
+		}
+		config.GatewayURL = presetURL
+	}
+
 	if config.GatewayURL == "" {
 		return Client{}, fmt.Errorf("gateway_url is required")
 	}
 
-	if len(config.MerchantPrivateKey) == 0 {
+	config.GatewayURL = strings.TrimRight(config.GatewayURL, "/")
+	if err := validateGatewayURL(config.GatewayURL); err != nil {
+		return Client{}, err
+	}
+
+	failoverURLs := make([]string, 0, len(config.FailoverURLs))
+	for _, failoverURL := range config.FailoverURLs {
+		failoverURL = strings.TrimRight(failoverURL, "/")
+		if err := validateGatewayURL(failoverURL); err != nil {
+			return Client{}, err
+		}
+		failoverURLs = append(failoverURLs, failoverURL)
+	}
+	config.FailoverURLs = failoverURLs
+
+	if len(config.MerchantPrivateKey) == 0 && config.MerchantSigner == nil {
 		return Client{}, fmt.Errorf("merchant_private_key is required")
 	}
 
-	if len(config.GatewayPublicKey) == 0 {
+	if len(config.GatewayPublicKey) == 0 && config.GatewayKeySet == nil {
+		if config.Environment != "" {
+			return Client{}, fmt.Errorf("gateway_public_key is required: the %s environment does not include the gateway key issued to your app", config.Environment)
+		}
 		return Client{}, fmt.Errorf("gateway_public_key is required")
 	}
 
@@ -47,32 +82,89 @@ func New(config types.Config) (Client, error) {
 		config.Timeout = 30 * time.Second
 	}
 
-	// Set default logger if not provided
+	// Without a logger, log through the application's slog default rather
+	// than writing to stdout
 	if config.Logger == nil {
-		config.Logger = logger.NewDefaultLogger()
+		config.Logger = logger.FromSlog(slog.Default())
 	}
 
+	// Extra rules can only add to the defaults, so tokens, account numbers
+	// and card numbers are always masked
+	redactor := redact.Default().WithRules(config.RedactRules...)
+	config.Logger = logger.Redacted(config.Logger, redactor)
+
 	// Initialize RSA authentication
-	rsaAuth, err := auth.NewRSAAuth(config.MerchantPrivateKey, config.GatewayPublicKey)
+	rsaAuth, err := newRSAAuth(config)
 	if err != nil {
 		return Client{}, fmt.Errorf("failed to initialize RSA auth: %w", err)
 	}
 
+	// A download may take longer than the timeout to stream, so only the
+	// wait for its response headers is bounded; the caller's context covers
+	// the rest
+	downloadTransport := http.DefaultTransport.(*http.Transport).Clone()
+	downloadTransport.ResponseHeaderTimeout = config.Timeout
+
 	client := Client{
 		config: config,
 		httpClient: http.Client{
 			Timeout: config.Timeout,
 		},
-		auth:   rsaAuth,
-		logger: config.Logger,
+		downloadClient: http.Client{
+			Transport: downloadTransport,
+		},
+		auth:     rsaAuth,
+		logger:   config.Logger,
+		redactor: redactor,
+		clock:    &clock{},
 	}
 
 	return client, nil
 }
 
+// newRSAAuth builds the RSA handler, preferring an external signer and a
+// gateway key set over raw key bytes when they are configured
+func newRSAAuth(config types.Config) (auth.RSAAuth, error) {
+	passphrase := merchantKeyPassphrase(config)
+	encrypted := passphrase != nil || auth.IsEncryptedPrivateKey(config.MerchantPrivateKey)
+	if config.MerchantSigner == nil && config.GatewayKeySet == nil && !encrypted {
+		return auth.NewRSAAuth(config.MerchantPrivateKey, config.GatewayPublicKey)
+	}
+
+	signer := config.MerchantSigner
+	if signer == nil {
+		privateKey, err := auth.ParsePrivateKeyWithPassphrase(config.MerchantPrivateKey, passphrase)
+		if err != nil {
+			return auth.RSAAuth{}, fmt.Errorf("failed to parse private key: %w", err)
+		}
+		signer = privateKey
+	}
+
+	if config.GatewayKeySet == nil {
+		return auth.NewRSAAuthWithSigner(signer, config.GatewayPublicKey)
+	}
+	return auth.NewRSAAuthWithKeySet(signer, config.GatewayKeySet)
+}
+
+// merchantKeyPassphrase returns the configured passphrase source, if any
+func merchantKeyPassphrase(config types.Config) auth.PassphraseFunc {
+	if config.MerchantKeyPassphraseFunc != nil {
+		return config.MerchantKeyPassphraseFunc
+	}
+	if len(config.MerchantKeyPassphrase) > 0 {
+		return func() ([]byte, error) {
+			return config.MerchantKeyPassphrase, nil
+		}
+	}
+	return nil
+}
+
 // HostedCheckout creates a hosted checkout request
 func (c Client) HostedCheckout(ctx context.Context, req types.CheckoutRequest) (types.CheckoutResponse, error) {
-	c.logger.Info("Creating hosted checkout",
+	log := c.log(ctx)
+	c.applyStoreDefaults(&req.MerchantNo, &req.StoreNo)
+
+	log.Info("Creating hosted checkout",
 		"merchant_order_no", req.MerchantOrderNo,
 		"order_amount", req.OrderAmount,
 		"currency", req.PriceCurrency)
@@ -80,13 +172,13 @@ func (c Client) HostedCheckout(ctx context.Context, req types.CheckoutRequest) (
 	var response types.CheckoutResponse
 	err := c.makeRequest(ctx, "POST", "/checkout", req, &response)
 	if err != nil {
-		c.logger.Error("Hosted checkout failed",
+		log.Error("Hosted checkout failed",
 			"error", err.Error(),
 			"merchant_order_no", req.MerchantOrderNo)
 		return types.CheckoutResponse{}, err
 	}
 
-	c.logger.Info("Hosted checkout created successfully",
+	log.Info("Hosted checkout created successfully",
 		"pay_url", response.PayURL,
 		"merchant_order_no", req.MerchantOrderNo)
 	return response, nil
@@ -94,41 +186,45 @@ func (c Client) HostedCheckout(ctx context.Context, req types.CheckoutRequest) (
 
 // QueryToken queries token information
 func (c Client) QueryToken(ctx context.Context, req types.QueryTokenRequest) (types.QueryTokenResponse, error) {
-	c.logger.Info("Querying token",
-		"token", "[REDACTED]")
+	log := c.log(ctx)
+	log.Info("Querying token",
+		"token", req.Token)
 
 	var response types.QueryTokenResponse
 	err := c.makeRequest(ctx, "POST", "/query-token", req, &response)
 	if err != nil {
-		c.logger.Error("Query token failed",
+		log.Error("Query token failed",
 			"error", err.Error(),
-			"token", "[REDACTED]")
+			"token", req.Token)
 		return types.QueryTokenResponse{}, err
 	}
 
-	c.logger.Info("Token queried successfully",
+	log.Info("Token queried successfully",
 		"status", response.TokenStatus,
-		"token", "[REDACTED]")
+		"token", req.Token)
 	return response, nil
 }
 
 // TokenizedPay processes a tokenized payment
 func (c Client) TokenizedPay(ctx context.Context, req types.TokenizedPayRequest) (types.TokenizedPayResponse, error) {
-	c.logger.Info("Processing tokenized payment",
+	log := c.log(ctx)
+	c.applyStoreDefaults(&req.MerchantNo, &req.StoreNo)
+
+	log.Info("Processing tokenized payment",
 		"merchant_order_no", req.MerchantOrderNo,
-		"token", "[REDACTED]",
+		"token", req.Token,
 		"order_amount", req.OrderAmount)
 
 	var response types.TokenizedPayResponse
 	err := c.makeRequest(ctx, "POST", "/tokenized-pay", req, &response)
 	if err != nil {
-		c.logger.Error("Tokenized payment failed",
+		log.Error("Tokenized payment failed",
 			"error", err.Error(),
 			"merchant_order_no", req.MerchantOrderNo)
 		return types.TokenizedPayResponse{}, err
 	}
 
-	c.logger.Info("Tokenized payment processed successfully",
+	log.Info("Tokenized payment processed successfully",
 		"transaction_id", response.TransactionID,
 		"status", response.TransactionStatus,
 		"merchant_order_no", req.MerchantOrderNo)
@@ -137,101 +233,143 @@ func (c Client) TokenizedPay(ctx context.Context, req types.TokenizedPayRequest)
 
 // DebitCheck creates a debit check request
 func (c Client) DebitCheck(ctx context.Context, req types.DebitCheckRequest) (types.DebitCheckResponse, error) {
-	c.logger.Info("Creating debit check",
+	log := c.log(ctx)
+	c.applyStoreDefaults(&req.MerchantNo, &req.StoreNo)
+
+	log.Info("Creating debit check",
 		"merchant_order_no", req.MerchantOrderNo,
-		"account_number", "[REDACTED]",
+		"account_number", req.AccountNumber,
 		"bank_code", req.BankCode,
 		"amount", req.Amount)
 
 	var response types.DebitCheckResponse
 	err := c.makeRequest(ctx, "POST", "/debit-check", req, &response)
 	if err != nil {
-		c.logger.Error("Debit check failed",
+		log.Error("Debit check failed",
 			"error", err.Error(),
 			"merchant_order_no", req.MerchantOrderNo)
 		return types.DebitCheckResponse{}, err
 	}
 
-	c.logger.Info("Debit check created successfully",
+	log.Info("Debit check created successfully",
 		"mandate_id", response.MandateID,
 		"status", response.MandateStatus,
 		"merchant_order_no", req.MerchantOrderNo)
 	return response, nil
 }
 
-// makeRequest makes an HTTP request to the AddPay API using parameter-based signing
-func (c Client) makeRequest(ctx context.Context, method, path string, request, response interface{}) error {
-	// Convert request to parameters and add common parameters
-	params := make(map[string]interface{})
+// QueryOrder queries the status of an order
+func (c Client) QueryOrder(ctx context.Context, req types.QueryOrderRequest) (types.QueryOrderResponse, error) {
+	log := c.log(ctx)
+	c.applyStoreDefaults(&req.MerchantNo, &req.StoreNo)
 
-	// Add common parameters
-	params["app_id"] = c.config.AppID
-	params["method"] = path // API method/endpoint
-	params["timestamp"] = strconv.FormatInt(time.Now().Unix(), 10)
-	params["sign_type"] = "RSA2"
+	log.Info("Querying order",
+		"merchant_order_no", req.MerchantOrderNo)
 
-	// Add request-specific parameters
-	if request != nil {
-		requestParams, err := structToMap(request)
-		if err != nil {
-			return fmt.Errorf("failed to convert request to parameters: %w", err)
-		}
-		for k, v := range requestParams {
-			params[k] = v
-		}
+	var response types.QueryOrderResponse
+	err := c.makeRequest(ctx, "POST", "/query-order", req, &response)
+	if err != nil {
+		log.Error("Query order failed",
+			"error", err.Error(),
+			"merchant_order_no", req.MerchantOrderNo)
+		return types.QueryOrderResponse{}, err
 	}
 
-	// Sign the parameters
-	signature, err := c.auth.SignParameters(params)
+	log.Info("Order queried successfully",
+		"transaction_id", response.TransactionID,
+		"status", response.OrderStatus,
+		"merchant_order_no", req.MerchantOrderNo)
+	return response, nil
+}
+
+// Refund refunds all or part of a paid order
+func (c Client) Refund(ctx context.Context, req types.RefundRequest) (types.RefundResponse, error) {
+	log := c.log(ctx)
+	c.applyStoreDefaults(&req.MerchantNo, &req.StoreNo)
+
+	log.Info("Creating refund",
+		"merchant_order_no", req.MerchantOrderNo,
+		"refund_no", req.RefundNo,
+		"refund_amount", req.RefundAmount)
+
+	var response types.RefundResponse
+	err := c.makeRequest(ctx, "POST", "/refund", req, &response)
 	if err != nil {
-		return fmt.Errorf("failed to sign request parameters: %w", err)
+		log.Error("Refund failed",
+			"error", err.Error(),
+			"merchant_order_no", req.MerchantOrderNo,
+			"refund_no", req.RefundNo)
+		return types.RefundResponse{}, err
 	}
-	params["sign"] = signature
 
-	// For POST requests, send as form data (matching Java SDK)
-	var req *http.Request
-	if method == "POST" {
-		// Create form data
-		formData := url.Values{}
-		for key, value := range params {
-			formData.Set(key, fmt.Sprintf("%v", value))
-		}
+	log.Info("Refund created successfully",
+		"refund_id", response.RefundID,
+		"status", response.RefundStatus,
+		"merchant_order_no", req.MerchantOrderNo)
+	return response, nil
+}
 
-		req, err = http.NewRequestWithContext(ctx, method, c.config.GatewayURL+path,
-			bytes.NewBufferString(formData.Encode()))
-		if err != nil {
-			return fmt.Errorf("failed to create request: %w", err)
-		}
-		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
-	} else {
-		// For GET requests, add parameters to URL
-		baseURL := c.config.GatewayURL + path
-		formData := url.Values{}
-		for key, value := range params {
-			formData.Set(key, fmt.Sprintf("%v", value))
-		}
-		fullURL := baseURL + "?" + formData.Encode()
+// QueryRefund queries the status of a refund by its refund number
+func (c Client) QueryRefund(ctx context.Context, req types.QueryRefundRequest) (types.RefundResponse, error) {
+	log := c.log(ctx)
+	c.applyStoreDefaults(&req.MerchantNo, &req.StoreNo)
 
-		req, err = http.NewRequestWithContext(ctx, method, fullURL, nil)
-		if err != nil {
-			return fmt.Errorf("failed to create request: %w", err)
-		}
+	log.Info("Querying refund",
+		"merchant_order_no", req.MerchantOrderNo,
+		"refund_no", req.RefundNo)
+
+	var response types.RefundResponse
+	err := c.makeRequest(ctx, "POST", "/query-refund", req, &response)
+	if err != nil {
+		log.Error("Query refund failed",
+			"error", err.Error(),
+			"merchant_order_no", req.MerchantOrderNo,
+			"refund_no", req.RefundNo)
+		return types.RefundResponse{}, err
 	}
 
-	// Set common headers
-	req.Header.Set("Accept", "application/json")
-	req.Header.Set("User-Agent", "addpay-go/1.0.0")
+	log.Info("Refund queried successfully",
+		"refund_id", response.RefundID,
+		"status", response.RefundStatus,
+		"refund_no", req.RefundNo)
+	return response, nil
+}
 
-	// Log request details
-	c.logger.Debug("Making API request",
-		"method", method,
-		"url", req.URL.String(),
-		"params_count", len(params))
+// makeRequest makes an HTTP request to the AddPay API using parameter-based
+// signing. A request rejected for its timestamp is signed and sent once more
+// if the response showed the local clock is off.
+func (c Client) makeRequest(ctx context.Context, method, path string, request, response interface{}) error {
+	log := c.log(ctx)
+	offset := c.ClockOffset()
+	err := c.doRequest(ctx, method, path, request, response)
+	if err == nil || !isTimestampRejection(err) {
+		return err
+	}
 
-	// Make the request
-	resp, err := c.httpClient.Do(req)
+	if c.ClockOffset() == offset {
+		log.Warn("Gateway rejected the request timestamp, check the system clock",
+			slog.Group("request", "path", path),
+			"local_time", time.Now().UTC().Format(time.RFC3339),
+			"error", err.Error())
+		return err
+	}
+	log.Warn("Gateway rejected the request timestamp, retrying with the corrected clock",
+		slog.Group("request", "path", path),
+		"offset", c.ClockOffset().String())
+	return c.doRequest(ctx, method, path, request, response)
+}
+
+// doRequest signs and sends one request and parses the response envelope
+func (c Client) doRequest(ctx context.Context, method, path string, request, response interface{}) error {
+	log := c.log(ctx)
+	params, err := c.signedParams(path, request)
+	if err != nil {
+		return err
+	}
+
+	resp, err := c.roundTrip(ctx, method, path, params)
 	if err != nil {
-		return fmt.Errorf("request failed: %w", err)
+		return err
 	}
 	defer resp.Body.Close()
 
@@ -242,17 +380,17 @@ func (c Client) makeRequest(ctx context.Context, method, path string, request, r
 	}
 
 	// Log response details
-	c.logger.Debug("Received API response",
-		"status_code", resp.StatusCode,
-		"body_length", len(respBody))
+	log.Debug("Received API response",
+		slog.Group("request", "method", method, "path", path),
+		slog.Group("response", "status_code", resp.StatusCode, "body_length", len(respBody)))
 
 	// Check for HTTP errors
 	if resp.StatusCode >= 400 {
 		var apiResp types.APIResponse
 		if err := json.Unmarshal(respBody, &apiResp); err == nil && apiResp.Error.Message != "" {
-			return apiResp.Error
+			return c.apiError(apiResp.Error)
 		}
-		return fmt.Errorf("HTTP %d: %s", resp.StatusCode, string(respBody))
+		return c.httpError(resp.StatusCode, respBody)
 	}
 
 	// Parse successful response
@@ -261,7 +399,7 @@ func (c Client) makeRequest(ctx context.Context, method, path string, request, r
 		var apiResp types.APIResponse
 		if err := json.Unmarshal(respBody, &apiResp); err == nil {
 			if !apiResp.Success && apiResp.Error.Message != "" {
-				return apiResp.Error
+				return c.apiError(apiResp.Error)
 			}
 			if apiResp.Data != nil {
 				// Re-marshal the data field and unmarshal into our response type
@@ -284,18 +422,258 @@ func (c Client) makeRequest(ctx context.Context, method, path string, request, r
 	return nil
 }
 
+// signedParams builds the common and request parameters for path and signs them
+func (c Client) signedParams(path string, request interface{}) (map[string]interface{}, error) {
+	// Convert request to parameters and add common parameters
+	params := make(map[string]interface{})
+
+	// Add common parameters
+	params["app_id"] = c.config.AppID
+	params["method"] = path // API method/endpoint
+	params["timestamp"] = strconv.FormatInt(c.now().Unix(), 10)
+	params["sign_type"] = "RSA2"
+
+	// Add request-specific parameters
+	if request != nil {
+		requestParams, err := structToMap(request)
+		if err != nil {
+			return nil, fmt.Errorf("failed to convert request to parameters: %w", err)
+		}
+		for k, v := range requestParams {
+			params[k] = v
+		}
+	}
+
+	// Relative expiries are resolved on every attempt so a retry after a
+	// clock correction gets a matching expiry
+	if e, ok := request.(types.Expiring); ok {
+		expires, err := e.ExpiresUnix(c.now())
+		if err != nil {
+			return nil, fmt.Errorf("invalid expiry: %w", err)
+		}
+		if expires != 0 {
+			params["expires"] = strconv.FormatInt(expires, 10)
+		}
+	}
+
+	// Sign the parameters
+	signature, err := c.auth.SignParameters(params)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign request parameters: %w", err)
+	}
+	params["sign"] = signature
+	return params, nil
+}
+
+// roundTrip sends params to path on the primary gateway, then each failover
+// endpoint in order, and returns the first usable response with its body
+// unread. Only failures that show the endpoint did not process the request
+// move on to the next one, since payment and refund calls are not idempotent.
+func (c Client) roundTrip(ctx context.Context, method, path string, params map[string]interface{}) (*http.Response, error) {
+	log := c.log(ctx)
+	var resp *http.Response
+	var err error
+	endpoints := c.endpoints()
+	for i, baseURL := range endpoints {
+		resp, err = c.send(ctx, method, baseURL+path, params)
+		if !shouldFailover(resp, err) {
+			return resp, err
+		}
+		if i == len(endpoints)-1 || ctx.Err() != nil {
+			break
+		}
+		log.Warn("Gateway endpoint unavailable, failing over",
+			slog.Group("request", "method", method, "path", path, "endpoint", baseURL),
+			"next_endpoint", endpoints[i+1],
+			"error", failoverReason(resp, err))
+		if resp != nil {
+			resp.Body.Close()
+		}
+	}
+	return resp, err
+}
+
+// send builds and executes a single HTTP request against the given URL. The
+// caller closes the response body.
+func (c Client) send(ctx context.Context, method, endpoint string, params map[string]interface{}) (*http.Response, error) {
+	log := c.log(ctx)
+	formData := url.Values{}
+	for key, value := range params {
+		formData.Set(key, fmt.Sprintf("%v", value))
+	}
+
+	// For POST requests, send as form data (matching Java SDK)
+	var req *http.Request
+	var err error
+	if method == "POST" {
+		req, err = http.NewRequestWithContext(ctx, method, endpoint,
+			bytes.NewBufferString(formData.Encode()))
+		if err != nil {
+			return nil, fmt.Errorf("failed to create request: %w", err)
+		}
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	} else {
+		// For GET requests, add parameters to URL
+		req, err = http.NewRequestWithContext(ctx, method, endpoint+"?"+formData.Encode(), nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create request: %w", err)
+		}
+	}
+
+	// Set common headers
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("User-Agent", "addpay-go/1.0.0")
+
+	// Log request details
+	log.Debug("Making API request",
+		slog.Group("request", "method", method, "url", req.URL.String(), "params_count", len(params)))
+
+	// Make the request
+	sent := time.Now()
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("request failed: %w", err)
+	}
+	c.observeDate(ctx, resp, sent, time.Now())
+	return resp, nil
+}
+
+// endpoints returns the gateway base URLs in the order they should be tried
+func (c Client) endpoints() []string {
+	endpoints := make([]string, 0, 1+len(c.config.FailoverURLs))
+	endpoints = append(endpoints, c.config.GatewayURL)
+	return append(endpoints, c.config.FailoverURLs...)
+}
+
+// shouldFailover reports whether the next endpoint may be tried. A failed
+// connection or a 503 means the request was not processed. A 502, a 504 or
+// a response lost after sending may follow a charge or refund the endpoint
+// already made, so those are returned to the caller instead.
+func shouldFailover(resp *http.Response, err error) bool {
+	if err != nil {
+		return isConnectError(err)
+	}
+	return resp.StatusCode == http.StatusServiceUnavailable
+}
+
+// isConnectError reports whether err happened before the request was sent,
+// while resolving or connecting to the endpoint
+func isConnectError(err error) bool {
+	var opErr *net.OpError
+	if errors.As(err, &opErr) && opErr.Op == "dial" {
+		return true
+	}
+	var dnsErr *net.DNSError
+	return errors.As(err, &dnsErr)
+}
+
+// failoverReason describes why an endpoint was skipped
+func failoverReason(resp *http.Response, err error) string {
+	if err != nil {
+		return err.Error()
+	}
+	return resp.Status
+}
+
+// validateGatewayURL ensures a gateway URL is absolute and uses HTTPS.
+// Plain HTTP is only accepted for loopback hosts, such as httptest servers.
+func validateGatewayURL(rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return fmt.Errorf("invalid gateway_url %q: %w", rawURL, err)
+	}
+	if u.Host == "" {
+		return fmt.Errorf("invalid gateway_url %q: missing host", rawURL)
+	}
+
+	switch u.Scheme {
+	case "https":
+		return nil
+	case "http":
+		if isLoopbackHost(u.Hostname()) {
+			return nil
+		}
+		return fmt.Errorf("invalid gateway_url %q: https is required", rawURL)
+	default:
+		return fmt.Errorf("invalid gateway_url %q: unsupported scheme %q", rawURL, u.Scheme)
+	}
+}
+
+// isLoopbackHost reports whether host refers to the local machine
+func isLoopbackHost(host string) bool {
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
 // SetLogger allows changing the logger after client creation
-// Returns a new client with the updated logger
-func (c Client) SetLogger(logger types.Logger) Client {
-	c.logger = logger
+// Returns a new client with the updated logger, masked by the client's redactor
+func (c Client) SetLogger(l types.Logger) Client {
+	c.logger = logger.Redacted(l, c.redactor)
 	return c
 }
 
+// ForStore returns a client scoped to the given merchant and store.
+// Requests made through it have empty MerchantNo and StoreNo fields filled in.
+func (c Client) ForStore(merchantNo, storeNo string) Client {
+	c.config.MerchantNo = merchantNo
+	c.config.StoreNo = storeNo
+	return c
+}
+
+// applyStoreDefaults fills empty merchant and store numbers from the configuration
+func (c Client) applyStoreDefaults(merchantNo, storeNo *string) {
+	if *merchantNo == "" {
+		*merchantNo = c.config.MerchantNo
+	}
+	if *storeNo == "" {
+		*storeNo = c.config.StoreNo
+	}
+}
+
+// log returns the client logger bound to the context of an operation
+func (c Client) log(ctx context.Context) types.Logger {
+	return logger.WithContext(c.logger, ctx)
+}
+
+// maxErrorBody bounds how much of an unexpected response body goes into an error
+const maxErrorBody = 512
+
+// httpError describes an HTTP error response that carried no API error,
+// quoting the start of the body with sensitive values masked
+func (c Client) httpError(statusCode int, body []byte) error {
+	if len(body) > maxErrorBody {
+		body = append(body[:maxErrorBody:maxErrorBody], "..."...)
+	}
+	return fmt.Errorf("HTTP %d: %s", statusCode, c.redactor.String(string(body)))
+}
+
+// apiError masks sensitive values the gateway echoed back in an API error,
+// keeping its code so callers can still match it
+func (c Client) apiError(e types.APIError) types.APIError {
+	e.Message = c.redactor.String(e.Message)
+	e.Details = c.redactor.String(e.Details)
+	return e
+}
+
+// Redactor returns the redactor that masks the client's logs and errors
+func (c Client) Redactor() redact.Redactor {
+	return c.redactor
+}
+
 // GetConfig returns the client configuration
 func (c Client) GetConfig() types.Config {
 	return c.config
 }
 
+// GatewayKeys returns the gateway public keys trusted by the client, for
+// verifying notifications with the webhook package
+func (c Client) GatewayKeys() types.GatewayKeys {
+	return c.auth.GatewayKeys()
+}
+
 // structToMap converts a struct to a map[string]interface{} using JSON tags
 func structToMap(s interface{}) (map[string]interface{}, error) {
 	result := make(map[string]interface{})
@@ -306,8 +684,14 @@ func structToMap(s interface{}) (map[string]interface{}, error) {
 		return nil, fmt.Errorf("failed to marshal struct: %w", err)
 	}
 
+	// Keep numbers as JSON wrote them, so the signed parameters carry
+	// 1760000000 and 1000000 rather than 1.76e+09 and 1e+06. The gateway
+	// verifies the signature over these strings; TestSignedParameterFormat
+	// pins them.
 	var tempMap map[string]interface{}
-	if err := json.Unmarshal(jsonBytes, &tempMap); err != nil {
+	decoder := json.NewDecoder(bytes.NewReader(jsonBytes))
+	decoder.UseNumber()
+	if err := decoder.Decode(&tempMap); err != nil {
 		return nil, fmt.Errorf("failed to unmarshal to map: %w", err)
 	}
 
@@ -0,0 +1,96 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/mdwt/addpay-go/types"
+)
+
+// skewTolerance is the clock difference below which the local clock is
+// trusted. The Date header only has second precision, so smaller offsets
+// cannot be measured reliably.
+const skewTolerance = 5 * time.Second
+
+// clock holds the measured offset of the gateway clock from the local clock,
+// shared by every copy of a client
+type clock struct {
+	offset atomic.Int64 // nanoseconds the gateway is ahead
+}
+
+// ClockOffset returns how far the gateway clock is ahead of the local clock,
+// as measured from the Date header of its responses. Request timestamps and
+// ExpiresIn durations are measured from the local clock plus this offset.
+func (c Client) ClockOffset() time.Duration {
+	if c.clock == nil {
+		return 0
+	}
+	return time.Duration(c.clock.offset.Load())
+}
+
+// now returns the current time on the gateway clock
+func (c Client) now() time.Time {
+	return time.Now().Add(c.ClockOffset())
+}
+
+// observeDate measures the gateway clock from the Date header of a response
+// to a request sent at sent and received at received. Offsets within
+// skewTolerance are treated as none.
+func (c Client) observeDate(ctx context.Context, resp *http.Response, sent, received time.Time) {
+	if c.clock == nil {
+		return
+	}
+	date, err := http.ParseTime(resp.Header.Get("Date"))
+	if err != nil {
+		return
+	}
+
+	// The header is truncated to the second, and the gateway read its clock
+	// somewhere between sending and receiving
+	local := sent.Add(received.Sub(sent) / 2)
+	skew := date.Add(500 * time.Millisecond).Sub(local)
+
+	var offset time.Duration
+	if skew >= skewTolerance || skew <= -skewTolerance {
+		offset = skew.Round(time.Second)
+	}
+
+	previous := time.Duration(c.clock.offset.Load())
+	if absDuration(offset-previous) < skewTolerance {
+		return
+	}
+	c.clock.offset.Store(int64(offset))
+
+	if offset == 0 {
+		c.log(ctx).Info("Local clock agrees with the gateway again, no longer adjusting timestamps",
+			"previous_offset", previous.String())
+		return
+	}
+	c.log(ctx).Warn("Local clock differs from the gateway, adjusting request timestamps",
+		"offset", offset.String(),
+		"gateway_time", date.UTC().Format(time.RFC3339),
+		"local_time", local.UTC().Format(time.RFC3339))
+}
+
+// isTimestampRejection reports whether the gateway rejected a request
+// because of its timestamp
+func isTimestampRejection(err error) bool {
+	var apiErr types.APIError
+	if !errors.As(err, &apiErr) {
+		return false
+	}
+	return strings.Contains(strings.ToUpper(apiErr.Code), "TIMESTAMP") ||
+		strings.Contains(strings.ToLower(apiErr.Message), "timestamp")
+}
+
+// absDuration returns the absolute value of d
+func absDuration(d time.Duration) time.Duration {
+	if d < 0 {
+		return -d
+	}
+	return d
+}
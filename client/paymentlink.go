@@ -0,0 +1,139 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"iter"
+
+	"github.com/mdwt/addpay-go/types"
+)
+
+// CreatePaymentLink creates a shareable link that accepts payments until it
+// expires or reaches its maximum number of uses
+func (c Client) CreatePaymentLink(ctx context.Context, req types.CreatePaymentLinkRequest) (types.PaymentLink, error) {
+	log := c.log(ctx)
+	c.applyStoreDefaults(&req.MerchantNo, &req.StoreNo)
+
+	if err := req.Validate(); err != nil {
+		return types.PaymentLink{}, fmt.Errorf("invalid payment link: %w", err)
+	}
+
+	log.Info("Creating payment link",
+		"title", req.Title,
+		"amount", req.Amount,
+		"open_amount", req.OpenAmount(),
+		"max_uses", req.MaxUses)
+
+	var link types.PaymentLink
+	err := c.makeRequest(ctx, "POST", "/create-payment-link", req, &link)
+	if err != nil {
+		log.Error("Create payment link failed",
+			"error", err.Error(),
+			"title", req.Title)
+		return types.PaymentLink{}, err
+	}
+
+	log.Info("Payment link created",
+		"link_id", link.LinkID,
+		"link_url", link.LinkURL)
+	return link, nil
+}
+
+// GetPaymentLink returns a payment link with its current status and use count
+func (c Client) GetPaymentLink(ctx context.Context, linkID string) (types.PaymentLink, error) {
+	log := c.log(ctx)
+	req := types.PaymentLinkRequest{LinkID: linkID}
+	c.applyStoreDefaults(&req.MerchantNo, &req.StoreNo)
+
+	log.Debug("Querying payment link",
+		"link_id", linkID)
+
+	var link types.PaymentLink
+	err := c.makeRequest(ctx, "POST", "/query-payment-link", req, &link)
+	if err != nil {
+		log.Error("Query payment link failed",
+			"error", err.Error(),
+			"link_id", linkID)
+		return types.PaymentLink{}, err
+	}
+	return link, nil
+}
+
+// UpdatePaymentLink changes the details, limits or status of a payment link
+func (c Client) UpdatePaymentLink(ctx context.Context, req types.UpdatePaymentLinkRequest) (types.PaymentLink, error) {
+	log := c.log(ctx)
+	c.applyStoreDefaults(&req.MerchantNo, &req.StoreNo)
+
+	if req.MaxUses < 0 {
+		return types.PaymentLink{}, fmt.Errorf("invalid payment link: max uses must not be negative")
+	}
+	switch req.Status {
+	case "", types.LinkStatusActive, types.LinkStatusInactive:
+	default:
+		return types.PaymentLink{}, fmt.Errorf("invalid payment link: status can only be set to %s or %s",
+			types.LinkStatusActive, types.LinkStatusInactive)
+	}
+
+	log.Info("Updating payment link",
+		"link_id", req.LinkID,
+		"status", req.Status)
+
+	var link types.PaymentLink
+	err := c.makeRequest(ctx, "POST", "/update-payment-link", req, &link)
+	if err != nil {
+		log.Error("Update payment link failed",
+			"error", err.Error(),
+			"link_id", req.LinkID)
+		return types.PaymentLink{}, err
+	}
+	return link, nil
+}
+
+// DeletePaymentLink deletes a payment link. Payments already made through it
+// remain available from LinkPayments.
+func (c Client) DeletePaymentLink(ctx context.Context, linkID string) error {
+	log := c.log(ctx)
+	req := types.PaymentLinkRequest{LinkID: linkID}
+	c.applyStoreDefaults(&req.MerchantNo, &req.StoreNo)
+
+	log.Info("Deleting payment link",
+		"link_id", linkID)
+
+	var link types.PaymentLink
+	err := c.makeRequest(ctx, "POST", "/delete-payment-link", req, &link)
+	if err != nil {
+		log.Error("Delete payment link failed",
+			"error", err.Error(),
+			"link_id", linkID)
+		return err
+	}
+	return nil
+}
+
+// LinkPayments returns the payments made through a link, fetching pages from
+// the gateway as the iterator advances. An error ends the iteration, as does
+// a page that repeats the one before it.
+func (c Client) LinkPayments(ctx context.Context, linkID string) iter.Seq2[types.Transaction, error] {
+	log := c.log(ctx)
+	return func(yield func(types.Transaction, error) bool) {
+		req := types.ListLinkPaymentsRequest{LinkID: linkID, PageSize: defaultPageSize}
+		c.applyStoreDefaults(&req.MerchantNo, &req.StoreNo)
+
+		paginate(req.PageSize, func(pageNo int) (types.ListTransactionsResponse, error) {
+			req.PageNo = pageNo
+			log.Debug("Listing payment link payments",
+				"link_id", linkID,
+				"page_no", req.PageNo)
+
+			var page types.ListTransactionsResponse
+			if err := c.makeRequest(ctx, "POST", "/list-payment-link-payments", req, &page); err != nil {
+				log.Error("List payment link payments failed",
+					"error", err.Error(),
+					"link_id", linkID,
+					"page_no", req.PageNo)
+				return types.ListTransactionsResponse{}, err
+			}
+			return page, nil
+		}, yield)
+	}
+}
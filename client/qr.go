@@ -0,0 +1,103 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/mdwt/addpay-go/types"
+)
+
+// defaultPollInterval is how often WaitForPayment queries the order
+const defaultPollInterval = 2 * time.Second
+
+// CreateQROrder creates a dynamic QR code order for in-store payment. Render
+// the returned QRCode payload with the qrcode package.
+func (c Client) CreateQROrder(ctx context.Context, req types.QROrderRequest) (types.QROrderResponse, error) {
+	log := c.log(ctx)
+	c.applyStoreDefaults(&req.MerchantNo, &req.StoreNo)
+
+	log.Info("Creating QR order",
+		"merchant_order_no", req.MerchantOrderNo,
+		"store_no", req.StoreNo,
+		"order_amount", req.OrderAmount)
+
+	var response types.QROrderResponse
+	err := c.makeRequest(ctx, "POST", "/qr-order", req, &response)
+	if err != nil {
+		log.Error("QR order creation failed",
+			"error", err.Error(),
+			"merchant_order_no", req.MerchantOrderNo)
+		return types.QROrderResponse{}, err
+	}
+
+	log.Info("QR order created",
+		"transaction_id", response.TransactionID,
+		"merchant_order_no", req.MerchantOrderNo)
+	return response, nil
+}
+
+// CancelOrder cancels an order that has not been paid, such as a QR order
+// the customer walked away from
+func (c Client) CancelOrder(ctx context.Context, req types.CancelOrderRequest) (types.CancelOrderResponse, error) {
+	log := c.log(ctx)
+	c.applyStoreDefaults(&req.MerchantNo, &req.StoreNo)
+
+	log.Info("Cancelling order",
+		"merchant_order_no", req.MerchantOrderNo)
+
+	var response types.CancelOrderResponse
+	err := c.makeRequest(ctx, "POST", "/cancel-order", req, &response)
+	if err != nil {
+		log.Error("Order cancellation failed",
+			"error", err.Error(),
+			"merchant_order_no", req.MerchantOrderNo)
+		return types.CancelOrderResponse{}, err
+	}
+
+	log.Info("Order cancelled",
+		"status", response.OrderStatus,
+		"merchant_order_no", req.MerchantOrderNo)
+	return response, nil
+}
+
+// WaitForPayment queries the order every interval until its status is final,
+// such as paid, failed or expired, and returns the last result. Failed
+// queries are retried, so bound the wait with a context deadline; a zero
+// interval polls every two seconds.
+func (c Client) WaitForPayment(ctx context.Context, req types.QueryOrderRequest, interval time.Duration) (types.QueryOrderResponse, error) {
+	log := c.log(ctx)
+	if interval <= 0 {
+		interval = defaultPollInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var order types.QueryOrderResponse
+	var lastErr error
+	for {
+		current, err := c.QueryOrder(ctx, req)
+		if err == nil {
+			order, lastErr = current, nil
+			if types.ParsePaymentStatus(order.OrderStatus).Final() {
+				return order, nil
+			}
+		} else if ctx.Err() == nil {
+			// A timeout or gateway hiccup says nothing about the payment
+			lastErr = err
+			log.Warn("Order query failed, retrying",
+				"error", err.Error(),
+				"merchant_order_no", req.MerchantOrderNo)
+		}
+
+		select {
+		case <-ctx.Done():
+			if lastErr != nil {
+				return order, fmt.Errorf("order %s not final: %w", req.MerchantOrderNo, errors.Join(ctx.Err(), lastErr))
+			}
+			return order, fmt.Errorf("order %s still %s: %w", req.MerchantOrderNo, order.OrderStatus, ctx.Err())
+		case <-ticker.C:
+		}
+	}
+}
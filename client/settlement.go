@@ -0,0 +1,60 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"time"
+
+	"github.com/mdwt/addpay-go/types"
+)
+
+// DownloadSettlementReport opens the gateway's settlement file for a store
+// and day. The body is streamed rather than buffered, so the caller must
+// close it; parse it with the settlement package. Config.Timeout bounds the
+// wait for the gateway to answer but not the download itself, which ctx
+// bounds instead.
+func (c Client) DownloadSettlementReport(ctx context.Context, date time.Time, storeNo string) (io.ReadCloser, error) {
+	log := c.log(ctx)
+	req := types.SettlementReportRequest{
+		StoreNo:        storeNo,
+		SettlementDate: date.Format("2006-01-02"),
+	}
+	c.applyStoreDefaults(&req.MerchantNo, &req.StoreNo)
+
+	log.Info("Downloading settlement report",
+		"store_no", req.StoreNo,
+		"settlement_date", req.SettlementDate)
+
+	params, err := c.signedParams("/settlement-report", req)
+	if err != nil {
+		return nil, err
+	}
+	c.httpClient = c.downloadClient
+	resp, err := c.roundTrip(ctx, "POST", "/settlement-report", params)
+	if err != nil {
+		log.Error("Settlement report download failed",
+			"error", err.Error(),
+			"settlement_date", req.SettlementDate)
+		return nil, err
+	}
+
+	// Errors come back as the usual JSON envelope instead of a file
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if resp.StatusCode >= 400 || mediaType == "application/json" {
+		defer resp.Body.Close()
+		body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read response: %w", err)
+		}
+		var apiResp types.APIResponse
+		if err := json.Unmarshal(body, &apiResp); err == nil && apiResp.Error.Message != "" {
+			return nil, c.apiError(apiResp.Error)
+		}
+		return nil, c.httpError(resp.StatusCode, body)
+	}
+
+	return resp.Body, nil
+}
@@ -0,0 +1,110 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"iter"
+	"strings"
+
+	"github.com/mdwt/addpay-go/types"
+)
+
+const (
+	defaultPageSize = 100   // transactions requested per page
+	maxPages        = 10000 // bounds a listing whose gateway never reports its end
+)
+
+// ListTransactions returns the transactions matching filter, fetching pages
+// from the gateway as the iterator advances. An error ends the iteration, as
+// does a page that repeats the one before it, which means the gateway
+// ignored the page number.
+func (c Client) ListTransactions(ctx context.Context, filter types.TransactionFilter) iter.Seq2[types.Transaction, error] {
+	log := c.log(ctx)
+	return func(yield func(types.Transaction, error) bool) {
+		if !filter.From.IsZero() && !filter.To.IsZero() && filter.To.Before(filter.From) {
+			yield(types.Transaction{}, fmt.Errorf("invalid date range: %s is before %s", filter.To, filter.From))
+			return
+		}
+
+		req := types.ListTransactionsRequest{
+			MerchantNo:  filter.MerchantNo,
+			StoreNo:     filter.StoreNo,
+			OrderStatus: filter.Status,
+			PayMethod:   filter.PayMethod,
+			PageSize:    filter.PageSize,
+		}
+		c.applyStoreDefaults(&req.MerchantNo, &req.StoreNo)
+		if req.PageSize <= 0 {
+			req.PageSize = defaultPageSize
+		}
+		if !filter.From.IsZero() {
+			req.StartTime = filter.From.Unix()
+		}
+		if !filter.To.IsZero() {
+			req.EndTime = filter.To.Unix()
+		}
+
+		paginate(req.PageSize, func(pageNo int) (types.ListTransactionsResponse, error) {
+			req.PageNo = pageNo
+			log.Debug("Listing transactions",
+				"store_no", req.StoreNo,
+				"page_no", req.PageNo)
+
+			var page types.ListTransactionsResponse
+			if err := c.makeRequest(ctx, "POST", "/list-transactions", req, &page); err != nil {
+				log.Error("List transactions failed",
+					"error", err.Error(),
+					"page_no", req.PageNo)
+				return types.ListTransactionsResponse{}, err
+			}
+			return page, nil
+		}, yield)
+	}
+}
+
+// paginate yields the transactions of the pages fetch returns, starting at
+// page 1. It stops on a short page, once the reported total is reached, or
+// with an error when fetch fails, a page repeats the one before it or
+// maxPages is exceeded.
+func paginate(pageSize int, fetch func(pageNo int) (types.ListTransactionsResponse, error), yield func(types.Transaction, error) bool) {
+	seen := 0
+	var previous string
+	for pageNo := 1; pageNo <= maxPages; pageNo++ {
+		page, err := fetch(pageNo)
+		if err != nil {
+			yield(types.Transaction{}, err)
+			return
+		}
+
+		key := pageKey(page.Transactions)
+		if len(page.Transactions) > 0 && key == previous {
+			yield(types.Transaction{}, fmt.Errorf("gateway returned the same transactions for page %d as page %d", pageNo, pageNo-1))
+			return
+		}
+		previous = key
+
+		for _, tx := range page.Transactions {
+			if !yield(tx, nil) {
+				return
+			}
+		}
+		seen += len(page.Transactions)
+
+		if len(page.Transactions) < pageSize || (page.Total > 0 && seen >= page.Total) {
+			return
+		}
+	}
+	yield(types.Transaction{}, fmt.Errorf("listing stopped after %d pages", maxPages))
+}
+
+// pageKey identifies the transactions on a page
+func pageKey(transactions []types.Transaction) string {
+	var b strings.Builder
+	for _, tx := range transactions {
+		b.WriteString(tx.TransactionID)
+		b.WriteByte('/')
+		b.WriteString(tx.MerchantOrderNo)
+		b.WriteByte('\n')
+	}
+	return b.String()
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/mdwt/addpay-go/auth"
+	"github.com/mdwt/addpay-go/diagnostics"
+	"github.com/mdwt/addpay-go/redact"
+	"github.com/mdwt/addpay-go/types"
+)
+
+func init() {
+	register(command{name: "diagnose", summary: "explain why a signature fails", run: runDiagnose})
+}
+
+// diagnoseReport is the output of the diagnose command
+type diagnoseReport struct {
+	diagnostics.SignStringReport
+	MerchantPrivateKey *diagnostics.KeyInfo      `json:"merchant_private_key,omitempty"`
+	MerchantPublicKey  *diagnostics.KeyInfo      `json:"merchant_public_key,omitempty"`
+	GatewayPublicKey   *diagnostics.KeyInfo      `json:"gateway_public_key,omitempty"`
+	KeyPair            string                    `json:"key_pair,omitempty"`
+	Verification       *diagnostics.VerifyReport `json:"verification,omitempty"`
+	Problems           []string                  `json:"problems,omitempty"`
+}
+
+func runDiagnose(a *app, args []string) error {
+	fs := a.newFlagSet("diagnose")
+	capturePath := fs.String("capture", "", "captured request or response body (form or JSON)")
+	paramsPath := fs.String("params", "", "JSON file with parameters")
+	signedBy := fs.String("signed-by", "gateway", "who signed the capture: gateway (responses, webhooks) or merchant (requests)")
+	privateKeyPath := fs.String("private-key", "", "merchant private key file (default from profile)")
+	publicKeyPath := fs.String("public-key", "", "merchant public key file (default APP_RSA_PUBLIC_KEY from profile)")
+	gatewayKeyPath := fs.String("gateway-key", "", "gateway public key file (default from profile)")
+	fs.Usage = func() {
+		fmt.Fprintln(a.stderr, "Usage: addpay diagnose [flags] [key=value ...]")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	params, err := readParams(*paramsPath, fs.Args())
+	if *capturePath != "" {
+		data, readErr := os.ReadFile(*capturePath)
+		if readErr != nil {
+			return fmt.Errorf("failed to read capture: %w", readErr)
+		}
+		params, err = diagnostics.ParseCapture(data)
+	}
+	if err != nil {
+		return err
+	}
+
+	report := diagnoseReport{SignStringReport: diagnostics.ExplainSignString(params)}
+	for _, f := range report.Filtered {
+		if f.Key != "sign" {
+			report.Problems = append(report.Problems, fmt.Sprintf("%s is not signed: %s", f.Key, f.Reason))
+		}
+	}
+
+	// Collect the keys from flags, falling back to the profile
+	cfg, cfgErr := a.profile.config()
+	lookup, _ := a.profile.lookup()
+
+	var merchantPublicKey []byte
+	if lookup != nil {
+		if value, ok := lookup("APP_RSA_PUBLIC_KEY"); ok {
+			merchantPublicKey = []byte(value)
+		}
+	}
+	privateKey, err := readKeyOr(*privateKeyPath, cfg.MerchantPrivateKey)
+	if err != nil {
+		return err
+	}
+	gatewayKey, err := readKeyOr(*gatewayKeyPath, cfg.GatewayPublicKey)
+	if err != nil {
+		return err
+	}
+	merchantPublicKey, err = readKeyOr(*publicKeyPath, merchantPublicKey)
+	if err != nil {
+		return err
+	}
+
+	if len(privateKey) == 0 && len(gatewayKey) == 0 && cfgErr != nil {
+		report.Problems = append(report.Problems, "failed to load profile: "+cfgErr.Error())
+	}
+
+	var parsedPrivate *auth.RSAAuth
+	if len(privateKey) > 0 {
+		info := diagnostics.DetectKeyFormat(privateKey)
+		report.MerchantPrivateKey = &info
+
+		passphrase := merchantPassphrase(cfg)
+		key, err := auth.ParsePrivateKeyWithPassphrase(privateKey, passphrase)
+		switch {
+		case err != nil:
+			report.Problems = append(report.Problems, "merchant private key: "+err.Error())
+		case len(merchantPublicKey) > 0:
+			if err := diagnostics.CheckSignerKeyPair(key, merchantPublicKey); err != nil {
+				report.KeyPair = err.Error()
+				report.Problems = append(report.Problems, "merchant keys: "+err.Error())
+			} else {
+				report.KeyPair = "ok"
+			}
+		}
+		if err == nil {
+			rsaAuth, _ := auth.NewRSAAuthWithKeySet(key, auth.NewKeySet(auth.GatewayKey{ID: "merchant", PublicKey: &key.PublicKey}))
+			parsedPrivate = &rsaAuth
+		}
+	}
+	if len(merchantPublicKey) > 0 {
+		info := diagnostics.DetectKeyFormat(merchantPublicKey)
+		report.MerchantPublicKey = &info
+	}
+	if len(gatewayKey) > 0 {
+		info := diagnostics.DetectKeyFormat(gatewayKey)
+		report.GatewayPublicKey = &info
+		if info.Format != diagnostics.FormatX509Public {
+			report.Problems = append(report.Problems, fmt.Sprintf("gateway key is a %s, expected an X.509 public key", info.Format))
+		}
+	}
+
+	// Verify the capture end to end when it carries a signature
+	if _, signed := params["sign"]; signed {
+		var keys types.GatewayKeys
+		switch *signedBy {
+		case "merchant":
+			if parsedPrivate != nil {
+				keys = parsedPrivate.GatewayKeys()
+			}
+		case "gateway":
+			if cfg.GatewayKeySet != nil && *gatewayKeyPath == "" {
+				keys = cfg.GatewayKeySet
+			} else if key, err := auth.ParseGatewayKey("gateway", gatewayKey, time.Time{}, time.Time{}); err == nil {
+				keys = auth.NewKeySet(key)
+			}
+		default:
+			return fmt.Errorf("unknown --signed-by %q, want gateway or merchant", *signedBy)
+		}
+
+		if keys == nil {
+			report.Problems = append(report.Problems, fmt.Sprintf("no usable %s key to verify the capture", *signedBy))
+		} else {
+			verification := diagnostics.VerifyCapture(params, keys)
+			report.Verification = &verification
+			if !verification.Valid {
+				report.Problems = append(report.Problems, "signature: "+verification.Error)
+			}
+		}
+	}
+
+	return a.printJSON(report.redact(a.redactor()))
+}
+
+// redact masks sensitive values in the parameters and problems of the report
+func (r diagnoseReport) redact(redactor redact.Redactor) diagnoseReport {
+	r.SignStringReport = r.SignStringReport.Redact(redactor)
+	if r.Verification != nil {
+		verification := r.Verification.Redact(redactor)
+		r.Verification = &verification
+	}
+	problems := make([]string, len(r.Problems))
+	for i, problem := range r.Problems {
+		problems[i] = redactor.String(problem)
+	}
+	if r.Problems != nil {
+		r.Problems = problems
+	}
+	return r
+}
+
+// readKeyOr reads a key file if path is set, otherwise returns fallback
+func readKeyOr(path string, fallback []byte) ([]byte, error) {
+	if path == "" {
+		return fallback, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read key: %w", err)
+	}
+	return data, nil
+}
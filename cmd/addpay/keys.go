@@ -0,0 +1,252 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/mdwt/addpay-go/auth"
+	"github.com/mdwt/addpay-go/types"
+)
+
+func init() {
+	register(command{name: "keygen", summary: "generate a merchant RSA key pair", run: runKeygen})
+	register(command{name: "sign", summary: "sign a parameter set with the merchant key", run: runSign})
+	register(command{name: "verify", summary: "verify a signed parameter set", run: runVerify})
+}
+
+func runKeygen(a *app, args []string) error {
+	fs := a.newFlagSet("keygen")
+	bits := fs.Int("bits", 2048, "RSA key size in bits")
+	format := fs.String("format", "pkcs8", "private key format: pkcs1 or pkcs8")
+	outDir := fs.String("out", ".", "directory for merchant_private.pem and merchant_public.pem")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	key, err := rsa.GenerateKey(rand.Reader, *bits)
+	if err != nil {
+		return fmt.Errorf("failed to generate key: %w", err)
+	}
+
+	var block *pem.Block
+	switch *format {
+	case "pkcs1":
+		block = &pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)}
+	case "pkcs8":
+		der, err := x509.MarshalPKCS8PrivateKey(key)
+		if err != nil {
+			return fmt.Errorf("failed to marshal private key: %w", err)
+		}
+		block = &pem.Block{Type: "PRIVATE KEY", Bytes: der}
+	default:
+		return fmt.Errorf("unknown format %q, want pkcs1 or pkcs8", *format)
+	}
+
+	publicPEM, err := auth.PublicKeyPEM(&key.PublicKey)
+	if err != nil {
+		return err
+	}
+	portalKey, err := auth.PublicKeyBase64(&key.PublicKey)
+	if err != nil {
+		return err
+	}
+
+	privatePath := filepath.Join(*outDir, "merchant_private.pem")
+	publicPath := filepath.Join(*outDir, "merchant_public.pem")
+	if err := writeNewFile(privatePath, pem.EncodeToMemory(block), 0o600); err != nil {
+		return err
+	}
+	if err := writeNewFile(publicPath, publicPEM, 0o644); err != nil {
+		return err
+	}
+
+	return a.printJSON(map[string]string{
+		"private_key_file":  privatePath,
+		"public_key_file":   publicPath,
+		"portal_public_key": portalKey,
+	})
+}
+
+func runSign(a *app, args []string) error {
+	fs := a.newFlagSet("sign")
+	keyPath := fs.String("private-key", "", "merchant private key file (default from profile)")
+	paramsPath := fs.String("params", "", "JSON file with the parameters to sign")
+	fs.Usage = func() {
+		fmt.Fprintln(a.stderr, "Usage: addpay sign [flags] [key=value ...]")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	params, err := readParams(*paramsPath, fs.Args())
+	if err != nil {
+		return err
+	}
+
+	rsaAuth, err := a.merchantAuth(*keyPath)
+	if err != nil {
+		return err
+	}
+
+	signature, err := rsaAuth.SignParameters(params)
+	if err != nil {
+		return err
+	}
+	return a.printJSON(map[string]string{
+		"sign_string": auth.SignString(params),
+		"sign":        signature,
+	})
+}
+
+func runVerify(a *app, args []string) error {
+	fs := a.newFlagSet("verify")
+	keyPath := fs.String("public-key", "", "public key file (default gateway key from profile)")
+	paramsPath := fs.String("params", "", "JSON file with the signed parameters")
+	signature := fs.String("signature", "", "signature to check (default the \"sign\" parameter)")
+	fs.Usage = func() {
+		fmt.Fprintln(a.stderr, "Usage: addpay verify [flags] [key=value ...]")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	params, err := readParams(*paramsPath, fs.Args())
+	if err != nil {
+		return err
+	}
+	if *signature == "" {
+		*signature = fmt.Sprintf("%v", params["sign"])
+	}
+	if *signature == "" || *signature == "<nil>" {
+		return fmt.Errorf("no signature given, pass --signature or a sign parameter")
+	}
+
+	keys, err := a.publicKeySet(*keyPath)
+	if err != nil {
+		return err
+	}
+
+	signString := auth.SignString(params)
+	keyID, err := keys.Verify([]byte(signString), *signature)
+	result := map[string]interface{}{
+		"sign_string": signString,
+		"valid":       err == nil,
+	}
+	if err != nil {
+		result["error"] = err.Error()
+	} else if keyID != "" {
+		result["key_id"] = keyID
+	}
+	if printErr := a.printJSON(result); printErr != nil {
+		return printErr
+	}
+	if err != nil {
+		return fmt.Errorf("signature is not valid")
+	}
+	return nil
+}
+
+// merchantAuth builds a signing handler from a key file or the profile key
+func (a *app) merchantAuth(keyPath string) (auth.RSAAuth, error) {
+	cfg, err := a.profile.config()
+	if keyPath == "" && err != nil {
+		return auth.RSAAuth{}, err
+	}
+
+	keyData := cfg.MerchantPrivateKey
+	if keyPath != "" {
+		keyData, err = os.ReadFile(keyPath)
+		if err != nil {
+			return auth.RSAAuth{}, fmt.Errorf("failed to read private key: %w", err)
+		}
+	}
+
+	passphrase := merchantPassphrase(cfg)
+
+	privateKey, err := auth.ParsePrivateKeyWithPassphrase(keyData, passphrase)
+	if err != nil {
+		return auth.RSAAuth{}, err
+	}
+	return auth.NewRSAAuthWithKeySet(privateKey, auth.NewKeySet(auth.GatewayKey{PublicKey: &privateKey.PublicKey}))
+}
+
+// publicKeySet loads a verification key from a file or the profile gateway key
+func (a *app) publicKeySet(keyPath string) (types.GatewayKeys, error) {
+	var keyData []byte
+	if keyPath != "" {
+		data, err := os.ReadFile(keyPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read public key: %w", err)
+		}
+		keyData = data
+	} else {
+		cfg, err := a.profile.config()
+		if err != nil {
+			return nil, err
+		}
+		if cfg.GatewayKeySet != nil {
+			return cfg.GatewayKeySet, nil
+		}
+		keyData = cfg.GatewayPublicKey
+	}
+
+	key, err := auth.ParseGatewayKey("", keyData, time.Time{}, time.Time{})
+	if err != nil {
+		return nil, err
+	}
+	return auth.NewKeySet(key), nil
+}
+
+// readParams merges parameters from a JSON file and key=value arguments
+func readParams(path string, pairs []string) (map[string]interface{}, error) {
+	params := make(map[string]interface{})
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read params: %w", err)
+		}
+		// Keep numbers as written so the sign string matches the gateway's
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.UseNumber()
+		if err := decoder.Decode(&params); err != nil {
+			return nil, fmt.Errorf("failed to parse params: %w", err)
+		}
+	}
+
+	for _, pair := range pairs {
+		key, value, ok := strings.Cut(pair, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid parameter %q, want key=value", pair)
+		}
+		params[key] = value
+	}
+
+	if len(params) == 0 {
+		return nil, fmt.Errorf("no parameters given")
+	}
+	return params, nil
+}
+
+// writeNewFile writes data to path, refusing to overwrite an existing file
+func writeNewFile(path string, data []byte, perm os.FileMode) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, perm)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,232 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/mdwt/addpay-go/auth"
+	"github.com/mdwt/addpay-go/redact"
+	"github.com/mdwt/addpay-go/types"
+	"github.com/mdwt/addpay-go/webhook"
+)
+
+func init() {
+	register(command{name: "listen", summary: "receive notifications on localhost and store them", run: runListen})
+	register(command{name: "replay", summary: "send a stored notification to a URL", run: runReplay})
+}
+
+// storedEvent is a received notification as written to disk by listen
+type storedEvent struct {
+	ReceivedAt   time.Time              `json:"received_at"`
+	Valid        bool                   `json:"valid"`
+	Error        string                 `json:"error,omitempty"`
+	File         string                 `json:"file,omitempty"`
+	Notification *types.Notification    `json:"notification,omitempty"`
+	Params       map[string]interface{} `json:"params"`
+}
+
+func runListen(a *app, args []string) error {
+	fs := a.newFlagSet("listen")
+	addr := fs.String("addr", "127.0.0.1:8787", "address to listen on")
+	path := fs.String("path", "/webhook", "URL path to receive notifications on")
+	dir := fs.String("dir", "webhooks", "directory to store received notifications in")
+	keyPath := fs.String("public-key", "", "public key file to verify with (default gateway key from profile)")
+	insecure := fs.Bool("insecure", false, "acknowledge notifications even when the signature is invalid")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	keys, err := a.publicKeySet(*keyPath)
+	if err != nil {
+		return err
+	}
+	verifier := webhook.NewVerifier(keys)
+
+	if err := os.MkdirAll(*dir, 0o755); err != nil {
+		return fmt.Errorf("failed to create event directory: %w", err)
+	}
+
+	var output sync.Mutex
+	mux := http.NewServeMux()
+	mux.HandleFunc(*path, func(w http.ResponseWriter, r *http.Request) {
+		params, err := webhook.ReadParams(r)
+		if err != nil {
+			fmt.Fprintf(a.stderr, "rejected notification: %v\n", err)
+			http.Error(w, "invalid notification", http.StatusBadRequest)
+			return
+		}
+
+		event := storedEvent{ReceivedAt: time.Now().UTC(), Params: params}
+		notification, err := verifier.Verify(params)
+		if err != nil {
+			event.Error = err.Error()
+		} else {
+			event.Valid = true
+			event.Notification = &notification
+		}
+
+		output.Lock()
+		event.File, err = saveEvent(*dir, event)
+		if err != nil {
+			fmt.Fprintf(a.stderr, "failed to store notification: %v\n", err)
+		}
+		a.printJSON(event.redact(a.redactor()))
+		output.Unlock()
+
+		if !event.Valid && !*insecure {
+			http.Error(w, "invalid notification", http.StatusBadRequest)
+			return
+		}
+		io.WriteString(w, "success")
+	})
+
+	listener, err := net.Listen("tcp", *addr)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(a.stderr, "Listening for notifications on http://%s%s, storing them in %s\n", listener.Addr(), *path, *dir)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	server := &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		server.Shutdown(shutdownCtx)
+	}()
+
+	if err := server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// redact masks sensitive values in an event for printing. Stored events keep
+// the raw parameters so their signature can still be replayed.
+func (e storedEvent) redact(redactor redact.Redactor) storedEvent {
+	e.Params = redactor.Params(e.Params)
+	e.Error = redactor.String(e.Error)
+	return e
+}
+
+// unsafeFileChars matches characters not allowed in stored event file names
+var unsafeFileChars = regexp.MustCompile(`[^A-Za-z0-9_-]+`)
+
+// saveEvent writes event to dir and returns the file path
+func saveEvent(dir string, event storedEvent) (string, error) {
+	name := event.ReceivedAt.Format("20060102T150405.000000000")
+	if event.Notification != nil && event.Notification.MerchantOrderNo != "" {
+		name += "-" + unsafeFileChars.ReplaceAllString(event.Notification.MerchantOrderNo, "_")
+	}
+	path := filepath.Join(dir, name+".json")
+
+	data, err := json.MarshalIndent(event, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	if err := writeNewFile(path, append(data, '\n'), 0o600); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+func runReplay(a *app, args []string) error {
+	fs := a.newFlagSet("replay")
+	target := fs.String("target", "http://127.0.0.1:8787/webhook", "URL to send the notification to")
+	keyPath := fs.String("sign-key", "", "test gateway private key to re-sign the notification with (default send the stored signature)")
+	fs.Usage = func() {
+		fmt.Fprintln(a.stderr, "Usage: addpay replay [flags] <event.json>")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return flag.ErrHelp
+	}
+
+	data, err := os.ReadFile(fs.Arg(0))
+	if err != nil {
+		return fmt.Errorf("failed to read event: %w", err)
+	}
+	// Keep numbers as stored so the original signature still matches
+	var event storedEvent
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if err := decoder.Decode(&event); err != nil {
+		return fmt.Errorf("failed to parse event: %w", err)
+	}
+	if len(event.Params) == 0 {
+		return fmt.Errorf("event %s has no parameters", fs.Arg(0))
+	}
+
+	params := event.Params
+	if *keyPath != "" {
+		// Re-signing as a fake gateway also refreshes the timestamp so
+		// replay protection treats the event as new
+		keyData, err := os.ReadFile(*keyPath)
+		if err != nil {
+			return fmt.Errorf("failed to read private key: %w", err)
+		}
+		privateKey, err := auth.ParsePrivateKey(keyData)
+		if err != nil {
+			return err
+		}
+		signer, err := auth.NewRSAAuthWithKeySet(privateKey, auth.NewKeySet(auth.GatewayKey{PublicKey: &privateKey.PublicKey}))
+		if err != nil {
+			return err
+		}
+
+		delete(params, "sign")
+		params["timestamp"] = strconv.FormatInt(time.Now().Unix(), 10)
+		signature, err := signer.SignParameters(params)
+		if err != nil {
+			return err
+		}
+		params["sign"] = signature
+	}
+
+	form := url.Values{}
+	for key, value := range params {
+		form.Set(key, fmt.Sprintf("%v", value))
+	}
+	resp, err := http.Post(*target, "application/x-www-form-urlencoded", bytes.NewBufferString(form.Encode()))
+	if err != nil {
+		return fmt.Errorf("failed to send notification: %w", err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return fmt.Errorf("failed to read response: %w", err)
+	}
+
+	if err := a.printJSON(map[string]interface{}{
+		"target":      *target,
+		"status_code": resp.StatusCode,
+		"response":    a.redactor().String(string(body)),
+	}); err != nil {
+		return err
+	}
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("target answered HTTP %d", resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,138 @@
+// Command addpay runs AddPay operations from the command line.
+//
+// Usage:
+//
+//	addpay [--env profile] [--config file] [--verbose] [--show-secrets] <command> [flags]
+//
+// Credentials come from the environment variables in .env.example, a .env
+// style profile selected with --env, or a JSON/YAML file given with --config.
+// A profile name such as "sandbox" is looked up as ~/.addpay/sandbox.env.
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+
+	"github.com/mdwt/addpay-go/redact"
+)
+
+// command is a single CLI subcommand
+type command struct {
+	name    string
+	summary string
+	run     func(app *app, args []string) error
+}
+
+// app carries the global options and output streams shared by all commands
+type app struct {
+	stdout      io.Writer
+	stderr      io.Writer
+	profile     profile
+	showSecrets bool
+}
+
+// commands lists every subcommand, registered by the files that implement them
+var commands = map[string]command{}
+
+// register adds a subcommand to the CLI
+func register(cmd command) {
+	commands[cmd.name] = cmd
+}
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+// run parses the global flags, dispatches to a subcommand and returns the exit code
+func run(args []string, stdout, stderr io.Writer) int {
+	global := flag.NewFlagSet("addpay", flag.ContinueOnError)
+	global.SetOutput(stderr)
+	envName := global.String("env", "", "profile name or path to a .env file")
+	configPath := global.String("config", "", "path to a JSON or YAML config file")
+	verbose := global.Bool("verbose", false, "log API requests and responses")
+	showSecrets := global.Bool("show-secrets", false, "print tokens, card numbers and signatures in debug output unmasked")
+	global.Usage = func() { usage(stderr, global) }
+
+	if err := global.Parse(args); err != nil {
+		return 2
+	}
+	if global.NArg() == 0 {
+		usage(stderr, global)
+		return 2
+	}
+
+	cmd, ok := commands[global.Arg(0)]
+	if !ok {
+		fmt.Fprintf(stderr, "addpay: unknown command %q\n\n", global.Arg(0))
+		usage(stderr, global)
+		return 2
+	}
+
+	a := &app{
+		stdout: stdout,
+		stderr: stderr,
+		profile: profile{
+			envName:    *envName,
+			configPath: *configPath,
+			verbose:    *verbose,
+		},
+		showSecrets: *showSecrets,
+	}
+
+	if err := cmd.run(a, global.Args()[1:]); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 2
+		}
+		fmt.Fprintf(stderr, "addpay %s: %v\n", cmd.name, err)
+		return 1
+	}
+	return 0
+}
+
+// usage prints the global help text
+func usage(w io.Writer, global *flag.FlagSet) {
+	fmt.Fprintln(w, "Usage: addpay [global flags] <command> [flags]")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Commands:")
+
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(w, "  %-15s %s\n", name, commands[name].summary)
+	}
+
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Global flags:")
+	global.PrintDefaults()
+}
+
+// newFlagSet creates a flag set for a subcommand that reports errors to stderr
+func (a *app) newFlagSet(name string) *flag.FlagSet {
+	fs := flag.NewFlagSet("addpay "+name, flag.ContinueOnError)
+	fs.SetOutput(a.stderr)
+	return fs
+}
+
+// redactor masks sensitive values in debug output unless --show-secrets is set
+func (a *app) redactor() redact.Redactor {
+	if a.showSecrets {
+		return redact.New()
+	}
+	return redact.Default()
+}
+
+// printJSON writes v to stdout as indented JSON
+func (a *app) printJSON(v interface{}) error {
+	encoder := json.NewEncoder(a.stdout)
+	encoder.SetIndent("", "  ")
+	encoder.SetEscapeHTML(false)
+	return encoder.Encode(v)
+}
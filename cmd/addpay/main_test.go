@@ -0,0 +1,238 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/mdwt/addpay-go/auth"
+)
+
+// testProfile writes a .env profile for a fake gateway serving handler and
+// returns its path for --env
+func testProfile(t *testing.T, handler http.Handler) string {
+	t.Helper()
+
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Failed to generate RSA key: %v", err)
+	}
+	publicDER, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		t.Fatalf("Failed to marshal public key: %v", err)
+	}
+
+	dir := t.TempDir()
+	files := map[string][]byte{
+		"merchant.pem": pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)}),
+		"gateway.pem":  pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicDER}),
+		"test.env": []byte("ENDPOINT=" + server.URL + "\n" +
+			"APP_ID=cli-test-app\n" +
+			"MERCHANT_NO=M-CLI\n" +
+			"STORE_NO=S-CLI\n" +
+			"APP_RSA_PRIVATE_KEY_FILE=" + filepath.Join(dir, "merchant.pem") + "\n" +
+			"GATEWAY_RSA_PUBLIC_KEY_FILE=" + filepath.Join(dir, "gateway.pem") + "\n"),
+	}
+	for name, data := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), data, 0o600); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+	}
+	return filepath.Join(dir, "test.env")
+}
+
+// fakeGateway records the form of each request and answers with data
+type fakeGateway struct {
+	mu    sync.Mutex
+	paths []string
+	forms []url.Values
+	data  string
+}
+
+func (g *fakeGateway) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	r.ParseForm()
+	g.mu.Lock()
+	g.paths = append(g.paths, r.URL.Path)
+	g.forms = append(g.forms, r.PostForm)
+	g.mu.Unlock()
+	w.Write([]byte(`{"success":true,"data":` + g.data + `}`))
+}
+
+func TestRunFlags(t *testing.T) {
+	gateway := &fakeGateway{data: `{}`}
+	env := testProfile(t, gateway)
+
+	tests := []struct {
+		name     string
+		args     []string
+		wantCode int
+		wantErr  string
+	}{
+		{name: "no command", args: nil, wantCode: 2, wantErr: "Usage: addpay"},
+		{name: "unknown command", args: []string{"teleport"}, wantCode: 2, wantErr: `unknown command "teleport"`},
+		{name: "unknown global flag", args: []string{"--nope", "checkout"}, wantCode: 2, wantErr: "flag provided but not defined"},
+		{name: "command help", args: []string{"--env", env, "checkout", "-h"}, wantCode: 2, wantErr: "-amount"},
+		{name: "invalid flag value", args: []string{"--env", env, "checkout", "--amount", "ten"}, wantCode: 1, wantErr: "invalid value"},
+		{name: "checkout without amount", args: []string{"--env", env, "checkout"}, wantCode: 1, wantErr: "--amount is required"},
+		{name: "query token without token", args: []string{"--env", env, "query-token"}, wantCode: 1, wantErr: "--token is required"},
+		{name: "query order without order", args: []string{"--env", env, "query-order"}, wantCode: 1, wantErr: "--order-no or --transaction-id is required"},
+		{name: "refund without amount", args: []string{"--env", env, "refund", "--order-no", "ORD-1"}, wantCode: 1, wantErr: "--order-no and --amount are required"},
+		{name: "refund without order", args: []string{"--env", env, "refund", "--amount", "5"}, wantCode: 1, wantErr: "--order-no and --amount are required"},
+		{name: "capture without order", args: []string{"--env", env, "capture"}, wantCode: 1, wantErr: "--order-no is required"},
+		{name: "missing profile", args: []string{"--env", filepath.Join(t.TempDir(), "missing.env"), "query-token", "--token", "tok"}, wantCode: 1, wantErr: "failed to read profile"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var stdout, stderr bytes.Buffer
+			if code := run(tt.args, &stdout, &stderr); code != tt.wantCode {
+				t.Errorf("run() = %d, want %d; stderr = %s", code, tt.wantCode, stderr.String())
+			}
+			if !strings.Contains(stderr.String(), tt.wantErr) {
+				t.Errorf("stderr = %q, want it to contain %q", stderr.String(), tt.wantErr)
+			}
+			if stdout.Len() != 0 {
+				t.Errorf("stdout = %q, want nothing", stdout.String())
+			}
+		})
+	}
+
+	if len(gateway.paths) != 0 {
+		t.Errorf("gateway called for invalid invocations: %v", gateway.paths)
+	}
+}
+
+func TestRunJSONOutput(t *testing.T) {
+	tests := []struct {
+		name     string
+		args     []string
+		data     string
+		wantPath string
+		wantForm map[string]string
+		want     map[string]string
+	}{
+		{
+			name:     "checkout",
+			args:     []string{"checkout", "--order-no", "ORD-1", "--amount", "99.5", "--return-url", "https://shop.example/done"},
+			data:     `{"pay_url":"https://pay.example/ORD-1"}`,
+			wantPath: "/checkout",
+			wantForm: map[string]string{"merchant_no": "M-CLI", "store_no": "S-CLI", "merchant_order_no": "ORD-1", "order_amount": "99.5", "price_currency": "ZAR"},
+			want:     map[string]string{"merchant_order_no": "ORD-1", "pay_url": "https://pay.example/ORD-1"},
+		},
+		{
+			name:     "query order",
+			args:     []string{"query-order", "--order-no", "ORD-2", "--merchant-no", "M-OTHER"},
+			data:     `{"merchant_order_no":"ORD-2","order_status":"PAID"}`,
+			wantPath: "/query-order",
+			wantForm: map[string]string{"merchant_no": "M-OTHER", "merchant_order_no": "ORD-2"},
+			want:     map[string]string{"merchant_order_no": "ORD-2", "order_status": "PAID"},
+		},
+		{
+			name:     "refund",
+			args:     []string{"refund", "--order-no", "ORD-3", "--amount", "10", "--refund-no", "R-3"},
+			data:     `{"refund_no":"R-3","refund_status":"PROCESSING"}`,
+			wantPath: "/refund",
+			wantForm: map[string]string{"merchant_order_no": "ORD-3", "refund_no": "R-3", "refund_amount": "10"},
+			want:     map[string]string{"refund_no": "R-3", "refund_status": "PROCESSING"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gateway := &fakeGateway{data: tt.data}
+			env := testProfile(t, gateway)
+
+			var stdout, stderr bytes.Buffer
+			if code := run(append([]string{"--env", env}, tt.args...), &stdout, &stderr); code != 0 {
+				t.Fatalf("run() = %d; stderr = %s", code, stderr.String())
+			}
+
+			if len(gateway.paths) != 1 || !strings.HasSuffix(gateway.paths[0], tt.wantPath) {
+				t.Fatalf("gateway paths = %v, want one call to %s", gateway.paths, tt.wantPath)
+			}
+			for name, want := range tt.wantForm {
+				if got := gateway.forms[0].Get(name); got != want {
+					t.Errorf("param %s = %q, want %q", name, got, want)
+				}
+			}
+
+			var output map[string]interface{}
+			if err := json.Unmarshal(stdout.Bytes(), &output); err != nil {
+				t.Fatalf("stdout is not JSON: %v\n%s", err, stdout.String())
+			}
+			for name, want := range tt.want {
+				if output[name] != want {
+					t.Errorf("output %s = %v, want %q", name, output[name], want)
+				}
+			}
+		})
+	}
+}
+
+func TestRunGeneratedNumbers(t *testing.T) {
+	gateway := &fakeGateway{data: `{}`}
+	env := testProfile(t, gateway)
+
+	var stdout, stderr bytes.Buffer
+	if code := run([]string{"--env", env, "refund", "--order-no", "ORD-4", "--amount", "1"}, &stdout, &stderr); code != 0 {
+		t.Fatalf("refund run() = %d; stderr = %s", code, stderr.String())
+	}
+	if code := run([]string{"--env", env, "checkout", "--amount", "1"}, &stdout, &stderr); code != 0 {
+		t.Fatalf("checkout run() = %d; stderr = %s", code, stderr.String())
+	}
+
+	if refundNo := gateway.forms[0].Get("refund_no"); !strings.HasPrefix(refundNo, "REFUND-") {
+		t.Errorf("generated refund_no = %q, want a REFUND- number", refundNo)
+	}
+	if orderNo := gateway.forms[1].Get("merchant_order_no"); !strings.HasPrefix(orderNo, "CLI-") {
+		t.Errorf("generated merchant_order_no = %q, want a CLI- number", orderNo)
+	}
+}
+
+func TestRunSignParamsFile(t *testing.T) {
+	env := testProfile(t, &fakeGateway{data: `{}`})
+	dir := filepath.Dir(env)
+
+	paramsPath := filepath.Join(dir, "params.json")
+	params := `{"merchant_order_no":"ORD-5","order_amount":100,"timestamp":1760000000}`
+	if err := os.WriteFile(paramsPath, []byte(params), 0o600); err != nil {
+		t.Fatalf("Failed to write params: %v", err)
+	}
+
+	var stdout, stderr bytes.Buffer
+	if code := run([]string{"--env", env, "sign", "--params", paramsPath}, &stdout, &stderr); code != 0 {
+		t.Fatalf("run() = %d; stderr = %s", code, stderr.String())
+	}
+	var output map[string]string
+	if err := json.Unmarshal(stdout.Bytes(), &output); err != nil {
+		t.Fatalf("stdout is not JSON: %v\n%s", err, stdout.String())
+	}
+
+	wantString := "merchant_order_no=ORD-5&order_amount=100&timestamp=1760000000"
+	if output["sign_string"] != wantString {
+		t.Errorf("sign_string = %q, want %q", output["sign_string"], wantString)
+	}
+
+	privateKey, _ := os.ReadFile(filepath.Join(dir, "merchant.pem"))
+	publicKey, _ := os.ReadFile(filepath.Join(dir, "gateway.pem"))
+	rsaAuth, err := auth.NewRSAAuth(privateKey, publicKey)
+	if err != nil {
+		t.Fatalf("NewRSAAuth() unexpected error = %v", err)
+	}
+	want, _ := rsaAuth.Sign([]byte(wantString))
+	if output["sign"] != want {
+		t.Errorf("sign = %q, want the signature of %q", output["sign"], wantString)
+	}
+}
@@ -0,0 +1,402 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"time"
+
+	"github.com/mdwt/addpay-go/orderno"
+	"github.com/mdwt/addpay-go/types"
+)
+
+func init() {
+	register(command{name: "checkout", summary: "create a hosted checkout and print the pay URL", run: runCheckout})
+	register(command{name: "query-token", summary: "query a card token", run: runQueryToken})
+	register(command{name: "tokenized-pay", summary: "charge a card token", run: runTokenizedPay})
+	register(command{name: "debit-check", summary: "create a debit check mandate", run: runDebitCheck})
+	register(command{name: "query-order", summary: "query the status of an order", run: runQueryOrder})
+	register(command{name: "refund", summary: "refund all or part of an order", run: runRefund})
+	register(command{name: "authorize", summary: "hold funds on a card token", run: runAuthorize})
+	register(command{name: "capture", summary: "capture part or all of an authorization", run: runCapture})
+	register(command{name: "void", summary: "release an authorization", run: runVoid})
+}
+
+// storeFlags holds the merchant and store flags shared by payment commands
+type storeFlags struct {
+	merchantNo string
+	storeNo    string
+	orderNo    string
+}
+
+// newNumber generates a merchant order, refund or capture number for ad hoc
+// CLI requests
+func newNumber(prefix string) (string, error) {
+	generator, err := orderno.NewGenerator(orderno.Config{Prefix: prefix})
+	if err != nil {
+		return "", fmt.Errorf("failed to create %s number generator: %w", prefix, err)
+	}
+	return generator.Next(), nil
+}
+
+func runCheckout(a *app, args []string) error {
+	fs := a.newFlagSet("checkout")
+	var store storeFlags
+	if err := addStoreFlags(fs, &store); err != nil {
+		return err
+	}
+	amount := fs.Float64("amount", 0, "order amount")
+	currency := fs.String("currency", "ZAR", "price currency")
+	expires := fs.Duration("expires", time.Hour, "time until the checkout expires")
+	notifyURL := fs.String("notify-url", "", "webhook notification URL")
+	returnURL := fs.String("return-url", "", "customer return URL")
+	description := fs.String("description", "", "order description")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *amount <= 0 {
+		return fmt.Errorf("--amount is required")
+	}
+
+	c, err := a.profile.client()
+	if err != nil {
+		return err
+	}
+
+	response, err := c.HostedCheckout(context.Background(), types.CheckoutRequest{
+		MerchantNo:      store.merchantNo,
+		StoreNo:         store.storeNo,
+		MerchantOrderNo: store.orderNo,
+		PriceCurrency:   *currency,
+		OrderAmount:     *amount,
+		ExpiresIn:       *expires,
+		NotifyURL:       *notifyURL,
+		ReturnURL:       *returnURL,
+		Description:     *description,
+	})
+	if err != nil {
+		return err
+	}
+	return a.printJSON(struct {
+		MerchantOrderNo string `json:"merchant_order_no"`
+		types.CheckoutResponse
+	}{store.orderNo, response})
+}
+
+func runQueryToken(a *app, args []string) error {
+	fs := a.newFlagSet("query-token")
+	token := fs.String("token", "", "card token")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *token == "" {
+		return fmt.Errorf("--token is required")
+	}
+
+	c, err := a.profile.client()
+	if err != nil {
+		return err
+	}
+
+	response, err := c.QueryToken(context.Background(), types.QueryTokenRequest{Token: *token})
+	if err != nil {
+		return err
+	}
+	return a.printJSON(response)
+}
+
+func runTokenizedPay(a *app, args []string) error {
+	fs := a.newFlagSet("tokenized-pay")
+	var store storeFlags
+	if err := addStoreFlags(fs, &store); err != nil {
+		return err
+	}
+	token := fs.String("token", "", "card token")
+	amount := fs.Float64("amount", 0, "order amount")
+	currency := fs.String("currency", "ZAR", "price currency")
+	notifyURL := fs.String("notify-url", "", "webhook notification URL")
+	description := fs.String("description", "", "payment description")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *token == "" || *amount <= 0 {
+		return fmt.Errorf("--token and --amount are required")
+	}
+
+	c, err := a.profile.client()
+	if err != nil {
+		return err
+	}
+
+	response, err := c.TokenizedPay(context.Background(), types.TokenizedPayRequest{
+		MerchantNo:      store.merchantNo,
+		StoreNo:         store.storeNo,
+		MerchantOrderNo: store.orderNo,
+		Token:           *token,
+		PriceCurrency:   *currency,
+		OrderAmount:     *amount,
+		NotifyURL:       *notifyURL,
+		Description:     *description,
+	})
+	if err != nil {
+		return err
+	}
+	return a.printJSON(response)
+}
+
+func runDebitCheck(a *app, args []string) error {
+	fs := a.newFlagSet("debit-check")
+	var store storeFlags
+	if err := addStoreFlags(fs, &store); err != nil {
+		return err
+	}
+	accountNumber := fs.String("account-number", "", "bank account number")
+	bankCode := fs.String("bank-code", "", "bank code")
+	amount := fs.Float64("amount", 0, "debit amount")
+	currency := fs.String("currency", "ZAR", "currency")
+	notifyURL := fs.String("notify-url", "", "webhook notification URL")
+	description := fs.String("description", "", "mandate description")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *accountNumber == "" || *bankCode == "" || *amount <= 0 {
+		return fmt.Errorf("--account-number, --bank-code and --amount are required")
+	}
+
+	c, err := a.profile.client()
+	if err != nil {
+		return err
+	}
+
+	response, err := c.DebitCheck(context.Background(), types.DebitCheckRequest{
+		MerchantNo:      store.merchantNo,
+		StoreNo:         store.storeNo,
+		MerchantOrderNo: store.orderNo,
+		AccountNumber:   *accountNumber,
+		BankCode:        *bankCode,
+		Amount:          *amount,
+		Currency:        *currency,
+		NotifyURL:       *notifyURL,
+		Description:     *description,
+	})
+	if err != nil {
+		return err
+	}
+	return a.printJSON(response)
+}
+
+func runQueryOrder(a *app, args []string) error {
+	fs := a.newFlagSet("query-order")
+	var store storeFlags
+	if err := addStoreFlags(fs, &store); err != nil {
+		return err
+	}
+	transactionID := fs.String("transaction-id", "", "gateway transaction ID")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if !flagSet(fs, "order-no") && *transactionID == "" {
+		return fmt.Errorf("--order-no or --transaction-id is required")
+	}
+
+	c, err := a.profile.client()
+	if err != nil {
+		return err
+	}
+
+	req := types.QueryOrderRequest{
+		MerchantNo:    store.merchantNo,
+		StoreNo:       store.storeNo,
+		TransactionID: *transactionID,
+	}
+	if flagSet(fs, "order-no") {
+		req.MerchantOrderNo = store.orderNo
+	}
+
+	response, err := c.QueryOrder(context.Background(), req)
+	if err != nil {
+		return err
+	}
+	return a.printJSON(response)
+}
+
+func runRefund(a *app, args []string) error {
+	fs := a.newFlagSet("refund")
+	var store storeFlags
+	if err := addStoreFlags(fs, &store); err != nil {
+		return err
+	}
+	refundNo := fs.String("refund-no", "", "merchant refund number (default generated)")
+	amount := fs.Float64("amount", 0, "refund amount")
+	reason := fs.String("reason", "", "refund reason")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if !flagSet(fs, "order-no") || *amount <= 0 {
+		return fmt.Errorf("--order-no and --amount are required")
+	}
+	if *refundNo == "" {
+		number, err := newNumber("REFUND-")
+		if err != nil {
+			return err
+		}
+		*refundNo = number
+	}
+
+	c, err := a.profile.client()
+	if err != nil {
+		return err
+	}
+
+	response, err := c.Refund(context.Background(), types.RefundRequest{
+		MerchantNo:      store.merchantNo,
+		StoreNo:         store.storeNo,
+		MerchantOrderNo: store.orderNo,
+		RefundNo:        *refundNo,
+		RefundAmount:    *amount,
+		Reason:          *reason,
+	})
+	if err != nil {
+		return err
+	}
+	return a.printJSON(response)
+}
+
+func runAuthorize(a *app, args []string) error {
+	fs := a.newFlagSet("authorize")
+	var store storeFlags
+	if err := addStoreFlags(fs, &store); err != nil {
+		return err
+	}
+	token := fs.String("token", "", "card token")
+	amount := fs.Float64("amount", 0, "amount to hold")
+	currency := fs.String("currency", "ZAR", "price currency")
+	expires := fs.Duration("expires", 0, "time until the hold lapses (default gateway setting)")
+	notifyURL := fs.String("notify-url", "", "webhook notification URL")
+	description := fs.String("description", "", "payment description")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *token == "" || *amount <= 0 {
+		return fmt.Errorf("--token and --amount are required")
+	}
+
+	c, err := a.profile.client()
+	if err != nil {
+		return err
+	}
+
+	req := types.AuthorizeRequest{
+		MerchantNo:      store.merchantNo,
+		StoreNo:         store.storeNo,
+		MerchantOrderNo: store.orderNo,
+		Token:           *token,
+		PriceCurrency:   *currency,
+		OrderAmount:     *amount,
+		ExpiresIn:       *expires,
+		NotifyURL:       *notifyURL,
+		Description:     *description,
+	}
+	response, err := c.Authorize(context.Background(), req)
+	if err != nil {
+		return err
+	}
+	return a.printJSON(response)
+}
+
+func runCapture(a *app, args []string) error {
+	fs := a.newFlagSet("capture")
+	var store storeFlags
+	if err := addStoreFlags(fs, &store); err != nil {
+		return err
+	}
+	captureNo := fs.String("capture-no", "", "merchant capture number (default generated)")
+	amount := fs.Float64("amount", 0, "amount to capture (default the full remaining amount)")
+	final := fs.Bool("final", false, "release any remaining amount after this capture")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if !flagSet(fs, "order-no") {
+		return fmt.Errorf("--order-no is required")
+	}
+	if *captureNo == "" {
+		number, err := newNumber("CAPTURE-")
+		if err != nil {
+			return err
+		}
+		*captureNo = number
+	}
+
+	c, err := a.profile.client()
+	if err != nil {
+		return err
+	}
+
+	response, err := c.Capture(context.Background(), types.CaptureRequest{
+		MerchantNo:      store.merchantNo,
+		StoreNo:         store.storeNo,
+		MerchantOrderNo: store.orderNo,
+		CaptureNo:       *captureNo,
+		CaptureAmount:   *amount,
+		FinalCapture:    *final,
+	})
+	if err != nil {
+		return err
+	}
+	return a.printJSON(response)
+}
+
+func runVoid(a *app, args []string) error {
+	fs := a.newFlagSet("void")
+	var store storeFlags
+	if err := addStoreFlags(fs, &store); err != nil {
+		return err
+	}
+	reason := fs.String("reason", "", "void reason")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if !flagSet(fs, "order-no") {
+		return fmt.Errorf("--order-no is required")
+	}
+
+	c, err := a.profile.client()
+	if err != nil {
+		return err
+	}
+
+	response, err := c.Void(context.Background(), types.VoidRequest{
+		MerchantNo:      store.merchantNo,
+		StoreNo:         store.storeNo,
+		MerchantOrderNo: store.orderNo,
+		Reason:          *reason,
+	})
+	if err != nil {
+		return err
+	}
+	return a.printJSON(response)
+}
+
+// addStoreFlags registers the merchant, store and order number flags.
+// Empty merchant and store numbers fall back to the profile defaults.
+func addStoreFlags(fs *flag.FlagSet, store *storeFlags) error {
+	orderNo, err := newNumber("CLI-")
+	if err != nil {
+		return err
+	}
+	fs.StringVar(&store.merchantNo, "merchant-no", "", "merchant number (default from profile)")
+	fs.StringVar(&store.storeNo, "store-no", "", "store number (default from profile)")
+	fs.StringVar(&store.orderNo, "order-no", orderNo, "merchant order number")
+	return nil
+}
+
+// flagSet reports whether a flag was given explicitly on the command line
+func flagSet(fs *flag.FlagSet, name string) bool {
+	found := false
+	fs.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			found = true
+		}
+	})
+	return found
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+
+	"github.com/joho/godotenv"
+	"github.com/mdwt/addpay-go/auth"
+	"github.com/mdwt/addpay-go/client"
+	"github.com/mdwt/addpay-go/config"
+	"github.com/mdwt/addpay-go/logger"
+	"github.com/mdwt/addpay-go/types"
+)
+
+// profile resolves the configuration selected by the global flags
+type profile struct {
+	envName    string
+	configPath string
+	verbose    bool
+}
+
+// config loads the configuration from --config, --env or the process environment
+func (p profile) config() (types.Config, error) {
+	var cfg types.Config
+	var err error
+
+	if p.configPath != "" {
+		cfg, err = config.FromFile(p.configPath)
+	} else {
+		lookup, lookupErr := p.lookup()
+		if lookupErr != nil {
+			return types.Config{}, lookupErr
+		}
+		cfg, err = config.FromLookup(lookup)
+	}
+	if err != nil {
+		return types.Config{}, err
+	}
+
+	// A profile named after an environment selects its preset gateway URL
+	if cfg.GatewayURL == "" && cfg.Environment == "" {
+		if _, ok := types.Environment(p.envName).GatewayURL(); ok {
+			cfg.Environment = types.Environment(p.envName)
+		}
+	}
+
+	// Logs go to stderr so they never mix with the JSON written to stdout
+	if p.verbose {
+		cfg.Logger = logger.New(logger.Options{Level: slog.LevelDebug, Text: true})
+	} else {
+		cfg.Logger = logger.NewNoOpLogger()
+	}
+	return cfg, nil
+}
+
+// lookup resolves variables from the --env profile, falling back to the
+// process environment
+func (p profile) lookup() (config.LookupFunc, error) {
+	if p.envName == "" {
+		return os.LookupEnv, nil
+	}
+
+	path := p.envPath()
+	vars, err := godotenv.Read(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read profile %s: %w", path, err)
+	}
+	return func(name string) (string, bool) {
+		if value, ok := vars[name]; ok {
+			return value, true
+		}
+		return os.LookupEnv(name)
+	}, nil
+}
+
+// client creates an API client from the profile configuration
+func (p profile) client() (client.Client, error) {
+	cfg, err := p.config()
+	if err != nil {
+		return client.Client{}, err
+	}
+	return client.New(cfg)
+}
+
+// envPath returns the .env file for the profile: the value itself if it
+// names an existing file, otherwise ~/.addpay/<name>.env
+func (p profile) envPath() string {
+	if _, err := os.Stat(p.envName); err == nil {
+		return p.envName
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return p.envName
+	}
+	return filepath.Join(home, ".addpay", p.envName+".env")
+}
+
+// merchantPassphrase returns the configured private key passphrase source, if any
+func merchantPassphrase(cfg types.Config) auth.PassphraseFunc {
+	if cfg.MerchantKeyPassphraseFunc != nil {
+		return cfg.MerchantKeyPassphraseFunc
+	}
+	if len(cfg.MerchantKeyPassphrase) > 0 {
+		return func() ([]byte, error) { return cfg.MerchantKeyPassphrase, nil }
+	}
+	return nil
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/mdwt/addpay-go/qrcode"
+	"github.com/mdwt/addpay-go/types"
+)
+
+func init() {
+	register(command{name: "qr", summary: "create an in-store QR order and render the code", run: runQR})
+	register(command{name: "cancel-order", summary: "cancel an unpaid order", run: runCancelOrder})
+}
+
+func runQR(a *app, args []string) error {
+	fs := a.newFlagSet("qr")
+	var store storeFlags
+	if err := addStoreFlags(fs, &store); err != nil {
+		return err
+	}
+	amount := fs.Float64("amount", 0, "order amount")
+	currency := fs.String("currency", "ZAR", "price currency")
+	expires := fs.Duration("expires", 15*time.Minute, "time until the QR code expires")
+	notifyURL := fs.String("notify-url", "", "webhook notification URL")
+	terminal := fs.String("terminal-no", "", "POS terminal number")
+	out := fs.String("out", "", "write the QR code to this .png or .svg file")
+	scale := fs.Int("scale", 8, "pixels per QR module")
+	wait := fs.Duration("wait", 0, "poll until the order is paid or this much time has passed")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *amount <= 0 {
+		return fmt.Errorf("--amount is required")
+	}
+
+	c, err := a.profile.client()
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	order, err := c.CreateQROrder(ctx, types.QROrderRequest{
+		MerchantNo:      store.merchantNo,
+		StoreNo:         store.storeNo,
+		MerchantOrderNo: store.orderNo,
+		PriceCurrency:   *currency,
+		OrderAmount:     *amount,
+		ExpiresIn:       *expires,
+		NotifyURL:       *notifyURL,
+		TerminalNo:      *terminal,
+	})
+	if err != nil {
+		return err
+	}
+
+	if *out != "" {
+		code, err := qrcode.Encode([]byte(order.QRCode), qrcode.Medium)
+		if err != nil {
+			return err
+		}
+		var data []byte
+		switch strings.ToLower(filepath.Ext(*out)) {
+		case ".png":
+			data, err = code.PNG(*scale)
+		case ".svg":
+			data = code.SVG(*scale)
+		default:
+			return fmt.Errorf("unsupported QR output %q, want .png or .svg", *out)
+		}
+		if err != nil {
+			return err
+		}
+		if err := os.WriteFile(*out, data, 0o644); err != nil {
+			return fmt.Errorf("failed to write QR code: %w", err)
+		}
+	}
+	if err := a.printJSON(order); err != nil {
+		return err
+	}
+
+	if *wait <= 0 {
+		return nil
+	}
+	waitCtx, cancel := context.WithTimeout(ctx, *wait)
+	defer cancel()
+	result, err := c.WaitForPayment(waitCtx, types.QueryOrderRequest{
+		MerchantNo:      store.merchantNo,
+		StoreNo:         store.storeNo,
+		MerchantOrderNo: store.orderNo,
+	}, 0)
+	if err != nil {
+		return err
+	}
+	return a.printJSON(result)
+}
+
+func runCancelOrder(a *app, args []string) error {
+	fs := a.newFlagSet("cancel-order")
+	var store storeFlags
+	if err := addStoreFlags(fs, &store); err != nil {
+		return err
+	}
+	reason := fs.String("reason", "", "cancellation reason")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if !flagSet(fs, "order-no") {
+		return fmt.Errorf("--order-no is required")
+	}
+
+	c, err := a.profile.client()
+	if err != nil {
+		return err
+	}
+
+	response, err := c.CancelOrder(context.Background(), types.CancelOrderRequest{
+		MerchantNo:      store.merchantNo,
+		StoreNo:         store.storeNo,
+		MerchantOrderNo: store.orderNo,
+		Reason:          *reason,
+	})
+	if err != nil {
+		return err
+	}
+	return a.printJSON(response)
+}
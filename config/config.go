@@ -0,0 +1,171 @@
+// Package config builds a types.Config from environment variables,
+// JSON or YAML files, and pluggable secret stores.
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/mdwt/addpay-go/types"
+)
+
+// Environment variable names read by FromEnv (matching .env.example)
+const (
+	EnvAppID                = "APP_ID"
+	EnvEnvironment          = "ENVIRONMENT"
+	EnvEndpoint             = "ENDPOINT"
+	EnvFailoverEndpoints    = "FAILOVER_ENDPOINTS"
+	EnvMerchantNo           = "MERCHANT_NO"
+	EnvStoreNo              = "STORE_NO"
+	EnvTimeout              = "TIMEOUT"
+	EnvGatewayPublicKey     = "GATEWAY_RSA_PUBLIC_KEY"
+	EnvGatewayPublicKeyFile = "GATEWAY_RSA_PUBLIC_KEY_FILE"
+	EnvPrivateKeyPKCS8      = "APP_RSA_PRIVATE_KEY_PKCS8"
+	EnvPrivateKeyPKCS1      = "APP_RSA_PRIVATE_KEY_PKCS1"
+	EnvPrivateKeyFile       = "APP_RSA_PRIVATE_KEY_FILE"
+	EnvPrivateKeyPassphrase = "APP_RSA_PRIVATE_KEY_PASSPHRASE"
+)
+
+// LookupFunc retrieves a named value, reporting whether it was present.
+// os.LookupEnv satisfies it; secret store clients can be adapted to it.
+type LookupFunc func(name string) (string, bool)
+
+// File is the on-disk configuration layout shared by JSON and YAML files
+type File struct {
+	AppID                  string   `json:"app_id"`
+	Environment            string   `json:"environment"`
+	GatewayURL             string   `json:"gateway_url"`
+	FailoverURLs           []string `json:"failover_urls"`
+	MerchantNo             string   `json:"merchant_no"`
+	StoreNo                string   `json:"store_no"`
+	Timeout                string   `json:"timeout"`
+	MerchantPrivateKey     string   `json:"merchant_private_key"`
+	MerchantPrivateKeyFile string   `json:"merchant_private_key_file"`
+	MerchantKeyPassphrase  string   `json:"merchant_private_key_passphrase"`
+	GatewayPublicKey       string   `json:"gateway_public_key"`
+	GatewayPublicKeyFile   string   `json:"gateway_public_key_file"`
+}
+
+// FromEnv builds a configuration from process environment variables
+func FromEnv() (types.Config, error) {
+	return FromLookup(os.LookupEnv)
+}
+
+// FromLookup builds a configuration using the variable names of FromEnv,
+// resolving each value through lookup
+func FromLookup(lookup LookupFunc) (types.Config, error) {
+	get := func(name string) string {
+		value, _ := lookup(name)
+		return strings.TrimSpace(value)
+	}
+
+	file := File{
+		AppID:                  get(EnvAppID),
+		Environment:            get(EnvEnvironment),
+		GatewayURL:             get(EnvEndpoint),
+		MerchantNo:             get(EnvMerchantNo),
+		StoreNo:                get(EnvStoreNo),
+		Timeout:                get(EnvTimeout),
+		MerchantPrivateKey:     get(EnvPrivateKeyPKCS8),
+		MerchantPrivateKeyFile: get(EnvPrivateKeyFile),
+		GatewayPublicKey:       get(EnvGatewayPublicKey),
+		GatewayPublicKeyFile:   get(EnvGatewayPublicKeyFile),
+	}
+	if file.MerchantPrivateKey == "" {
+		file.MerchantPrivateKey = get(EnvPrivateKeyPKCS1)
+	}
+	// Passphrases are used verbatim, surrounding whitespace included
+	file.MerchantKeyPassphrase, _ = lookup(EnvPrivateKeyPassphrase)
+	if failover := get(EnvFailoverEndpoints); failover != "" {
+		for _, endpoint := range strings.Split(failover, ",") {
+			if endpoint = strings.TrimSpace(endpoint); endpoint != "" {
+				file.FailoverURLs = append(file.FailoverURLs, endpoint)
+			}
+		}
+	}
+
+	return file.Config("")
+}
+
+// FromFile builds a configuration from a JSON (.json) or YAML (.yaml, .yml) file.
+// Relative key file paths are resolved against the directory of the file.
+func FromFile(path string) (types.Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return types.Config{}, fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	var file File
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".json":
+		file, err = parseJSON(data)
+	case ".yaml", ".yml":
+		file, err = parseYAML(data)
+	default:
+		return types.Config{}, fmt.Errorf("unsupported config file extension: %q", ext)
+	}
+	if err != nil {
+		return types.Config{}, fmt.Errorf("failed to parse config file %s: %w", path, err)
+	}
+
+	return file.Config(filepath.Dir(path))
+}
+
+// Config converts the file layout into a types.Config, reading key files
+// relative to baseDir. Inline keys take precedence over key files.
+func (f File) Config(baseDir string) (types.Config, error) {
+	config := types.Config{
+		AppID:        f.AppID,
+		Environment:  types.Environment(f.Environment),
+		GatewayURL:   f.GatewayURL,
+		FailoverURLs: f.FailoverURLs,
+		MerchantNo:   f.MerchantNo,
+		StoreNo:      f.StoreNo,
+	}
+
+	if f.Timeout != "" {
+		timeout, err := time.ParseDuration(f.Timeout)
+		if err != nil {
+			return types.Config{}, fmt.Errorf("invalid timeout %q: %w", f.Timeout, err)
+		}
+		config.Timeout = timeout
+	}
+
+	privateKey, err := loadKey(f.MerchantPrivateKey, f.MerchantPrivateKeyFile, baseDir)
+	if err != nil {
+		return types.Config{}, fmt.Errorf("failed to load merchant private key: %w", err)
+	}
+	config.MerchantPrivateKey = privateKey
+	if f.MerchantKeyPassphrase != "" {
+		config.MerchantKeyPassphrase = []byte(f.MerchantKeyPassphrase)
+	}
+
+	publicKey, err := loadKey(f.GatewayPublicKey, f.GatewayPublicKeyFile, baseDir)
+	if err != nil {
+		return types.Config{}, fmt.Errorf("failed to load gateway public key: %w", err)
+	}
+	config.GatewayPublicKey = publicKey
+
+	return config, nil
+}
+
+// loadKey returns the inline key if set, otherwise the contents of the key file
+func loadKey(inline, path, baseDir string) ([]byte, error) {
+	if inline != "" {
+		return []byte(inline), nil
+	}
+	if path == "" {
+		return nil, nil
+	}
+	if !filepath.IsAbs(path) && baseDir != "" {
+		path = filepath.Join(baseDir, path)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return data, nil
+}
@@ -0,0 +1,130 @@
+package config
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// parseJSON decodes a JSON configuration file
+func parseJSON(data []byte) (File, error) {
+	var file File
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&file); err != nil {
+		return File{}, err
+	}
+	return file, nil
+}
+
+// parseYAML decodes the subset of YAML used by configuration files: top-level
+// "key: value" pairs, quoted scalars, "|" block scalars for PEM keys and
+// "- item" sequences. The result is mapped onto File through its JSON tags.
+func parseYAML(data []byte) (File, error) {
+	values := make(map[string]interface{})
+
+	var lines []string
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		lines = append(lines, strings.TrimRight(scanner.Text(), " \t\r"))
+	}
+	if err := scanner.Err(); err != nil {
+		return File{}, err
+	}
+
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") || trimmed == "---" {
+			continue
+		}
+		if line[0] == ' ' || line[0] == '\t' {
+			return File{}, fmt.Errorf("line %d: unexpected indentation", i+1)
+		}
+
+		key, rest, ok := strings.Cut(line, ":")
+		if !ok {
+			return File{}, fmt.Errorf("line %d: expected \"key: value\"", i+1)
+		}
+		key = strings.TrimSpace(key)
+		rest = strings.TrimSpace(rest)
+
+		switch {
+		case rest == "|" || rest == "|-":
+			// Block scalar: collect the following indented lines
+			var block []string
+			for i+1 < len(lines) && (lines[i+1] == "" || isIndented(lines[i+1])) {
+				i++
+				block = append(block, strings.TrimSpace(lines[i]))
+			}
+			text := strings.TrimRight(strings.Join(block, "\n"), "\n")
+			if rest == "|" {
+				text += "\n"
+			}
+			values[key] = text
+		case rest == "":
+			// Sequence: collect the following "- item" lines
+			var items []string
+			for i+1 < len(lines) && isIndented(lines[i+1]) {
+				i++
+				item := strings.TrimSpace(lines[i])
+				if strings.HasPrefix(item, "#") {
+					continue
+				}
+				if !strings.HasPrefix(item, "- ") {
+					return File{}, fmt.Errorf("line %d: expected sequence item", i+1)
+				}
+				value, err := parseYAMLScalar(strings.TrimPrefix(item, "- "))
+				if err != nil {
+					return File{}, fmt.Errorf("line %d: %w", i+1, err)
+				}
+				items = append(items, value)
+			}
+			values[key] = items
+		default:
+			value, err := parseYAMLScalar(rest)
+			if err != nil {
+				return File{}, fmt.Errorf("line %d: %w", i+1, err)
+			}
+			values[key] = value
+		}
+	}
+
+	// Re-marshal through JSON so YAML keys follow the File JSON tags
+	jsonBytes, err := json.Marshal(values)
+	if err != nil {
+		return File{}, err
+	}
+	return parseJSON(jsonBytes)
+}
+
+// parseYAMLScalar unquotes a scalar value and strips trailing comments
+func parseYAMLScalar(value string) (string, error) {
+	value = strings.TrimSpace(value)
+	switch {
+	case strings.HasPrefix(value, `"`):
+		unquoted, err := strconv.Unquote(value)
+		if err != nil {
+			return "", fmt.Errorf("invalid quoted value %s", value)
+		}
+		return unquoted, nil
+	case strings.HasPrefix(value, "'"):
+		if len(value) < 2 || !strings.HasSuffix(value, "'") {
+			return "", fmt.Errorf("invalid quoted value %s", value)
+		}
+		return strings.ReplaceAll(value[1:len(value)-1], "''", "'"), nil
+	}
+
+	if idx := strings.Index(value, " #"); idx >= 0 {
+		value = strings.TrimSpace(value[:idx])
+	}
+	return value, nil
+}
+
+// isIndented reports whether a line belongs to the preceding key
+func isIndented(line string) bool {
+	return strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")
+}
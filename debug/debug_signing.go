@@ -5,28 +5,15 @@ import (
 	"fmt"
 	"log"
 	"os"
-	"strings"
 	"time"
 
 	"github.com/joho/godotenv"
 	"github.com/mdwt/addpay-go"
+	"github.com/mdwt/addpay-go/diagnostics"
+	"github.com/mdwt/addpay-go/orderno"
 	"github.com/mdwt/addpay-go/types"
 )
 
-func min(a, b int) int {
-	if a < b {
-		return a
-	}
-	return b
-}
-
-func max(a, b int) int {
-	if a > b {
-		return a
-	}
-	return b
-}
-
 func main() {
 	// Load environment variables
 	err := godotenv.Load("../.env")
@@ -35,13 +22,14 @@ func main() {
 	}
 
 	// Check environment variables
-	if os.Getenv("APP_ID") == "" || os.Getenv("ENDPOINT") == "" ||
+	if os.Getenv("APP_ID") == "" || (os.Getenv("ENDPOINT") == "" && os.Getenv("ENVIRONMENT") == "") ||
 		os.Getenv("APP_RSA_PRIVATE_KEY_PKCS1") == "" || os.Getenv("GATEWAY_RSA_PUBLIC_KEY") == "" {
 		log.Fatal("Required environment variables not set")
 	}
 
 	fmt.Println("Environment variables found:")
 	fmt.Printf("APP_ID: %s\n", os.Getenv("APP_ID"))
+	fmt.Printf("ENVIRONMENT: %s\n", os.Getenv("ENVIRONMENT"))
 	fmt.Printf("ENDPOINT: %s\n", os.Getenv("ENDPOINT"))
 	fmt.Printf("MERCHANT_NO: %s\n", os.Getenv("MERCHANT_NO"))
 	fmt.Printf("STORE_NO: %s\n", os.Getenv("STORE_NO"))
@@ -50,22 +38,15 @@ func main() {
 	privateKey := os.Getenv("APP_RSA_PRIVATE_KEY_PKCS1")
 	publicKey := os.Getenv("GATEWAY_RSA_PUBLIC_KEY")
 
-	fmt.Printf("Private key length: %d\n", len(privateKey))
-	fmt.Printf("Public key length: %d\n", len(publicKey))
-	fmt.Printf("Private key first 100 chars: %s...\n", privateKey[:min(100, len(privateKey))])
-	fmt.Printf("Private key last 100 chars: ...%s\n", privateKey[max(0, len(privateKey)-100):])
-
-	// Create client configuration with detailed logging
-	// Try HTTPS endpoint
-	endpoint := os.Getenv("ENDPOINT")
-	if strings.HasPrefix(endpoint, "http://") {
-		endpoint = strings.Replace(endpoint, "http://", "https://", 1)
-		fmt.Printf("Trying HTTPS endpoint: %s\n", endpoint)
-	}
+	fmt.Printf("Private key: %+v\n", diagnostics.DetectKeyFormat([]byte(privateKey)))
+	fmt.Printf("Public key: %+v\n", diagnostics.DetectKeyFormat([]byte(publicKey)))
 
+	// Create client configuration with detailed logging. ENDPOINT wins over
+	// the ENVIRONMENT preset, and the client rejects non-HTTPS gateway URLs.
 	config := types.Config{
 		AppID:              os.Getenv("APP_ID"),
-		GatewayURL:         endpoint,
+		Environment:        types.Environment(os.Getenv("ENVIRONMENT")),
+		GatewayURL:         os.Getenv("ENDPOINT"),
 		MerchantPrivateKey: []byte(privateKey),
 		GatewayPublicKey:   []byte(publicKey),
 		Timeout:            30 * time.Second,
@@ -80,15 +61,27 @@ func main() {
 
 	fmt.Println("Client created successfully!")
 
+	// Receive notifications with `addpay listen`, exposed through a tunnel
+	// when the gateway cannot reach localhost
+	notifyURL := os.Getenv("NOTIFY_URL")
+	if notifyURL == "" {
+		notifyURL = "http://127.0.0.1:8787/webhook"
+	}
+
+	orderNumbers, err := orderno.NewGenerator(orderno.Config{Prefix: "DEBUG-"})
+	if err != nil {
+		log.Fatalf("Failed to create order number generator: %v", err)
+	}
+
 	// Create a simple checkout request
 	checkoutReq := types.CheckoutRequest{
 		MerchantNo:      os.Getenv("MERCHANT_NO"),
 		StoreNo:         os.Getenv("STORE_NO"),
-		MerchantOrderNo: "DEBUG-" + time.Now().Format("20060102150405"),
+		MerchantOrderNo: orderNumbers.Next(),
 		PriceCurrency:   "ZAR",
 		OrderAmount:     1.00, // Small amount for testing
-		Expires:         time.Now().Add(1 * time.Hour).Unix(),
-		NotifyURL:       "https://httpbin.org/post", // Test webhook URL
+		ExpiresIn:       time.Hour,
+		NotifyURL:       notifyURL,
 		ReturnURL:       "https://example.com/success",
 		Description:     "Debug test payment",
 		Geolocation:     "ZA",
@@ -0,0 +1,254 @@
+// Package diagnostics explains why AddPay signatures fail: it shows the exact
+// canonical string that is signed, the parameters that were filtered out,
+// the format of each key and whether the keys belong together.
+package diagnostics
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mdwt/addpay-go/auth"
+	"github.com/mdwt/addpay-go/redact"
+	"github.com/mdwt/addpay-go/types"
+)
+
+// KeyFormat identifies how a key is encoded
+type KeyFormat string
+
+const (
+	FormatUnknown         KeyFormat = "unknown"
+	FormatPKCS1Private    KeyFormat = "PKCS1 private key"
+	FormatPKCS8Private    KeyFormat = "PKCS8 private key"
+	FormatEncryptedPKCS8  KeyFormat = "encrypted PKCS8 private key"
+	FormatPKCS12          KeyFormat = "PKCS12 bundle"
+	FormatX509Public      KeyFormat = "X.509 public key"
+	FormatPKCS1Public     KeyFormat = "PKCS1 public key"
+	FormatX509Certificate KeyFormat = "X.509 certificate"
+	FormatLegacyEncrypted KeyFormat = "legacy encrypted PEM private key"
+)
+
+// KeyInfo describes a key as found in configuration
+type KeyInfo struct {
+	Format   KeyFormat `json:"format"`
+	Encoding string    `json:"encoding"` // "PEM", "base64" or "DER"
+	Bits     int       `json:"bits,omitempty"`
+}
+
+// SignStringReport shows what SignParameters actually signs
+type SignStringReport struct {
+	SignString string                   `json:"sign_string"`
+	Included   []string                 `json:"included"`
+	Filtered   []auth.FilteredParameter `json:"filtered,omitempty"`
+}
+
+// VerifyReport is the result of checking a captured request or response
+type VerifyReport struct {
+	SignStringReport
+	Signature string `json:"signature"`
+	Valid     bool   `json:"valid"`
+	KeyID     string `json:"key_id,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
+
+// DetectKeyFormat reports the format and encoding of key data
+func DetectKeyFormat(data []byte) KeyInfo {
+	text := strings.TrimSpace(string(data))
+
+	if strings.HasPrefix(text, "-----BEGIN") {
+		block, _ := pem.Decode([]byte(text))
+		if block == nil {
+			return KeyInfo{Format: FormatUnknown, Encoding: "PEM"}
+		}
+		if block.Headers["Proc-Type"] == "4,ENCRYPTED" {
+			return KeyInfo{Format: FormatLegacyEncrypted, Encoding: "PEM"}
+		}
+		if block.Type == "ENCRYPTED PRIVATE KEY" {
+			return KeyInfo{Format: FormatEncryptedPKCS8, Encoding: "PEM"}
+		}
+		info := detectDER(block.Bytes)
+		info.Encoding = "PEM"
+		return info
+	}
+
+	if auth.IsEncryptedPrivateKey(data) {
+		return KeyInfo{Format: FormatPKCS12, Encoding: "DER"}
+	}
+
+	if der, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(text), "")); err == nil {
+		info := detectDER(der)
+		info.Encoding = "base64"
+		return info
+	}
+
+	info := detectDER(data)
+	info.Encoding = "DER"
+	return info
+}
+
+// detectDER identifies a DER encoded key structure
+func detectDER(der []byte) KeyInfo {
+	if key, err := x509.ParsePKCS1PrivateKey(der); err == nil {
+		return KeyInfo{Format: FormatPKCS1Private, Bits: key.N.BitLen()}
+	}
+	if key, err := x509.ParsePKCS8PrivateKey(der); err == nil {
+		info := KeyInfo{Format: FormatPKCS8Private}
+		if rsaKey, ok := key.(*rsa.PrivateKey); ok {
+			info.Bits = rsaKey.N.BitLen()
+		}
+		return info
+	}
+	if key, err := x509.ParsePKIXPublicKey(der); err == nil {
+		info := KeyInfo{Format: FormatX509Public}
+		if rsaKey, ok := key.(*rsa.PublicKey); ok {
+			info.Bits = rsaKey.N.BitLen()
+		}
+		return info
+	}
+	if key, err := x509.ParsePKCS1PublicKey(der); err == nil {
+		return KeyInfo{Format: FormatPKCS1Public, Bits: key.N.BitLen()}
+	}
+	if _, err := x509.ParseCertificate(der); err == nil {
+		return KeyInfo{Format: FormatX509Certificate}
+	}
+	return KeyInfo{Format: FormatUnknown}
+}
+
+// ExplainSignString returns the canonical sign string for params and lists
+// the parameters that were filtered out and why
+func ExplainSignString(params map[string]interface{}) SignStringReport {
+	signString, filtered := auth.ExplainParameters(params)
+
+	excluded := make(map[string]bool, len(filtered))
+	for _, f := range filtered {
+		excluded[f.Key] = true
+	}
+	included := make([]string, 0, len(params))
+	for key := range params {
+		if !excluded[key] {
+			included = append(included, key)
+		}
+	}
+	sort.Strings(included)
+
+	return SignStringReport{
+		SignString: signString,
+		Included:   included,
+		Filtered:   filtered,
+	}
+}
+
+// Redact returns a copy of the report with sensitive values masked, for
+// sharing with support without exposing tokens or card data
+func (r SignStringReport) Redact(redactor redact.Redactor) SignStringReport {
+	r.SignString = redactor.String(r.SignString)
+	filtered := make([]auth.FilteredParameter, len(r.Filtered))
+	for i, f := range r.Filtered {
+		f.Value = redactor.Value(f.Key, f.Value)
+		filtered[i] = f
+	}
+	if r.Filtered != nil {
+		r.Filtered = filtered
+	}
+	return r
+}
+
+// CheckKeyPair confirms that a private key and public key belong together by
+// signing a random challenge and verifying it
+func CheckKeyPair(privateKeyData, publicKeyData []byte) error {
+	privateKey, err := auth.ParsePrivateKey(privateKeyData)
+	if err != nil {
+		return fmt.Errorf("failed to parse private key: %w", err)
+	}
+	return CheckSignerKeyPair(privateKey, publicKeyData)
+}
+
+// CheckSignerKeyPair confirms that an already parsed private key matches publicKeyData
+func CheckSignerKeyPair(privateKey *rsa.PrivateKey, publicKeyData []byte) error {
+	publicKey, err := auth.ParseGatewayKey("", publicKeyData, time.Time{}, time.Time{})
+	if err != nil {
+		return fmt.Errorf("failed to parse public key: %w", err)
+	}
+
+	challenge := make([]byte, 32)
+	if _, err := rand.Read(challenge); err != nil {
+		return err
+	}
+
+	rsaAuth, err := auth.NewRSAAuthWithKeySet(privateKey, auth.NewKeySet(publicKey))
+	if err != nil {
+		return err
+	}
+	signature, err := rsaAuth.Sign(challenge)
+	if err != nil {
+		return err
+	}
+	if err := rsaAuth.Verify(challenge, signature); err != nil {
+		return fmt.Errorf("private key and public key do not form a pair")
+	}
+	return nil
+}
+
+// ParseCapture reads the parameters of a captured request or response. It
+// accepts a form-urlencoded body or a flat JSON object.
+func ParseCapture(data []byte) (map[string]interface{}, error) {
+	text := strings.TrimSpace(string(data))
+	params := make(map[string]interface{})
+
+	if strings.HasPrefix(text, "{") {
+		// Keep numbers as written so the sign string matches the gateway's
+		decoder := json.NewDecoder(strings.NewReader(text))
+		decoder.UseNumber()
+		if err := decoder.Decode(&params); err != nil {
+			return nil, fmt.Errorf("failed to parse JSON capture: %w", err)
+		}
+		return params, nil
+	}
+
+	values, err := url.ParseQuery(text)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse form capture: %w", err)
+	}
+	for key := range values {
+		params[key] = values.Get(key)
+	}
+	return params, nil
+}
+
+// Redact returns a copy of the report with sensitive values masked
+func (r VerifyReport) Redact(redactor redact.Redactor) VerifyReport {
+	r.SignStringReport = r.SignStringReport.Redact(redactor)
+	r.Signature = redactor.Value("sign", r.Signature).(string)
+	r.Error = redactor.String(r.Error)
+	return r
+}
+
+// VerifyCapture checks the "sign" parameter of captured params end to end
+// against the given keys
+func VerifyCapture(params map[string]interface{}, keys types.GatewayKeys) VerifyReport {
+	report := VerifyReport{SignStringReport: ExplainSignString(params)}
+
+	signature, _ := params["sign"].(string)
+	report.Signature = signature
+	if signature == "" {
+		report.Error = "capture has no sign parameter"
+		return report
+	}
+
+	keyID, err := keys.Verify([]byte(report.SignString), signature)
+	if err != nil {
+		report.Error = err.Error()
+		return report
+	}
+	report.Valid = true
+	report.KeyID = keyID
+	return report
+}
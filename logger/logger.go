@@ -1,43 +1,234 @@
 package logger
 
 import (
+	"context"
+	"io"
 	"log/slog"
 	"os"
+	"runtime"
+	"time"
 
+	"github.com/mdwt/addpay-go/redact"
 	"github.com/mdwt/addpay-go/types"
 )
 
-// SlogLogger wraps slog.Logger to implement the simple Logger interface
+// Group is the slog group the library's attributes are nested under
+const Group = "addpay"
+
+// Options configures a logger created with New
+type Options struct {
+	Level    slog.Leveler     // Optional: minimum level, Info when nil; a *slog.LevelVar can be changed at run time
+	Output   io.Writer        // Optional: destination, os.Stderr when nil
+	Text     bool             // Optional: write logfmt-style text instead of JSON
+	Redactor *redact.Redactor // Optional: masks sensitive attribute values, redact.Default() when nil
+}
+
+// SlogLogger wraps slog.Logger to implement the simple Logger interface.
+// Attributes passed by the library are nested in the "addpay" group, while
+// the request and trace IDs of a bound context are added at the top level.
+// Attribute values pass through a redactor before they are logged.
 type SlogLogger struct {
-	logger *slog.Logger
+	logger       *slog.Logger
+	ctx          context.Context
+	contextAttrs []func(context.Context) []slog.Attr
+	redactor     redact.Redactor
 }
 
-// NewDefaultLogger creates a default slog-based logger
+// NewDefaultLogger creates a default slog-based logger writing JSON to stdout at Info level
 func NewDefaultLogger() types.Logger {
-	logger := slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{
-		Level: slog.LevelInfo,
-	}))
-	return &SlogLogger{logger: logger}
+	return New(Options{Output: os.Stdout})
+}
+
+// New creates a logger with its own slog handler
+func New(opts Options) *SlogLogger {
+	output := opts.Output
+	if output == nil {
+		output = os.Stderr
+	}
+	handlerOptions := &slog.HandlerOptions{Level: opts.Level}
+
+	var handler slog.Handler
+	if opts.Text {
+		handler = slog.NewTextHandler(output, handlerOptions)
+	} else {
+		handler = slog.NewJSONHandler(output, handlerOptions)
+	}
+	l := FromSlog(slog.New(handler))
+	if opts.Redactor != nil {
+		l.redactor = *opts.Redactor
+	}
+	return l
+}
+
+// FromSlog logs through an application's slog.Logger, so library logs share
+// its handler, level and destination. A nil logger uses slog.Default().
+func FromSlog(l *slog.Logger) *SlogLogger {
+	if l == nil {
+		l = slog.Default()
+	}
+	return &SlogLogger{logger: l, redactor: redact.Default()}
+}
+
+// WithRedactor returns a copy of the logger that masks attribute values with r
+func (s *SlogLogger) WithRedactor(r redact.Redactor) *SlogLogger {
+	copied := *s
+	copied.redactor = r
+	return &copied
+}
+
+// WithContextAttrs returns a copy of the logger that also adds the attributes
+// fn extracts from a bound context, for example IDs from a tracing library
+func (s *SlogLogger) WithContextAttrs(fn func(ctx context.Context) []slog.Attr) *SlogLogger {
+	copied := *s
+	copied.contextAttrs = append(append([]func(context.Context) []slog.Attr(nil), s.contextAttrs...), fn)
+	return &copied
+}
+
+// WithContext returns a copy of the logger that passes ctx to the slog
+// handler and adds the request and trace IDs stored in it
+func (s *SlogLogger) WithContext(ctx context.Context) types.Logger {
+	copied := *s
+	copied.ctx = ctx
+	return &copied
 }
 
 // Debug logs a debug message with key-value pairs
 func (s *SlogLogger) Debug(msg string, keysAndValues ...interface{}) {
-	s.logger.Debug(msg, keysAndValues...)
+	s.log(slog.LevelDebug, msg, keysAndValues)
 }
 
 // Info logs an info message with key-value pairs
 func (s *SlogLogger) Info(msg string, keysAndValues ...interface{}) {
-	s.logger.Info(msg, keysAndValues...)
+	s.log(slog.LevelInfo, msg, keysAndValues)
 }
 
 // Warn logs a warning message with key-value pairs
 func (s *SlogLogger) Warn(msg string, keysAndValues ...interface{}) {
-	s.logger.Warn(msg, keysAndValues...)
+	s.log(slog.LevelWarn, msg, keysAndValues)
 }
 
 // Error logs an error message with key-value pairs
 func (s *SlogLogger) Error(msg string, keysAndValues ...interface{}) {
-	s.logger.Error(msg, keysAndValues...)
+	s.log(slog.LevelError, msg, keysAndValues)
+}
+
+// log builds the record so the source position is the library's caller
+// rather than this wrapper
+func (s *SlogLogger) log(level slog.Level, msg string, keysAndValues []interface{}) {
+	ctx := s.ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if !s.logger.Enabled(ctx, level) {
+		return
+	}
+
+	var pcs [1]uintptr
+	runtime.Callers(3, pcs[:]) // skip Callers, log and the level method
+	record := slog.NewRecord(time.Now(), level, msg, pcs[0])
+
+	if id := RequestID(ctx); id != "" {
+		record.AddAttrs(slog.String("request_id", id))
+	}
+	if id := TraceID(ctx); id != "" {
+		record.AddAttrs(slog.String("trace_id", id))
+	}
+	for _, fn := range s.contextAttrs {
+		record.AddAttrs(fn(ctx)...)
+	}
+	if len(keysAndValues) > 0 {
+		record.AddAttrs(slog.Group(Group, s.redactor.KeyValues(keysAndValues)...))
+	}
+	_ = s.logger.Handler().Handle(ctx, record)
+}
+
+// contextBinder is implemented by loggers that accept the context of the
+// operation being logged
+type contextBinder interface {
+	WithContext(ctx context.Context) types.Logger
+}
+
+// WithContext binds ctx to l if l supports it, and otherwise returns l
+// unchanged. The library calls it for every operation that has a context.
+func WithContext(l types.Logger, ctx context.Context) types.Logger {
+	if binder, ok := l.(contextBinder); ok {
+		return binder.WithContext(ctx)
+	}
+	return l
+}
+
+// redactingLogger masks the attribute values passed to another logger
+type redactingLogger struct {
+	logger   types.Logger
+	redactor redact.Redactor
+}
+
+// Redacted returns a logger that masks attribute values with r before
+// passing them to l. A logger from this package is given r directly.
+func Redacted(l types.Logger, r redact.Redactor) types.Logger {
+	switch l := l.(type) {
+	case *SlogLogger:
+		return l.WithRedactor(r)
+	case *NoOpLogger:
+		return l
+	}
+	return redactingLogger{logger: l, redactor: r}
+}
+
+// WithContext binds ctx to the wrapped logger
+func (l redactingLogger) WithContext(ctx context.Context) types.Logger {
+	l.logger = WithContext(l.logger, ctx)
+	return l
+}
+
+// Debug logs a debug message with masked key-value pairs
+func (l redactingLogger) Debug(msg string, keysAndValues ...interface{}) {
+	l.logger.Debug(msg, l.redactor.KeyValues(keysAndValues)...)
+}
+
+// Info logs an info message with masked key-value pairs
+func (l redactingLogger) Info(msg string, keysAndValues ...interface{}) {
+	l.logger.Info(msg, l.redactor.KeyValues(keysAndValues)...)
+}
+
+// Warn logs a warning message with masked key-value pairs
+func (l redactingLogger) Warn(msg string, keysAndValues ...interface{}) {
+	l.logger.Warn(msg, l.redactor.KeyValues(keysAndValues)...)
+}
+
+// Error logs an error message with masked key-value pairs
+func (l redactingLogger) Error(msg string, keysAndValues ...interface{}) {
+	l.logger.Error(msg, l.redactor.KeyValues(keysAndValues)...)
+}
+
+// contextKey identifies the values this package stores in a context
+type contextKey int
+
+const (
+	requestIDKey contextKey = iota
+	traceIDKey
+)
+
+// WithRequestID returns a context whose log lines carry request ID id
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey, id)
+}
+
+// RequestID returns the request ID stored with WithRequestID, or ""
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey).(string)
+	return id
+}
+
+// WithTraceID returns a context whose log lines carry trace ID id
+func WithTraceID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, traceIDKey, id)
+}
+
+// TraceID returns the trace ID stored with WithTraceID, or ""
+func TraceID(ctx context.Context) string {
+	id, _ := ctx.Value(traceIDKey).(string)
+	return id
 }
 
 // NoOpLogger discards all log messages
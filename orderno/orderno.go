@@ -0,0 +1,268 @@
+// Package orderno generates merchant order numbers that sort by creation
+// time, do not collide between goroutines or processes, and stay within the
+// characters and length the gateway accepts.
+//
+// An order number is the prefix followed by the creation time in
+// milliseconds, the optional store code, random characters and an optional
+// check character:
+//
+//	INV-01M57H5191S0424DTDFD1FQZYSGR
+//	    |         |   |            └ check character
+//	    |         |   └ random
+//	    |         └ store code
+//	    └ time
+package orderno
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// MaxLength is the longest merchant order number the gateway accepts
+	MaxLength = 32
+	// minRandomLength keeps at least 40 random bits per millisecond
+	minRandomLength = 8
+	// timeLength holds Unix milliseconds until the year 10889
+	timeLength = 10
+)
+
+// ErrInvalid is returned for order numbers the gateway or generator would reject
+var ErrInvalid = errors.New("invalid merchant order number")
+
+// encoding is Crockford's base32, whose digits sort in the same order as
+// their values and leave out I, L, O and U to avoid misreading
+const encoding = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+// checkAlphabet is the alphabet of the check character and the characters it covers
+const checkAlphabet = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZ"
+
+// allowed matches the characters the gateway accepts in an order number
+var allowed = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// Validate checks that orderNo uses only letters, digits, "-" and "_" and is
+// no longer than MaxLength
+func Validate(orderNo string) error {
+	if orderNo == "" {
+		return fmt.Errorf("%w: empty", ErrInvalid)
+	}
+	if len(orderNo) > MaxLength {
+		return fmt.Errorf("%w: %q is longer than %d characters", ErrInvalid, orderNo, MaxLength)
+	}
+	if !allowed.MatchString(orderNo) {
+		return fmt.Errorf("%w: %q may only contain letters, digits, '-' and '_'", ErrInvalid, orderNo)
+	}
+	return nil
+}
+
+// Config describes the order numbers a Generator produces
+type Config struct {
+	Prefix   string // Optional: fixed leading text, such as "INV-"
+	Length   int    // Optional: total length; MaxLength when zero
+	StoreNo  string // Optional: store number to embed, reduced to its letters and digits
+	Checksum bool   // Optional: append a check character that catches typing mistakes
+}
+
+// Generator produces order numbers for one Config. It is safe for
+// concurrent use, and numbers from the same generator are strictly
+// increasing.
+type Generator struct {
+	prefix   string
+	store    string
+	random   int
+	checksum bool
+	now      func() time.Time
+
+	mu         sync.Mutex
+	lastMillis int64
+	lastRandom []byte
+}
+
+// NewGenerator creates a generator, checking that the prefix and store fit
+// the gateway limits with enough random characters left
+func NewGenerator(cfg Config) (*Generator, error) {
+	length := cfg.Length
+	if length == 0 {
+		length = MaxLength
+	}
+	if length > MaxLength {
+		return nil, fmt.Errorf("order number length %d exceeds the gateway limit of %d", length, MaxLength)
+	}
+	if cfg.Prefix != "" && !allowed.MatchString(cfg.Prefix) {
+		return nil, fmt.Errorf("prefix %q may only contain letters, digits, '-' and '_'", cfg.Prefix)
+	}
+
+	store := storeCode(cfg.StoreNo)
+	if cfg.StoreNo != "" && store == "" {
+		return nil, fmt.Errorf("store number %q has no letters or digits", cfg.StoreNo)
+	}
+
+	random := length - len(cfg.Prefix) - timeLength - len(store)
+	if cfg.Checksum {
+		random--
+	}
+	if random < minRandomLength {
+		return nil, fmt.Errorf("order number length %d leaves %d random characters, need at least %d",
+			length, random, minRandomLength)
+	}
+
+	return &Generator{
+		prefix:   cfg.Prefix,
+		store:    store,
+		random:   random,
+		checksum: cfg.Checksum,
+		now:      time.Now,
+	}, nil
+}
+
+// Next returns a new order number
+func (g *Generator) Next() string {
+	millis, random := g.nextState()
+
+	var b strings.Builder
+	b.WriteString(g.prefix)
+	b.WriteString(encodeTime(millis))
+	b.WriteString(g.store)
+	for _, v := range random {
+		b.WriteByte(encoding[v])
+	}
+	if g.checksum {
+		b.WriteByte(checkCharacter(b.String()[len(g.prefix):]))
+	}
+	return b.String()
+}
+
+// nextState returns the time and random digits of the next number. Within
+// the same millisecond the random digits of the previous number are
+// incremented, so numbers keep increasing however fast they are generated.
+func (g *Generator) nextState() (int64, []byte) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	millis := g.now().UnixMilli()
+	if millis > g.lastMillis || g.lastRandom == nil {
+		g.lastMillis = millis
+		g.lastRandom = randomDigits(g.random)
+	} else if !increment(g.lastRandom) {
+		// The random digits overflowed; borrow the next millisecond
+		g.lastMillis++
+		g.lastRandom = randomDigits(g.random)
+	}
+	return g.lastMillis, append([]byte(nil), g.lastRandom...)
+}
+
+// Verify checks that orderNo could have been produced by this generator,
+// including its check character
+func (g *Generator) Verify(orderNo string) error {
+	if err := Validate(orderNo); err != nil {
+		return err
+	}
+	body, ok := strings.CutPrefix(orderNo, g.prefix)
+	if !ok {
+		return fmt.Errorf("%w: %q does not start with %q", ErrInvalid, orderNo, g.prefix)
+	}
+	if len(body) != g.bodyLength() {
+		return fmt.Errorf("%w: %q has the wrong length", ErrInvalid, orderNo)
+	}
+	if g.store != "" && body[timeLength:timeLength+len(g.store)] != g.store {
+		return fmt.Errorf("%w: %q is not for store %s", ErrInvalid, orderNo, g.store)
+	}
+
+	payload := body
+	if g.checksum {
+		payload = body[:len(body)-1]
+	}
+	for _, section := range []string{payload[:timeLength], payload[timeLength+len(g.store):]} {
+		for i := 0; i < len(section); i++ {
+			if strings.IndexByte(encoding, section[i]) < 0 {
+				return fmt.Errorf("%w: %q contains %q", ErrInvalid, orderNo, section[i])
+			}
+		}
+	}
+	if g.checksum && checkCharacter(payload) != body[len(body)-1] {
+		return fmt.Errorf("%w: %q fails its checksum", ErrInvalid, orderNo)
+	}
+	return nil
+}
+
+// Time returns the creation time encoded in an order number from this generator
+func (g *Generator) Time(orderNo string) (time.Time, error) {
+	if err := g.Verify(orderNo); err != nil {
+		return time.Time{}, err
+	}
+	var millis int64
+	for _, c := range orderNo[len(g.prefix) : len(g.prefix)+timeLength] {
+		millis = millis<<5 | int64(strings.IndexRune(encoding, c))
+	}
+	return time.UnixMilli(millis), nil
+}
+
+// bodyLength is the length of an order number without its prefix
+func (g *Generator) bodyLength() int {
+	n := timeLength + len(g.store) + g.random
+	if g.checksum {
+		n++
+	}
+	return n
+}
+
+// encodeTime writes millis as fixed-width base32 so numbers sort by time
+func encodeTime(millis int64) string {
+	var b [timeLength]byte
+	for i := timeLength - 1; i >= 0; i-- {
+		b[i] = encoding[millis&31]
+		millis >>= 5
+	}
+	return string(b[:])
+}
+
+// randomDigits returns n random base32 digit values
+func randomDigits(n int) []byte {
+	digits := make([]byte, n)
+	rand.Read(digits) // never fails; the program aborts if no randomness is available
+	for i := range digits {
+		digits[i] &= 31
+	}
+	return digits
+}
+
+// increment adds one to base32 digit values, reporting false on overflow
+func increment(digits []byte) bool {
+	for i := len(digits) - 1; i >= 0; i-- {
+		if digits[i] < 31 {
+			digits[i]++
+			return true
+		}
+		digits[i] = 0
+	}
+	return false
+}
+
+// storeCode reduces a store number to upper case letters and digits
+func storeCode(storeNo string) string {
+	var b strings.Builder
+	for _, c := range strings.ToUpper(storeNo) {
+		if ('0' <= c && c <= '9') || ('A' <= c && c <= 'Z') {
+			b.WriteRune(c)
+		}
+	}
+	return b.String()
+}
+
+// checkCharacter computes the Luhn mod 36 check character of s, which
+// detects any single mistyped character and most swapped neighbours
+func checkCharacter(s string) byte {
+	const n = len(checkAlphabet)
+	factor, sum := 2, 0
+	for i := len(s) - 1; i >= 0; i-- {
+		addend := factor * strings.IndexByte(checkAlphabet, s[i])
+		sum += addend/n + addend%n
+		factor = 3 - factor
+	}
+	return checkAlphabet[(n-sum%n)%n]
+}
@@ -0,0 +1,151 @@
+// Package orders tracks the payment lifecycle of merchant orders from the
+// responses, notifications and order queries the gateway returns, so every
+// service records state changes the same way.
+//
+// An order moves created → pending → paid, failed, cancelled or expired, and
+// a paid order may later be refunded. Updates that would move an order
+// backwards or out of a final state are rejected with ErrIllegalTransition.
+package orders
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/mdwt/addpay-go/types"
+)
+
+// State is the lifecycle state of an order
+type State string
+
+const (
+	StateCreated   State = "created"   // recorded, not yet sent to the gateway
+	StatePending   State = "pending"   // sent to the gateway, awaiting the customer
+	StatePaid      State = "paid"      // payment succeeded
+	StateFailed    State = "failed"    // payment was declined or failed
+	StateCancelled State = "cancelled" // closed before payment
+	StateExpired   State = "expired"   // not paid before it expired
+	StateRefunded  State = "refunded"  // paid, then partly or fully refunded
+)
+
+// transitions lists the states each state may move to
+var transitions = map[State][]State{
+	StateCreated:  {StatePending, StatePaid, StateFailed, StateCancelled, StateExpired},
+	StatePending:  {StatePaid, StateFailed, StateCancelled, StateExpired},
+	StatePaid:     {StateRefunded},
+	StateRefunded: {},
+}
+
+// CanTransition reports whether an order in state s may move to next. Staying
+// in the same state is always allowed.
+func (s State) CanTransition(next State) bool {
+	if s == next {
+		return true
+	}
+	for _, allowed := range transitions[s] {
+		if allowed == next {
+			return true
+		}
+	}
+	return false
+}
+
+// Final reports whether no payment outcome can follow. A paid order is not
+// final because it may still be refunded.
+func (s State) Final() bool {
+	return s == StateFailed || s == StateCancelled || s == StateExpired || s == StateRefunded
+}
+
+// StateFromStatus maps a normalised gateway status to a State. Unrecognised
+// statuses report false.
+func StateFromStatus(status types.PaymentStatus) (State, bool) {
+	switch status {
+	case types.PaymentPending:
+		return StatePending, true
+	case types.PaymentPaid:
+		return StatePaid, true
+	case types.PaymentFailed:
+		return StateFailed, true
+	case types.PaymentCancelled:
+		return StateCancelled, true
+	case types.PaymentExpired:
+		return StateExpired, true
+	case types.PaymentRefunded:
+		return StateRefunded, true
+	}
+	return "", false
+}
+
+// Source says where a state change came from
+type Source string
+
+const (
+	SourceMerchant     Source = "merchant"      // recorded by the merchant's own code
+	SourceCheckout     Source = "checkout"      // a HostedCheckout response
+	SourceTokenizedPay Source = "tokenized_pay" // a TokenizedPay response
+	SourceNotification Source = "notification"  // a gateway webhook
+	SourceOrderQuery   Source = "order_query"   // a QueryOrder response
+)
+
+// ErrIllegalTransition is returned for updates the lifecycle does not allow
+var ErrIllegalTransition = errors.New("illegal order state transition")
+
+// Order is a merchant order and its payment state
+type Order struct {
+	MerchantOrderNo string    `json:"merchant_order_no"`
+	MerchantNo      string    `json:"merchant_no,omitempty"`
+	StoreNo         string    `json:"store_no,omitempty"`
+	TransactionID   string    `json:"transaction_id,omitempty"`
+	State           State     `json:"state"`
+	Source          Source    `json:"source"` // source of the latest change
+	Currency        string    `json:"currency"`
+	Amount          float64   `json:"amount"`
+	PaidAmount      float64   `json:"paid_amount,omitempty"`
+	PayURL          string    `json:"pay_url,omitempty"`
+	CreatedAt       time.Time `json:"created_at"`
+	UpdatedAt       time.Time `json:"updated_at"`
+	Version         int64     `json:"version"` // incremented on every stored change
+}
+
+// Update is a change reported for an order. Empty fields leave the order
+// unchanged.
+type Update struct {
+	State         State
+	Source        Source
+	TransactionID string
+	PaidAmount    float64
+	PayURL        string
+}
+
+// Apply returns the order with u applied and reports whether anything
+// changed. An update to a state the order cannot move to returns
+// ErrIllegalTransition and the order unchanged.
+func (o Order) Apply(u Update, now time.Time) (Order, bool, error) {
+	if u.State != "" && !o.State.CanTransition(u.State) {
+		return o, false, fmt.Errorf("%w: %s order %s cannot become %s (from %s)",
+			ErrIllegalTransition, o.State, o.MerchantOrderNo, u.State, u.Source)
+	}
+
+	next := o
+	if u.State != "" {
+		next.State = u.State
+	}
+	if u.TransactionID != "" {
+		next.TransactionID = u.TransactionID
+	}
+	if u.PaidAmount != 0 {
+		next.PaidAmount = u.PaidAmount
+	}
+	if u.PayURL != "" {
+		next.PayURL = u.PayURL
+	}
+
+	changed := next.State != o.State || next.TransactionID != o.TransactionID ||
+		next.PaidAmount != o.PaidAmount || next.PayURL != o.PayURL
+	if !changed {
+		return o, false, nil
+	}
+	next.Source = u.Source
+	next.UpdatedAt = now
+	return next, true, nil
+}
@@ -0,0 +1,205 @@
+package orders
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/mdwt/addpay-go/sqlbind"
+)
+
+var (
+	// ErrNotFound is returned for an order the store does not hold
+	ErrNotFound = errors.New("order not found")
+	// ErrExists is returned when creating an order that is already stored
+	ErrExists = errors.New("order already exists")
+	// ErrConflict is returned when an order changed since it was read
+	ErrConflict = errors.New("order was modified concurrently")
+)
+
+// Store persists orders keyed by MerchantOrderNo
+type Store interface {
+	// Create stores a new order, returning ErrExists if it is already stored
+	Create(ctx context.Context, o Order) error
+	// Get returns an order or ErrNotFound
+	Get(ctx context.Context, merchantOrderNo string) (Order, error)
+	// Update replaces an order if its stored Version still equals o.Version,
+	// and stores it with the version incremented. It returns ErrConflict if
+	// the order changed since it was read.
+	Update(ctx context.Context, o Order) error
+}
+
+// MemoryStore is an in-process Store for single instance deployments and tests
+type MemoryStore struct {
+	mu     sync.Mutex
+	orders map[string]Order
+}
+
+// NewMemoryStore creates an empty in-memory store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{orders: make(map[string]Order)}
+}
+
+// Create stores a new order
+func (s *MemoryStore) Create(ctx context.Context, o Order) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.orders[o.MerchantOrderNo]; ok {
+		return fmt.Errorf("%w: %s", ErrExists, o.MerchantOrderNo)
+	}
+	s.orders[o.MerchantOrderNo] = o
+	return nil
+}
+
+// Get returns an order
+func (s *MemoryStore) Get(ctx context.Context, merchantOrderNo string) (Order, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	o, ok := s.orders[merchantOrderNo]
+	if !ok {
+		return Order{}, fmt.Errorf("%w: %s", ErrNotFound, merchantOrderNo)
+	}
+	return o, nil
+}
+
+// Update replaces an order that has not changed since it was read
+func (s *MemoryStore) Update(ctx context.Context, o Order) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	current, ok := s.orders[o.MerchantOrderNo]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrNotFound, o.MerchantOrderNo)
+	}
+	if current.Version != o.Version {
+		return fmt.Errorf("%w: %s", ErrConflict, o.MerchantOrderNo)
+	}
+	o.Version++
+	s.orders[o.MerchantOrderNo] = o
+	return nil
+}
+
+// SQLStore is a Store backed by a database table; CreateTable creates it.
+// Times are stored as Unix seconds.
+type SQLStore struct {
+	db    *sql.DB
+	table string
+	style sqlbind.Style
+}
+
+// NewSQLStore creates a store using table in db with "?" placeholders
+func NewSQLStore(db *sql.DB, table string) (SQLStore, error) {
+	if err := sqlbind.CheckIdentifier(table); err != nil {
+		return SQLStore{}, err
+	}
+	return SQLStore{db: db, table: table, style: sqlbind.Question}, nil
+}
+
+// WithBindStyle returns a copy of the store that uses the driver's placeholder style
+func (s SQLStore) WithBindStyle(style sqlbind.Style) SQLStore {
+	s.style = style
+	return s
+}
+
+// columns lists the table columns in the order they are written and scanned
+const columns = "merchant_order_no, merchant_no, store_no, transaction_id, state, source, " +
+	"currency, amount, paid_amount, pay_url, created_at, updated_at, version"
+
+// CreateTable creates the table if it does not exist
+func (s SQLStore) CreateTable(ctx context.Context) error {
+	_, err := s.db.ExecContext(ctx, "CREATE TABLE IF NOT EXISTS "+s.table+` (
+		merchant_order_no VARCHAR(64) NOT NULL PRIMARY KEY,
+		merchant_no VARCHAR(64) NOT NULL,
+		store_no VARCHAR(64) NOT NULL,
+		transaction_id VARCHAR(128) NOT NULL,
+		state VARCHAR(16) NOT NULL,
+		source VARCHAR(32) NOT NULL,
+		currency VARCHAR(8) NOT NULL,
+		amount DECIMAL(18,2) NOT NULL,
+		paid_amount DECIMAL(18,2) NOT NULL,
+		pay_url VARCHAR(1024) NOT NULL,
+		created_at BIGINT NOT NULL,
+		updated_at BIGINT NOT NULL,
+		version BIGINT NOT NULL)`)
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", s.table, err)
+	}
+	return nil
+}
+
+// Create inserts a new order
+func (s SQLStore) Create(ctx context.Context, o Order) error {
+	_, insertErr := s.db.ExecContext(ctx, s.style.Rebind("INSERT INTO "+s.table+" ("+columns+
+		") VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)"),
+		o.MerchantOrderNo, o.MerchantNo, o.StoreNo, o.TransactionID, string(o.State), string(o.Source),
+		o.Currency, o.Amount, o.PaidAmount, o.PayURL, o.CreatedAt.Unix(), o.UpdatedAt.Unix(), o.Version)
+	if insertErr == nil {
+		return nil
+	}
+
+	// Unique violations are reported differently by every driver, so check
+	// whether the order exists instead of inspecting the error
+	if _, err := s.Get(ctx, o.MerchantOrderNo); err == nil {
+		return fmt.Errorf("%w: %s", ErrExists, o.MerchantOrderNo)
+	}
+	return fmt.Errorf("failed to create order: %w", insertErr)
+}
+
+// Get reads an order
+func (s SQLStore) Get(ctx context.Context, merchantOrderNo string) (Order, error) {
+	var o Order
+	var state, source string
+	var createdAt, updatedAt int64
+	err := s.db.QueryRowContext(ctx, s.style.Rebind("SELECT "+columns+" FROM "+s.table+
+		" WHERE merchant_order_no = ?"), merchantOrderNo).Scan(
+		&o.MerchantOrderNo, &o.MerchantNo, &o.StoreNo, &o.TransactionID, &state, &source,
+		&o.Currency, &o.Amount, &o.PaidAmount, &o.PayURL, &createdAt, &updatedAt, &o.Version)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Order{}, fmt.Errorf("%w: %s", ErrNotFound, merchantOrderNo)
+	}
+	if err != nil {
+		return Order{}, fmt.Errorf("failed to read order: %w", err)
+	}
+	o.State = State(state)
+	o.Source = Source(source)
+	o.CreatedAt = unixTime(createdAt)
+	o.UpdatedAt = unixTime(updatedAt)
+	return o, nil
+}
+
+// Update writes an order if its version is unchanged
+func (s SQLStore) Update(ctx context.Context, o Order) error {
+	result, err := s.db.ExecContext(ctx, s.style.Rebind("UPDATE "+s.table+
+		" SET transaction_id = ?, state = ?, source = ?, paid_amount = ?, pay_url = ?, updated_at = ?, version = ?"+
+		" WHERE merchant_order_no = ? AND version = ?"),
+		o.TransactionID, string(o.State), string(o.Source), o.PaidAmount, o.PayURL, o.UpdatedAt.Unix(), o.Version+1,
+		o.MerchantOrderNo, o.Version)
+	if err != nil {
+		return fmt.Errorf("failed to update order: %w", err)
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to update order: %w", err)
+	}
+	if rows > 0 {
+		return nil
+	}
+
+	if _, err := s.Get(ctx, o.MerchantOrderNo); err != nil {
+		return err
+	}
+	return fmt.Errorf("%w: %s", ErrConflict, o.MerchantOrderNo)
+}
+
+// unixTime converts Unix seconds to a time, keeping zero as the zero time
+func unixTime(seconds int64) time.Time {
+	if seconds == 0 {
+		return time.Time{}
+	}
+	return time.Unix(seconds, 0)
+}
@@ -0,0 +1,181 @@
+package orders
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/mdwt/addpay-go/client"
+	"github.com/mdwt/addpay-go/logger"
+	"github.com/mdwt/addpay-go/types"
+)
+
+// maxAttempts bounds the retries of an update that lost a concurrent write
+const maxAttempts = 5
+
+// Tracker applies gateway results to stored orders
+type Tracker struct {
+	store  Store
+	logger types.Logger
+	now    func() time.Time
+}
+
+// NewTracker creates a tracker that keeps orders in store
+func NewTracker(store Store) Tracker {
+	return Tracker{
+		store:  store,
+		logger: logger.NewNoOpLogger(),
+		now:    time.Now,
+	}
+}
+
+// SetLogger returns a copy of the tracker that logs to l
+func (t Tracker) SetLogger(l types.Logger) Tracker {
+	t.logger = l
+	return t
+}
+
+// Create stores a new order in the created state
+func (t Tracker) Create(ctx context.Context, o Order) (Order, error) {
+	if o.MerchantOrderNo == "" {
+		return Order{}, fmt.Errorf("order has no merchant order number")
+	}
+	now := t.now()
+	o.State = StateCreated
+	o.Source = SourceMerchant
+	o.CreatedAt = now
+	o.UpdatedAt = now
+	o.Version = 0
+	if err := t.store.Create(ctx, o); err != nil {
+		return Order{}, err
+	}
+	return o, nil
+}
+
+// Get returns a stored order
+func (t Tracker) Get(ctx context.Context, merchantOrderNo string) (Order, error) {
+	return t.store.Get(ctx, merchantOrderNo)
+}
+
+// Apply applies u to a stored order, rereading and retrying if the order is
+// changed concurrently. Illegal transitions return ErrIllegalTransition.
+func (t Tracker) Apply(ctx context.Context, merchantOrderNo string, u Update) (Order, error) {
+	log := logger.WithContext(t.logger, ctx)
+	for attempt := 1; ; attempt++ {
+		current, err := t.store.Get(ctx, merchantOrderNo)
+		if err != nil {
+			return Order{}, err
+		}
+
+		next, changed, err := current.Apply(u, t.now())
+		if err != nil {
+			log.Warn("Order update rejected",
+				"merchant_order_no", merchantOrderNo,
+				"state", current.State,
+				"update_state", u.State,
+				"source", u.Source)
+			return current, err
+		}
+		if !changed {
+			return current, nil
+		}
+
+		err = t.store.Update(ctx, next)
+		if err == nil {
+			next.Version++
+			if next.State != current.State {
+				log.Info("Order state changed",
+					"merchant_order_no", merchantOrderNo,
+					"from", current.State,
+					"to", next.State,
+					"source", u.Source)
+			}
+			return next, nil
+		}
+		if !errors.Is(err, ErrConflict) || attempt == maxAttempts {
+			return Order{}, fmt.Errorf("failed to update order %s: %w", merchantOrderNo, err)
+		}
+	}
+}
+
+// RecordCheckout marks an order pending once HostedCheckout returned a payment page
+func (t Tracker) RecordCheckout(ctx context.Context, merchantOrderNo string, response types.CheckoutResponse) (Order, error) {
+	return t.Apply(ctx, merchantOrderNo, Update{
+		State:  StatePending,
+		Source: SourceCheckout,
+		PayURL: response.PayURL,
+	})
+}
+
+// RecordTokenizedPay applies the outcome of TokenizedPay. A status that is
+// not recognised leaves the order pending until a notification or query
+// settles it.
+func (t Tracker) RecordTokenizedPay(ctx context.Context, merchantOrderNo string, response types.TokenizedPayResponse) (Order, error) {
+	state, ok := StateFromStatus(types.ParsePaymentStatus(response.TransactionStatus))
+	if !ok {
+		state = StatePending
+	}
+	return t.Apply(ctx, merchantOrderNo, Update{
+		State:         state,
+		Source:        SourceTokenizedPay,
+		TransactionID: response.TransactionID,
+	})
+}
+
+// RecordNotification applies a verified gateway notification
+func (t Tracker) RecordNotification(ctx context.Context, n types.Notification) (Order, error) {
+	state, ok := StateFromStatus(types.ParsePaymentStatus(n.OrderStatus))
+	if !ok {
+		return Order{}, fmt.Errorf("unrecognised order status %q for order %s", n.OrderStatus, n.MerchantOrderNo)
+	}
+	return t.Apply(ctx, n.MerchantOrderNo, Update{
+		State:         state,
+		Source:        SourceNotification,
+		TransactionID: n.TransactionID,
+		PaidAmount:    n.PaidAmount,
+	})
+}
+
+// RecordQuery applies the result of QueryOrder for merchantOrderNo
+func (t Tracker) RecordQuery(ctx context.Context, merchantOrderNo string, response types.QueryOrderResponse) (Order, error) {
+	state, ok := StateFromStatus(types.ParsePaymentStatus(response.OrderStatus))
+	if !ok {
+		return Order{}, fmt.Errorf("unrecognised order status %q for order %s", response.OrderStatus, merchantOrderNo)
+	}
+	return t.Apply(ctx, merchantOrderNo, Update{
+		State:         state,
+		Source:        SourceOrderQuery,
+		TransactionID: response.TransactionID,
+		PaidAmount:    response.PaidAmount,
+	})
+}
+
+// Sync queries the gateway for a stored order and applies the result
+func (t Tracker) Sync(ctx context.Context, c client.Client, merchantOrderNo string) (Order, error) {
+	current, err := t.store.Get(ctx, merchantOrderNo)
+	if err != nil {
+		return Order{}, err
+	}
+	response, err := c.QueryOrder(ctx, types.QueryOrderRequest{
+		MerchantNo:      current.MerchantNo,
+		StoreNo:         current.StoreNo,
+		MerchantOrderNo: merchantOrderNo,
+		TransactionID:   current.TransactionID,
+	})
+	if err != nil {
+		return Order{}, fmt.Errorf("failed to query order %s: %w", merchantOrderNo, err)
+	}
+	return t.RecordQuery(ctx, merchantOrderNo, response)
+}
+
+// HandleNotification is a webhook.HandlerFunc that records notifications.
+// Notifications the lifecycle rejects, such as a late failure for an order
+// already paid, are acknowledged so the gateway stops resending them.
+func (t Tracker) HandleNotification(ctx context.Context, n types.Notification) error {
+	_, err := t.RecordNotification(ctx, n)
+	if errors.Is(err, ErrIllegalTransition) {
+		return nil
+	}
+	return err
+}
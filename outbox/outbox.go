@@ -0,0 +1,120 @@
+// Package outbox makes gateway calls durable. Services write the call they
+// intend to make in the same database transaction as their own data, and a
+// Worker dispatches it through client.Client afterwards, so a crash can
+// neither lose the call nor leave its outcome unrecorded.
+//
+// A call interrupted by a crash is not blindly repeated: before sending a
+// message again the worker queries the gateway for the order and records the
+// existing outcome if the first attempt went through.
+package outbox
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/mdwt/addpay-go/types"
+)
+
+// Kind is the gateway operation a message calls
+type Kind string
+
+const (
+	KindHostedCheckout Kind = "hosted_checkout"
+	KindTokenizedPay   Kind = "tokenized_pay"
+	KindRefund         Kind = "refund"
+)
+
+// Status is the delivery state of a message
+type Status string
+
+const (
+	StatusPending  Status = "pending"  // not yet sent
+	StatusInFlight Status = "inflight" // sent at least once; the outcome is not known
+	StatusDone     Status = "done"     // the gateway accepted the call and Result holds its response
+	StatusFailed   Status = "failed"   // the gateway rejected the call or attempts ran out
+)
+
+// Final reports whether the message will not be sent again
+func (s Status) Final() bool {
+	return s == StatusDone || s == StatusFailed
+}
+
+// Message is a gateway call recorded in the outbox
+type Message struct {
+	ID              string          `json:"id"`
+	Kind            Kind            `json:"kind"`
+	MerchantOrderNo string          `json:"merchant_order_no"`
+	Payload         json.RawMessage `json:"payload"` // the request, as JSON
+	Status          Status          `json:"status"`
+	Attempts        int             `json:"attempts"`
+	Result          json.RawMessage `json:"result,omitempty"` // the response, as JSON
+	Recovered       bool            `json:"recovered,omitempty"`
+	LastError       string          `json:"last_error,omitempty"`
+	CreatedAt       time.Time       `json:"created_at"`
+	UpdatedAt       time.Time       `json:"updated_at"`
+	NextAttemptAt   time.Time       `json:"next_attempt_at"`
+}
+
+// HostedCheckout returns a message that creates a hosted checkout. An
+// ExpiresAt or ExpiresIn expiry is fixed when the message is created, since
+// the message may be sent much later.
+func HostedCheckout(req types.CheckoutRequest) (Message, error) {
+	expires, err := req.ExpiresUnix(time.Now())
+	if err != nil {
+		return Message{}, fmt.Errorf("invalid checkout expiry: %w", err)
+	}
+	req.Expires, req.ExpiresAt, req.ExpiresIn = expires, time.Time{}, 0
+	return newMessage(KindHostedCheckout, req.MerchantOrderNo, "", req)
+}
+
+// TokenizedPay returns a message that charges a card token
+func TokenizedPay(req types.TokenizedPayRequest) (Message, error) {
+	return newMessage(KindTokenizedPay, req.MerchantOrderNo, "", req)
+}
+
+// Refund returns a message that refunds an order
+func Refund(req types.RefundRequest) (Message, error) {
+	return newMessage(KindRefund, req.MerchantOrderNo, req.RefundNo, req)
+}
+
+// newMessage builds a pending message. The ID is derived from the order and
+// refund numbers so the same call cannot be recorded twice.
+func newMessage(kind Kind, orderNo, refundNo string, req interface{}) (Message, error) {
+	if orderNo == "" {
+		return Message{}, fmt.Errorf("%s message has no merchant order number", kind)
+	}
+	payload, err := json.Marshal(req)
+	if err != nil {
+		return Message{}, fmt.Errorf("failed to encode %s request: %w", kind, err)
+	}
+
+	id := string(kind) + ":" + orderNo
+	if refundNo != "" {
+		id += ":" + refundNo
+	}
+	now := time.Now()
+	return Message{
+		ID:              id,
+		Kind:            kind,
+		MerchantOrderNo: orderNo,
+		Payload:         payload,
+		Status:          StatusPending,
+		CreatedAt:       now,
+		UpdatedAt:       now,
+		NextAttemptAt:   now,
+	}, nil
+}
+
+// DecodeResult unmarshals the recorded response into v. A checkout or
+// payment recovered by querying the gateway holds a types.QueryOrderResponse
+// rather than the response of its own call.
+func (m Message) DecodeResult(v interface{}) error {
+	if len(m.Result) == 0 {
+		return fmt.Errorf("message %s has no result", m.ID)
+	}
+	if err := json.Unmarshal(m.Result, v); err != nil {
+		return fmt.Errorf("failed to decode result of %s: %w", m.ID, err)
+	}
+	return nil
+}
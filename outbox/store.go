@@ -0,0 +1,303 @@
+package outbox
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/mdwt/addpay-go/sqlbind"
+)
+
+// ErrNotFound is returned for a message the store does not hold
+var ErrNotFound = errors.New("outbox message not found")
+
+// ErrLeaseLost is returned by Save when another worker claimed the message
+// after its lease ran out
+var ErrLeaseLost = errors.New("outbox lease lost")
+
+// Store holds outbox messages for a Worker
+type Store interface {
+	// Due returns up to limit messages that are not final and whose next
+	// attempt is at or before now, oldest first
+	Due(ctx context.Context, now time.Time, limit int) ([]Message, error)
+	// Claim marks m in flight until leaseUntil and increments its attempts,
+	// reporting false if another worker changed it since it was read
+	Claim(ctx context.Context, m Message, leaseUntil time.Time) (bool, error)
+	// Save records the status, result and error of a claimed message. It
+	// returns ErrLeaseLost if the message was claimed again since, leaving
+	// the newer claim in place.
+	Save(ctx context.Context, m Message) error
+	// Get returns a message or ErrNotFound
+	Get(ctx context.Context, id string) (Message, error)
+}
+
+// MemoryStore is an in-process Store for tests. It cannot share a
+// transaction with business data, so production services use SQLStore.
+type MemoryStore struct {
+	mu       sync.Mutex
+	messages map[string]Message
+}
+
+// NewMemoryStore creates an empty in-memory store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{messages: make(map[string]Message)}
+}
+
+// Enqueue adds a message
+func (s *MemoryStore) Enqueue(ctx context.Context, m Message) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.messages[m.ID]; ok {
+		return fmt.Errorf("outbox message %s already exists", m.ID)
+	}
+	s.messages[m.ID] = m
+	return nil
+}
+
+// Due returns the messages ready to be attempted
+func (s *MemoryStore) Due(ctx context.Context, now time.Time, limit int) ([]Message, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var due []Message
+	for _, m := range s.messages {
+		if !m.Status.Final() && !m.NextAttemptAt.After(now) {
+			due = append(due, m)
+		}
+	}
+	sort.Slice(due, func(i, j int) bool { return due[i].CreatedAt.Before(due[j].CreatedAt) })
+	if len(due) > limit {
+		due = due[:limit]
+	}
+	return due, nil
+}
+
+// Claim leases a message to the caller
+func (s *MemoryStore) Claim(ctx context.Context, m Message, leaseUntil time.Time) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	current, ok := s.messages[m.ID]
+	if !ok {
+		return false, fmt.Errorf("%w: %s", ErrNotFound, m.ID)
+	}
+	if current.Attempts != m.Attempts || current.Status.Final() {
+		return false, nil
+	}
+	current.Status = StatusInFlight
+	current.Attempts++
+	current.NextAttemptAt = leaseUntil
+	current.UpdatedAt = time.Now()
+	s.messages[m.ID] = current
+	return true, nil
+}
+
+// Save records the outcome of a message
+func (s *MemoryStore) Save(ctx context.Context, m Message) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	current, ok := s.messages[m.ID]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrNotFound, m.ID)
+	}
+	if current.Attempts != m.Attempts {
+		return fmt.Errorf("%w: %s", ErrLeaseLost, m.ID)
+	}
+	s.messages[m.ID] = m
+	return nil
+}
+
+// Get returns a message
+func (s *MemoryStore) Get(ctx context.Context, id string) (Message, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	m, ok := s.messages[id]
+	if !ok {
+		return Message{}, fmt.Errorf("%w: %s", ErrNotFound, id)
+	}
+	return m, nil
+}
+
+// SQLStore is a Store backed by a database table in the same database as the
+// service's own data; CreateTable creates it. Times are stored as Unix seconds.
+type SQLStore struct {
+	db    *sql.DB
+	table string
+	style sqlbind.Style
+}
+
+// NewSQLStore creates a store using table in db with "?" placeholders
+func NewSQLStore(db *sql.DB, table string) (SQLStore, error) {
+	if err := sqlbind.CheckIdentifier(table); err != nil {
+		return SQLStore{}, err
+	}
+	return SQLStore{db: db, table: table, style: sqlbind.Question}, nil
+}
+
+// WithBindStyle returns a copy of the store that uses the driver's placeholder style
+func (s SQLStore) WithBindStyle(style sqlbind.Style) SQLStore {
+	s.style = style
+	return s
+}
+
+// columns lists the table columns in the order they are written and scanned
+const columns = "id, kind, merchant_order_no, payload, status, attempts, result, recovered, " +
+	"last_error, created_at, updated_at, next_attempt_at"
+
+// CreateTable creates the table if it does not exist
+func (s SQLStore) CreateTable(ctx context.Context) error {
+	_, err := s.db.ExecContext(ctx, "CREATE TABLE IF NOT EXISTS "+s.table+` (
+		id VARCHAR(255) NOT NULL PRIMARY KEY,
+		kind VARCHAR(32) NOT NULL,
+		merchant_order_no VARCHAR(64) NOT NULL,
+		payload TEXT NOT NULL,
+		status VARCHAR(16) NOT NULL,
+		attempts INTEGER NOT NULL,
+		result TEXT NOT NULL,
+		recovered INTEGER NOT NULL,
+		last_error TEXT NOT NULL,
+		created_at BIGINT NOT NULL,
+		updated_at BIGINT NOT NULL,
+		next_attempt_at BIGINT NOT NULL)`)
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", s.table, err)
+	}
+	return nil
+}
+
+// Enqueue inserts m as part of tx, so the call is recorded only if the
+// service's own changes in tx are committed
+func (s SQLStore) Enqueue(ctx context.Context, tx *sql.Tx, m Message) error {
+	_, err := tx.ExecContext(ctx, s.style.Rebind("INSERT INTO "+s.table+" ("+columns+
+		") VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)"),
+		m.ID, string(m.Kind), m.MerchantOrderNo, string(m.Payload), string(m.Status), m.Attempts,
+		string(m.Result), boolInt(m.Recovered), m.LastError,
+		m.CreatedAt.Unix(), m.UpdatedAt.Unix(), m.NextAttemptAt.Unix())
+	if err != nil {
+		return fmt.Errorf("failed to enqueue %s: %w", m.ID, err)
+	}
+	return nil
+}
+
+// Due returns the messages ready to be attempted. Rows are read until limit
+// is reached rather than with LIMIT, which not every database supports.
+func (s SQLStore) Due(ctx context.Context, now time.Time, limit int) ([]Message, error) {
+	rows, err := s.db.QueryContext(ctx, s.style.Rebind("SELECT "+columns+" FROM "+s.table+
+		" WHERE status IN (?, ?) AND next_attempt_at <= ? ORDER BY created_at"),
+		string(StatusPending), string(StatusInFlight), now.Unix())
+	if err != nil {
+		return nil, fmt.Errorf("failed to read outbox: %w", err)
+	}
+	defer rows.Close()
+
+	var due []Message
+	for len(due) < limit && rows.Next() {
+		m, err := scanMessage(rows)
+		if err != nil {
+			return nil, err
+		}
+		due = append(due, m)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read outbox: %w", err)
+	}
+	return due, nil
+}
+
+// Claim leases a message to the caller
+func (s SQLStore) Claim(ctx context.Context, m Message, leaseUntil time.Time) (bool, error) {
+	result, err := s.db.ExecContext(ctx, s.style.Rebind("UPDATE "+s.table+
+		" SET status = ?, attempts = ?, next_attempt_at = ?, updated_at = ?"+
+		" WHERE id = ? AND attempts = ? AND status IN (?, ?)"),
+		string(StatusInFlight), m.Attempts+1, leaseUntil.Unix(), time.Now().Unix(),
+		m.ID, m.Attempts, string(StatusPending), string(StatusInFlight))
+	if err != nil {
+		return false, fmt.Errorf("failed to claim %s: %w", m.ID, err)
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to claim %s: %w", m.ID, err)
+	}
+	return rows > 0, nil
+}
+
+// Save records the outcome of a message, provided no other worker claimed it
+// since
+func (s SQLStore) Save(ctx context.Context, m Message) error {
+	result, err := s.db.ExecContext(ctx, s.style.Rebind("UPDATE "+s.table+
+		" SET status = ?, result = ?, recovered = ?, last_error = ?, updated_at = ?, next_attempt_at = ?"+
+		" WHERE id = ? AND attempts = ?"),
+		string(m.Status), string(m.Result), boolInt(m.Recovered), m.LastError,
+		m.UpdatedAt.Unix(), m.NextAttemptAt.Unix(), m.ID, m.Attempts)
+	if err != nil {
+		return fmt.Errorf("failed to save %s: %w", m.ID, err)
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to save %s: %w", m.ID, err)
+	}
+	if rows > 0 {
+		return nil
+	}
+
+	// Nothing was updated: either the message is gone or it was claimed again
+	if _, err := s.Get(ctx, m.ID); err != nil {
+		return err
+	}
+	return fmt.Errorf("%w: %s", ErrLeaseLost, m.ID)
+}
+
+// Get returns a message
+func (s SQLStore) Get(ctx context.Context, id string) (Message, error) {
+	rows, err := s.db.QueryContext(ctx, s.style.Rebind("SELECT "+columns+" FROM "+s.table+" WHERE id = ?"), id)
+	if err != nil {
+		return Message{}, fmt.Errorf("failed to read %s: %w", id, err)
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		if err := rows.Err(); err != nil {
+			return Message{}, fmt.Errorf("failed to read %s: %w", id, err)
+		}
+		return Message{}, fmt.Errorf("%w: %s", ErrNotFound, id)
+	}
+	return scanMessage(rows)
+}
+
+// scanMessage reads a message from the current row
+func scanMessage(rows *sql.Rows) (Message, error) {
+	var m Message
+	var kind, status, payload, result string
+	var recovered int
+	var createdAt, updatedAt, nextAttemptAt int64
+	if err := rows.Scan(&m.ID, &kind, &m.MerchantOrderNo, &payload, &status, &m.Attempts,
+		&result, &recovered, &m.LastError, &createdAt, &updatedAt, &nextAttemptAt); err != nil {
+		return Message{}, fmt.Errorf("failed to read outbox message: %w", err)
+	}
+	m.Kind = Kind(kind)
+	m.Status = Status(status)
+	m.Payload = []byte(payload)
+	if result != "" {
+		m.Result = []byte(result)
+	}
+	m.Recovered = recovered != 0
+	m.CreatedAt = time.Unix(createdAt, 0)
+	m.UpdatedAt = time.Unix(updatedAt, 0)
+	m.NextAttemptAt = time.Unix(nextAttemptAt, 0)
+	return m, nil
+}
+
+// boolInt stores a bool as 0 or 1, which every database accepts
+func boolInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
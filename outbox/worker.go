@@ -0,0 +1,356 @@
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/mdwt/addpay-go/client"
+	"github.com/mdwt/addpay-go/logger"
+	"github.com/mdwt/addpay-go/types"
+)
+
+const (
+	defaultBatchSize   = 50
+	defaultLease       = 2 * time.Minute
+	defaultMaxAttempts = 10
+	maxBackoff         = 10 * time.Minute
+)
+
+// OutcomeFunc is called once a message is done or has failed, for example to
+// record the result on the service's own order
+type OutcomeFunc func(ctx context.Context, m Message) error
+
+// Worker dispatches outbox messages through a client
+type Worker struct {
+	store       Store
+	client      client.Client
+	logger      types.Logger
+	lease       time.Duration
+	maxAttempts int
+	notFound    func(error) bool
+	onOutcome   OutcomeFunc
+}
+
+// NewWorker creates a worker that sends the messages in store through c
+func NewWorker(store Store, c client.Client) Worker {
+	return Worker{
+		store:       store,
+		client:      c,
+		logger:      logger.NewNoOpLogger(),
+		lease:       defaultLease,
+		maxAttempts: defaultMaxAttempts,
+		notFound:    OrderNotFound,
+	}
+}
+
+// SetLogger returns a copy of the worker that logs to l
+func (w Worker) SetLogger(l types.Logger) Worker {
+	w.logger = l
+	return w
+}
+
+// WithLease returns a copy of the worker that holds claimed messages for d.
+// A message whose worker crashed is recovered once its lease ends, so d must
+// be longer than a gateway call can take.
+func (w Worker) WithLease(d time.Duration) Worker {
+	w.lease = d
+	return w
+}
+
+// WithMaxAttempts returns a copy of the worker that marks a message failed
+// after n attempts whose outcome could not be established
+func (w Worker) WithMaxAttempts(n int) Worker {
+	w.maxAttempts = n
+	return w
+}
+
+// WithNotFound returns a copy of the worker that uses fn to recognise the
+// gateway error for an unknown order or refund during recovery
+func (w Worker) WithNotFound(fn func(error) bool) Worker {
+	w.notFound = fn
+	return w
+}
+
+// OnOutcome returns a copy of the worker that calls fn for every message
+// that is done or has failed
+func (w Worker) OnOutcome(fn OutcomeFunc) Worker {
+	w.onOutcome = fn
+	return w
+}
+
+// OrderNotFound reports whether err is a gateway error saying the order or
+// refund does not exist
+func OrderNotFound(err error) bool {
+	var apiErr types.APIError
+	if !errors.As(err, &apiErr) {
+		return false
+	}
+	code := strings.ToUpper(apiErr.Code)
+	return strings.Contains(code, "NOT_FOUND") || strings.Contains(code, "NOT_EXIST")
+}
+
+// Run processes due messages every interval until ctx is done
+func (w Worker) Run(ctx context.Context, interval time.Duration) error {
+	log := logger.WithContext(w.logger, ctx)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := w.RunOnce(ctx); err != nil {
+			log.Error("Outbox run failed", "error", err.Error())
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// RunOnce processes the messages that are due and returns how many it
+// attempted
+func (w Worker) RunOnce(ctx context.Context) (int, error) {
+	log := logger.WithContext(w.logger, ctx)
+	due, err := w.store.Due(ctx, time.Now(), defaultBatchSize)
+	if err != nil {
+		return 0, err
+	}
+
+	processed := 0
+	for _, m := range due {
+		if ctx.Err() != nil {
+			return processed, ctx.Err()
+		}
+		claimed, err := w.store.Claim(ctx, m, time.Now().Add(w.lease))
+		if err != nil {
+			log.Error("Failed to claim outbox message", "id", m.ID, "error", err.Error())
+			continue
+		}
+		if !claimed {
+			continue
+		}
+		m.Status = StatusInFlight
+		m.Attempts++
+		w.process(ctx, m)
+		processed++
+	}
+	return processed, nil
+}
+
+// process sends a claimed message, first checking with the gateway whether
+// an earlier attempt already went through
+func (w Worker) process(ctx context.Context, m Message) {
+	log := logger.WithContext(w.logger, ctx)
+	if m.Attempts > 1 {
+		result, found, err := w.recover(ctx, m)
+		if err != nil {
+			w.retry(ctx, m, fmt.Errorf("failed to recover: %w", err))
+			return
+		}
+		if found {
+			log.Info("Recovered outbox message from the gateway",
+				"id", m.ID,
+				"merchant_order_no", m.MerchantOrderNo)
+			m.Recovered = true
+			w.finish(ctx, m, StatusDone, result, "")
+			return
+		}
+	}
+
+	log.Info("Dispatching outbox message",
+		"id", m.ID,
+		"kind", m.Kind,
+		"attempt", m.Attempts)
+
+	result, err := w.dispatch(ctx, m)
+	if err == nil {
+		w.finish(ctx, m, StatusDone, result, "")
+		return
+	}
+
+	// The gateway answered with an error, so the call was not carried out
+	var apiErr types.APIError
+	if errors.As(err, &apiErr) {
+		w.finish(ctx, m, StatusFailed, nil, err.Error())
+		return
+	}
+	w.retry(ctx, m, err)
+}
+
+// orderRef holds the fields every message payload has in common
+type orderRef struct {
+	MerchantNo      string `json:"merchant_no"`
+	StoreNo         string `json:"store_no"`
+	MerchantOrderNo string `json:"merchant_order_no"`
+}
+
+// recover queries the gateway for the order of m and reports whether the
+// call of m already took effect
+func (w Worker) recover(ctx context.Context, m Message) (json.RawMessage, bool, error) {
+	if m.Kind == KindRefund {
+		return w.recoverRefund(ctx, m)
+	}
+
+	var ref orderRef
+	if err := json.Unmarshal(m.Payload, &ref); err != nil {
+		return nil, false, fmt.Errorf("failed to decode payload: %w", err)
+	}
+
+	// An existing order proves the checkout or payment was created
+	order, err := w.client.QueryOrder(ctx, types.QueryOrderRequest{
+		MerchantNo:      ref.MerchantNo,
+		StoreNo:         ref.StoreNo,
+		MerchantOrderNo: ref.MerchantOrderNo,
+	})
+	if err != nil {
+		if w.notFound(err) {
+			return nil, false, nil
+		}
+		return nil, false, err
+	}
+
+	result, err := json.Marshal(order)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to encode order: %w", err)
+	}
+	return result, true, nil
+}
+
+// recoverRefund queries the gateway for the refund number of m. The order
+// status can't tell one refund of an order from another, so only the
+// gateway's record of this refund proves it went through.
+func (w Worker) recoverRefund(ctx context.Context, m Message) (json.RawMessage, bool, error) {
+	var req types.RefundRequest
+	if err := json.Unmarshal(m.Payload, &req); err != nil {
+		return nil, false, fmt.Errorf("failed to decode payload: %w", err)
+	}
+
+	refund, err := w.client.QueryRefund(ctx, types.QueryRefundRequest{
+		MerchantNo:      req.MerchantNo,
+		StoreNo:         req.StoreNo,
+		MerchantOrderNo: req.MerchantOrderNo,
+		RefundNo:        req.RefundNo,
+	})
+	if err != nil {
+		if w.notFound(err) {
+			return nil, false, nil
+		}
+		return nil, false, err
+	}
+	if refund.RefundNo != req.RefundNo {
+		return nil, false, fmt.Errorf("gateway returned refund %q for %q", refund.RefundNo, req.RefundNo)
+	}
+
+	result, err := json.Marshal(refund)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to encode refund: %w", err)
+	}
+	return result, true, nil
+}
+
+// dispatch makes the gateway call of m and returns its response as JSON
+func (w Worker) dispatch(ctx context.Context, m Message) (json.RawMessage, error) {
+	var response interface{}
+	var err error
+	switch m.Kind {
+	case KindHostedCheckout:
+		var req types.CheckoutRequest
+		if err := json.Unmarshal(m.Payload, &req); err != nil {
+			return nil, fmt.Errorf("failed to decode payload: %w", err)
+		}
+		response, err = w.client.HostedCheckout(ctx, req)
+	case KindTokenizedPay:
+		var req types.TokenizedPayRequest
+		if err := json.Unmarshal(m.Payload, &req); err != nil {
+			return nil, fmt.Errorf("failed to decode payload: %w", err)
+		}
+		response, err = w.client.TokenizedPay(ctx, req)
+	case KindRefund:
+		var req types.RefundRequest
+		if err := json.Unmarshal(m.Payload, &req); err != nil {
+			return nil, fmt.Errorf("failed to decode payload: %w", err)
+		}
+		response, err = w.client.Refund(ctx, req)
+	default:
+		return nil, fmt.Errorf("unknown outbox message kind %q", m.Kind)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := json.Marshal(response)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode response: %w", err)
+	}
+	return result, nil
+}
+
+// finish records the final outcome of m
+func (w Worker) finish(ctx context.Context, m Message, status Status, result json.RawMessage, lastError string) {
+	log := logger.WithContext(w.logger, ctx)
+	m.Status = status
+	m.Result = result
+	m.LastError = lastError
+	m.UpdatedAt = time.Now()
+	if err := w.store.Save(ctx, m); err != nil {
+		if errors.Is(err, ErrLeaseLost) {
+			// Another worker claimed the message and records its own outcome
+			log.Warn("Outbox lease lost, outcome not recorded",
+				"id", m.ID,
+				"status", status)
+			return
+		}
+		// The lease runs out and recovery records the outcome later
+		log.Error("Failed to record outbox outcome",
+			"id", m.ID,
+			"status", status,
+			"error", err.Error())
+		return
+	}
+
+	if status == StatusFailed {
+		log.Warn("Outbox message failed", "id", m.ID, "error", lastError)
+	} else {
+		log.Info("Outbox message done", "id", m.ID, "recovered", m.Recovered)
+	}
+
+	if w.onOutcome != nil {
+		if err := w.onOutcome(ctx, m); err != nil {
+			log.Error("Outbox outcome handler failed", "id", m.ID, "error", err.Error())
+		}
+	}
+}
+
+// retry schedules another attempt of m, whose outcome is not known, or fails
+// it once attempts run out
+func (w Worker) retry(ctx context.Context, m Message, err error) {
+	log := logger.WithContext(w.logger, ctx)
+	if m.Attempts >= w.maxAttempts {
+		w.finish(ctx, m, StatusFailed, nil, err.Error())
+		return
+	}
+
+	m.LastError = err.Error()
+	m.UpdatedAt = time.Now()
+	m.NextAttemptAt = m.UpdatedAt.Add(backoff(m.Attempts))
+	log.Warn("Outbox message will be retried",
+		"id", m.ID,
+		"attempt", m.Attempts,
+		"next_attempt_at", m.NextAttemptAt,
+		"error", m.LastError)
+	if err := w.store.Save(ctx, m); err != nil {
+		log.Error("Failed to reschedule outbox message", "id", m.ID, "error", err.Error())
+	}
+}
+
+// backoff doubles the delay with each attempt, up to maxBackoff
+func backoff(attempts int) time.Duration {
+	if attempts > 10 {
+		return maxBackoff
+	}
+	return min(time.Duration(1<<attempts)*time.Second, maxBackoff)
+}
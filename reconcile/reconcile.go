@@ -0,0 +1,302 @@
+// Package reconcile matches the orders a merchant submitted against the
+// notifications received and the settlement lines paid out, and reports the
+// differences for the finance team.
+package reconcile
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mdwt/addpay-go/client"
+	"github.com/mdwt/addpay-go/settlement"
+	"github.com/mdwt/addpay-go/types"
+)
+
+// Kind classifies a discrepancy
+type Kind string
+
+const (
+	PaidNotSettled      Kind = "paid_not_settled"      // paid, but no settlement line
+	SettledWithoutOrder Kind = "settled_without_order" // settlement line for an order not in the ledger
+	AmountMismatch      Kind = "amount_mismatch"       // notified or settled amount differs from the ledger
+	CurrencyMismatch    Kind = "currency_mismatch"     // notified or settled currency differs from the ledger
+	MissingWebhook      Kind = "missing_webhook"       // paid, but no paid notification was received
+)
+
+// LedgerEntry is an order recorded in the merchant's own books
+type LedgerEntry struct {
+	MerchantOrderNo string  `json:"merchant_order_no"`
+	Amount          float64 `json:"amount"`
+	Currency        string  `json:"currency,omitempty"`
+}
+
+// Input holds the three sources to reconcile
+type Input struct {
+	Ledger        []LedgerEntry
+	Notifications []types.Notification
+	Settlements   []settlement.Record
+}
+
+// Discrepancy is one difference between the sources
+type Discrepancy struct {
+	Kind            Kind     `json:"kind"`
+	MerchantOrderNo string   `json:"merchant_order_no"`
+	LedgerAmount    *float64 `json:"ledger_amount,omitempty"`
+	NotifiedAmount  *float64 `json:"notified_amount,omitempty"`
+	SettledAmount   *float64 `json:"settled_amount,omitempty"`
+	RefundedAmount  *float64 `json:"refunded_amount,omitempty"`
+	Detail          string   `json:"detail"`
+}
+
+// Report is the outcome of a reconciliation
+type Report struct {
+	GeneratedAt   time.Time     `json:"generated_at"`
+	Orders        int           `json:"orders"`
+	Matched       int           `json:"matched"`
+	Discrepancies []Discrepancy `json:"discrepancies"`
+}
+
+// Reconcile matches the ledger against notifications and settlement lines.
+// An order counts as paid when a notification or settlement line says so.
+// Refund lines are totalled apart from the payment they refund, so only a
+// refund larger than the payment is reported.
+func Reconcile(in Input) Report {
+	return reconcile(in, nil)
+}
+
+// ReconcileWithClient is like Reconcile, but also queries the gateway for
+// ledger orders with no paid notification, so orders paid at the gateway
+// whose webhook never arrived are found before they settle
+func ReconcileWithClient(ctx context.Context, c client.Client, in Input) (Report, error) {
+	paid := paidNotifications(in.Notifications)
+	queried := make(map[string]types.QueryOrderResponse)
+	for _, entry := range in.Ledger {
+		if _, ok := paid[entry.MerchantOrderNo]; ok {
+			continue
+		}
+		order, err := c.QueryOrder(ctx, types.QueryOrderRequest{MerchantOrderNo: entry.MerchantOrderNo})
+		if err != nil {
+			return Report{}, fmt.Errorf("failed to query order %s: %w", entry.MerchantOrderNo, err)
+		}
+		queried[entry.MerchantOrderNo] = order
+	}
+	return reconcile(in, queried), nil
+}
+
+// settledOrder totals the settlement lines of one order
+type settledOrder struct {
+	paid     float64 // gross amount of the payment lines
+	refunded float64 // gross amount of the refund lines, as a positive number
+	payment  bool    // a payment line was seen
+	currency string
+}
+
+// reconcile builds the report, using order query results where available
+func reconcile(in Input, queried map[string]types.QueryOrderResponse) Report {
+	report := Report{GeneratedAt: time.Now().UTC(), Orders: len(in.Ledger), Discrepancies: []Discrepancy{}}
+
+	paid := paidNotifications(in.Notifications)
+	refunded := refundedOrders(in.Notifications)
+
+	// Orders may settle over several lines, such as a payment and a refund
+	settled := make(map[string]*settledOrder)
+	for _, record := range in.Settlements {
+		order := settled[record.MerchantOrderNo]
+		if order == nil {
+			order = &settledOrder{}
+			settled[record.MerchantOrderNo] = order
+		}
+		if record.Refund() {
+			order.refunded += math.Abs(record.GrossAmount)
+		} else {
+			order.paid += record.GrossAmount
+			order.payment = true
+		}
+		if order.currency == "" {
+			order.currency = record.Currency
+		}
+	}
+
+	inLedger := make(map[string]bool, len(in.Ledger))
+	for _, entry := range in.Ledger {
+		orderNo := entry.MerchantOrderNo
+		inLedger[orderNo] = true
+
+		ledgerAmount := entry.Amount
+		notification, notified := paid[orderNo]
+		lines, hasLines := settled[orderNo]
+		isSettled := hasLines && lines.payment
+		order, wasQueried := queried[orderNo]
+		paidAtGateway := wasQueried && isPaid(order.OrderStatus)
+
+		found := len(report.Discrepancies)
+		add := func(kind Kind, detail string) {
+			d := Discrepancy{Kind: kind, MerchantOrderNo: orderNo, LedgerAmount: &ledgerAmount, Detail: detail}
+			if notified {
+				amount := notifiedAmount(notification)
+				d.NotifiedAmount = &amount
+			}
+			if isSettled {
+				amount := lines.paid
+				d.SettledAmount = &amount
+			}
+			if hasLines && lines.refunded > 0 {
+				amount := lines.refunded
+				d.RefundedAmount = &amount
+			}
+			report.Discrepancies = append(report.Discrepancies, d)
+		}
+
+		// A refund notification also shows the order was paid
+		if (notified || refunded[orderNo] || paidAtGateway) && !isSettled {
+			add(PaidNotSettled, "order is paid but has no settlement line")
+		}
+		if (isSettled || refunded[orderNo] || paidAtGateway) && !notified {
+			add(MissingWebhook, "order is paid but no paid notification was received")
+		}
+		if notified && !sameAmount(notifiedAmount(notification), ledgerAmount) {
+			add(AmountMismatch, "notified amount differs from the ledger")
+		}
+		if isSettled && !sameAmount(lines.paid, ledgerAmount) {
+			add(AmountMismatch, "settled amount differs from the ledger")
+		}
+		if hasLines && lines.refunded > 0 && math.Round(lines.refunded*100) > math.Round(ledgerAmount*100) {
+			add(AmountMismatch, "refunded amount exceeds the ledger amount")
+		}
+		if notified && !sameCurrency(notification.PriceCurrency, entry.Currency) {
+			add(CurrencyMismatch, "notified currency "+notification.PriceCurrency+" differs from the ledger")
+		}
+		if hasLines && !sameCurrency(lines.currency, entry.Currency) {
+			add(CurrencyMismatch, "settled currency "+lines.currency+" differs from the ledger")
+		}
+
+		if len(report.Discrepancies) == found && notified && isSettled {
+			report.Matched++
+		}
+	}
+
+	for orderNo, lines := range settled {
+		if !inLedger[orderNo] {
+			d := Discrepancy{
+				Kind:            SettledWithoutOrder,
+				MerchantOrderNo: orderNo,
+				Detail:          "settlement line has no order in the ledger",
+			}
+			if lines.payment {
+				amount := lines.paid
+				d.SettledAmount = &amount
+			}
+			if lines.refunded > 0 {
+				amount := lines.refunded
+				d.RefundedAmount = &amount
+			}
+			report.Discrepancies = append(report.Discrepancies, d)
+		}
+	}
+
+	sort.SliceStable(report.Discrepancies, func(i, j int) bool {
+		a, b := report.Discrepancies[i], report.Discrepancies[j]
+		if a.Kind != b.Kind {
+			return a.Kind < b.Kind
+		}
+		return a.MerchantOrderNo < b.MerchantOrderNo
+	})
+	return report
+}
+
+// paidNotifications returns the payment notification of each paid order.
+// Refund notifications carry the refunded amount, so they are left out.
+func paidNotifications(notifications []types.Notification) map[string]types.Notification {
+	paid := make(map[string]types.Notification)
+	for _, n := range notifications {
+		if types.ParsePaymentStatus(n.OrderStatus) != types.PaymentPaid {
+			continue
+		}
+		if current, ok := paid[n.MerchantOrderNo]; !ok || n.Timestamp > current.Timestamp {
+			paid[n.MerchantOrderNo] = n
+		}
+	}
+	return paid
+}
+
+// refundedOrders returns the orders with a refund notification
+func refundedOrders(notifications []types.Notification) map[string]bool {
+	refunded := make(map[string]bool)
+	for _, n := range notifications {
+		if types.ParsePaymentStatus(n.OrderStatus) == types.PaymentRefunded {
+			refunded[n.MerchantOrderNo] = true
+		}
+	}
+	return refunded
+}
+
+// isPaid reports whether a gateway status means the customer paid. A
+// refunded order was paid first.
+func isPaid(orderStatus string) bool {
+	status := types.ParsePaymentStatus(orderStatus)
+	return status == types.PaymentPaid || status == types.PaymentRefunded
+}
+
+// notifiedAmount is the amount a notification says was paid
+func notifiedAmount(n types.Notification) float64 {
+	if n.PaidAmount != 0 {
+		return n.PaidAmount
+	}
+	return n.OrderAmount
+}
+
+// sameAmount compares two amounts to the cent
+func sameAmount(a, b float64) bool {
+	return math.Round(a*100) == math.Round(b*100)
+}
+
+// sameCurrency compares two currency codes, treating a missing one as a match
+func sameCurrency(a, b string) bool {
+	return a == "" || b == "" || strings.EqualFold(a, b)
+}
+
+// WriteJSON writes the report as indented JSON
+func (r Report) WriteJSON(w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(r)
+}
+
+// WriteCSV writes the discrepancies as CSV with a header row
+func (r Report) WriteCSV(w io.Writer) error {
+	writer := csv.NewWriter(w)
+	if err := writer.Write([]string{"kind", "merchant_order_no", "ledger_amount", "notified_amount", "settled_amount", "refunded_amount", "detail"}); err != nil {
+		return err
+	}
+	for _, d := range r.Discrepancies {
+		if err := writer.Write([]string{
+			string(d.Kind),
+			d.MerchantOrderNo,
+			formatAmount(d.LedgerAmount),
+			formatAmount(d.NotifiedAmount),
+			formatAmount(d.SettledAmount),
+			formatAmount(d.RefundedAmount),
+			d.Detail,
+		}); err != nil {
+			return err
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+// formatAmount formats an optional amount with two decimals
+func formatAmount(amount *float64) string {
+	if amount == nil {
+		return ""
+	}
+	return strconv.FormatFloat(*amount, 'f', 2, 64)
+}
@@ -0,0 +1,308 @@
+// Package redact masks card numbers, account numbers, tokens, email addresses
+// and phone numbers before they reach logs, error messages or debug output.
+//
+// A Redactor applies two kinds of rule. Key rules mask the whole value of a
+// named field, whether it is passed as a log attribute, a parameter map entry
+// or written as key=value or "key":"value" inside a string. Pattern rules find
+// sensitive values anywhere in free text, such as a response body.
+package redact
+
+import (
+	"fmt"
+	"log/slog"
+	"regexp"
+	"strings"
+
+	"github.com/mdwt/addpay-go/types"
+)
+
+// Rule masks one kind of sensitive value. It is declared in types so that
+// Config.RedactRules can hold rules.
+type Rule = types.RedactRule
+
+// Redactor applies a set of rules. The zero value masks nothing.
+type Redactor struct {
+	rules []compiledRule
+}
+
+// compiledRule is a rule with its key lookup and key=value pattern prepared
+type compiledRule struct {
+	Rule
+	keys     map[string]bool
+	keyValue *regexp.Regexp
+}
+
+var (
+	panPattern   = regexp.MustCompile(`\b[2-6](?:[ -]?\d){12,18}\b`) // card schemes start with 2 to 6
+	emailPattern = regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`)
+	phonePattern = regexp.MustCompile(`\+\d(?:[ -]?\d){7,14}\b`)
+)
+
+// DefaultRules returns the rules used by Default
+func DefaultRules() []Rule {
+	return []Rule{
+		{Name: "secret", Keys: []string{"sign", "signature", "private_key", "passphrase", "password", "secret", "client_secret", "api_key", "authorization"}, Mask: Full},
+		{Name: "token", Keys: []string{"token", "access_token", "refresh_token", "card_token"}, Mask: Last4},
+		{Name: "account_number", Keys: []string{"account_number", "account_no", "bank_account", "iban"}, Mask: Last4},
+		{Name: "pan", Keys: []string{"card_number", "card_no", "pan"}, Pattern: panPattern, Mask: PAN},
+		{Name: "email", Keys: []string{"email", "email_address"}, Pattern: emailPattern, Mask: Email},
+		{Name: "phone", Keys: []string{"phone", "phone_number", "mobile", "msisdn"}, Pattern: phonePattern, Mask: Phone},
+	}
+}
+
+// Default returns a redactor with the built-in rules
+func Default() Redactor {
+	return New(DefaultRules()...)
+}
+
+// New creates a redactor with only the given rules
+func New(rules ...Rule) Redactor {
+	return Redactor{}.WithRules(rules...)
+}
+
+// WithRules returns a copy of the redactor that also applies rules
+func (r Redactor) WithRules(rules ...Rule) Redactor {
+	compiled := append([]compiledRule(nil), r.rules...)
+	for _, rule := range rules {
+		if rule.Mask == nil {
+			rule.Mask = Full
+		}
+		c := compiledRule{Rule: rule, keys: make(map[string]bool, len(rule.Keys))}
+		quoted := make([]string, 0, len(rule.Keys))
+		for _, key := range rule.Keys {
+			c.keys[normalizeKey(key)] = true
+			quoted = append(quoted, regexp.QuoteMeta(key))
+		}
+		if len(quoted) > 0 {
+			c.keyValue = regexp.MustCompile(`(?i)(["']?\b(?:` + strings.Join(quoted, "|") + `)["']?\s*[:=]\s*["']?)([^"'&\s,}]+)`)
+		}
+		compiled = append(compiled, c)
+	}
+	r.rules = compiled
+	return r
+}
+
+// normalizeKey lowercases a field name and treats dashes as underscores
+func normalizeKey(key string) string {
+	return strings.ReplaceAll(strings.ToLower(key), "-", "_")
+}
+
+// ruleFor returns the key rule for key, if any
+func (r Redactor) ruleFor(key string) (compiledRule, bool) {
+	key = normalizeKey(key)
+	for _, rule := range r.rules {
+		if rule.keys[key] {
+			return rule, true
+		}
+	}
+	return compiledRule{}, false
+}
+
+// String masks every sensitive value found in s
+func (r Redactor) String(s string) string {
+	for _, rule := range r.rules {
+		// Patterns go first so a value with separators is masked whole
+		if rule.Pattern != nil {
+			s = rule.Pattern.ReplaceAllStringFunc(s, rule.Mask)
+		}
+		if rule.keyValue != nil {
+			s = rule.keyValue.ReplaceAllStringFunc(s, func(match string) string {
+				parts := rule.keyValue.FindStringSubmatch(match)
+				return parts[1] + rule.Mask(parts[2])
+			})
+		}
+	}
+	return s
+}
+
+// Value masks v as the value of field key. Values of a key rule are masked
+// whole; strings, errors and parameter maps are searched for sensitive values
+// and anything else is returned unchanged.
+func (r Redactor) Value(key string, v interface{}) interface{} {
+	if rule, ok := r.ruleFor(key); ok && v != nil {
+		text := fmt.Sprint(v)
+		if text == "" {
+			return text
+		}
+		return rule.Mask(text)
+	}
+
+	switch v := v.(type) {
+	case string:
+		return r.String(v)
+	case []byte:
+		return r.String(string(v))
+	case error:
+		return r.Error(v)
+	case map[string]interface{}:
+		return r.Params(v)
+	case map[string]string:
+		masked := make(map[string]string, len(v))
+		for k, value := range v {
+			masked[k], _ = r.Value(k, value).(string)
+		}
+		return masked
+	case slog.Attr:
+		return r.Attr(v)
+	}
+	return v
+}
+
+// Params returns a copy of params with sensitive values masked
+func (r Redactor) Params(params map[string]interface{}) map[string]interface{} {
+	if params == nil {
+		return nil
+	}
+	masked := make(map[string]interface{}, len(params))
+	for key, value := range params {
+		masked[key] = r.Value(key, value)
+	}
+	return masked
+}
+
+// Attr masks a slog attribute, descending into groups
+func (r Redactor) Attr(a slog.Attr) slog.Attr {
+	return slog.Attr{Key: a.Key, Value: r.slogValue(a.Key, a.Value)}
+}
+
+// slogValue masks a slog value logged under key
+func (r Redactor) slogValue(key string, v slog.Value) slog.Value {
+	v = v.Resolve()
+	if v.Kind() != slog.KindGroup {
+		return slog.AnyValue(r.Value(key, v.Any()))
+	}
+	attrs := v.Group()
+	masked := make([]slog.Attr, len(attrs))
+	for i, a := range attrs {
+		masked[i] = r.Attr(a)
+	}
+	return slog.GroupValue(masked...)
+}
+
+// KeyValues masks alternating keys and values as passed to a logger. Attrs
+// mixed in with the pairs are masked as well.
+func (r Redactor) KeyValues(keysAndValues []interface{}) []interface{} {
+	masked := make([]interface{}, 0, len(keysAndValues))
+	for i := 0; i < len(keysAndValues); i++ {
+		switch key := keysAndValues[i].(type) {
+		case slog.Attr:
+			masked = append(masked, r.Attr(key))
+		case string:
+			if i+1 == len(keysAndValues) {
+				masked = append(masked, key)
+				continue
+			}
+			masked = append(masked, key, r.Value(key, keysAndValues[i+1]))
+			i++
+		default:
+			masked = append(masked, key)
+		}
+	}
+	return masked
+}
+
+// Error returns err with sensitive values masked in its message. The masked
+// error still unwraps to err, so errors.Is and errors.As keep working.
+func (r Redactor) Error(err error) error {
+	if err == nil {
+		return nil
+	}
+	message := err.Error()
+	masked := r.String(message)
+	if masked == message {
+		return err
+	}
+	return &redactedError{message: masked, err: err}
+}
+
+// redactedError carries a masked message for an underlying error
+type redactedError struct {
+	message string
+	err     error
+}
+
+func (e *redactedError) Error() string { return e.message }
+
+func (e *redactedError) Unwrap() error { return e.err }
+
+// Full replaces the whole value
+func Full(string) string {
+	return "[REDACTED]"
+}
+
+// Last4 keeps the last four characters of values long enough that they do
+// not give the value away
+func Last4(s string) string {
+	if len(s) < 8 {
+		return "****"
+	}
+	return "****" + s[len(s)-4:]
+}
+
+// PAN keeps the first six and last four digits of a card number, the most
+// PCI DSS allows to be displayed. Digit runs that fail the Luhn check are
+// not card numbers and are returned unchanged.
+func PAN(s string) string {
+	digits := make([]byte, 0, len(s))
+	for i := 0; i < len(s); i++ {
+		if s[i] >= '0' && s[i] <= '9' || s[i] == '*' {
+			digits = append(digits, s[i])
+		}
+	}
+	if len(digits) < 13 {
+		return Full(s)
+	}
+	if !strings.Contains(string(digits), "*") && !luhn(digits) {
+		return s
+	}
+	return string(digits[:6]) + strings.Repeat("*", len(digits)-10) + string(digits[len(digits)-4:])
+}
+
+// luhn reports whether digits pass the Luhn checksum
+func luhn(digits []byte) bool {
+	sum := 0
+	double := false
+	for i := len(digits) - 1; i >= 0; i-- {
+		d := int(digits[i] - '0')
+		if double {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		double = !double
+	}
+	return sum%10 == 0
+}
+
+// Email keeps the first character of the local part and the domain
+func Email(s string) string {
+	at := strings.LastIndex(s, "@")
+	if at < 1 {
+		return Full(s)
+	}
+	return s[:1] + "***" + s[at:]
+}
+
+// Phone masks every digit of a phone number but the last three, keeping any
+// leading plus sign and separators
+func Phone(s string) string {
+	total := 0
+	for i := 0; i < len(s); i++ {
+		if s[i] >= '0' && s[i] <= '9' {
+			total++
+		}
+	}
+	masked := []byte(s)
+	seen := 0
+	for i := range masked {
+		if masked[i] >= '0' && masked[i] <= '9' {
+			seen++
+			if seen <= total-3 {
+				masked[i] = '*'
+			}
+		}
+	}
+	return string(masked)
+}
@@ -0,0 +1,231 @@
+// Package registry manages AddPay clients for many tenants, each with its
+// own AppID and RSA key pair.
+package registry
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/mdwt/addpay-go/client"
+	"github.com/mdwt/addpay-go/types"
+)
+
+// KeyProvider supplies the configuration, including key material, for a
+// tenant. The registry copies the returned MerchantPrivateKey, so a provider
+// may hand out the same cached Config on every load.
+type KeyProvider interface {
+	Load(ctx context.Context, tenant string) (types.Config, error)
+}
+
+// KeyProviderFunc adapts a function to the KeyProvider interface
+type KeyProviderFunc func(ctx context.Context, tenant string) (types.Config, error)
+
+// Load calls f(ctx, tenant)
+func (f KeyProviderFunc) Load(ctx context.Context, tenant string) (types.Config, error) {
+	return f(ctx, tenant)
+}
+
+// Registry holds one client per tenant. Clients are created lazily on first
+// use and can be reloaded at runtime. It is safe for concurrent use.
+//
+// The registry wipes its copy of the MerchantPrivateKey once the client has
+// parsed it, so GetConfig on a registry client does not expose the raw key.
+type Registry struct {
+	provider KeyProvider
+
+	mu      sync.RWMutex
+	clients map[string]client.Client
+	loading map[string]*pendingLoad
+
+	// Every load is numbered as it starts, and stored records the number of
+	// the load each client came from, so a slow load never replaces the
+	// client of a later one
+	loads  uint64
+	stored map[string]uint64
+}
+
+// pendingLoad lets concurrent callers share a single in-flight load
+type pendingLoad struct {
+	done   chan struct{}
+	client client.Client
+	err    error
+}
+
+// New creates a registry backed by the given key provider
+func New(provider KeyProvider) *Registry {
+	return &Registry{
+		provider: provider,
+		clients:  make(map[string]client.Client),
+		loading:  make(map[string]*pendingLoad),
+		stored:   make(map[string]uint64),
+	}
+}
+
+// Get returns the client for a tenant, loading it from the provider if
+// needed. Concurrent callers share one load, which carries on when a caller
+// gives up, so ctx only bounds how long this caller waits.
+func (r *Registry) Get(ctx context.Context, tenant string) (client.Client, error) {
+	r.mu.RLock()
+	c, ok := r.clients[tenant]
+	r.mu.RUnlock()
+	if ok {
+		return c, nil
+	}
+
+	r.mu.Lock()
+	if c, ok := r.clients[tenant]; ok {
+		r.mu.Unlock()
+		return c, nil
+	}
+	if pending, ok := r.loading[tenant]; ok {
+		r.mu.Unlock()
+		return pending.wait(ctx)
+	}
+	pending := &pendingLoad{done: make(chan struct{})}
+	r.loading[tenant] = pending
+	load := r.nextLoad()
+	r.mu.Unlock()
+
+	go r.load(context.WithoutCancel(ctx), tenant, load, pending)
+	return pending.wait(ctx)
+}
+
+// load runs a shared load for Get and hands the result to its waiters
+func (r *Registry) load(ctx context.Context, tenant string, load uint64, pending *pendingLoad) {
+	c, err := r.build(ctx, tenant)
+
+	r.mu.Lock()
+	delete(r.loading, tenant)
+	if err == nil {
+		c = r.store(tenant, load, c)
+	}
+	pending.client, pending.err = c, err
+	r.mu.Unlock()
+	close(pending.done)
+}
+
+// Reload fetches fresh configuration for a tenant and swaps its client.
+// If loading fails the previous client stays in place.
+func (r *Registry) Reload(ctx context.Context, tenant string) error {
+	r.mu.Lock()
+	load := r.nextLoad()
+	r.mu.Unlock()
+
+	c, err := r.build(ctx, tenant)
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	r.store(tenant, load, c)
+	r.mu.Unlock()
+	return nil
+}
+
+// ReloadAll reloads every loaded tenant, returning the first error encountered
+func (r *Registry) ReloadAll(ctx context.Context) error {
+	var firstErr error
+	for _, tenant := range r.Tenants() {
+		if err := r.Reload(ctx, tenant); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// Watch reloads all loaded tenants every interval until ctx is cancelled.
+// Reload errors are passed to onError, which may be nil.
+func (r *Registry) Watch(ctx context.Context, interval time.Duration, onError func(error)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := r.ReloadAll(ctx); err != nil && onError != nil {
+				onError(err)
+			}
+		}
+	}
+}
+
+// Remove drops the client for a tenant
+func (r *Registry) Remove(tenant string) {
+	r.mu.Lock()
+	delete(r.clients, tenant)
+	delete(r.stored, tenant)
+	r.mu.Unlock()
+}
+
+// Tenants returns the loaded tenant IDs in sorted order
+func (r *Registry) Tenants() []string {
+	r.mu.RLock()
+	tenants := make([]string, 0, len(r.clients))
+	for tenant := range r.clients {
+		tenants = append(tenants, tenant)
+	}
+	r.mu.RUnlock()
+
+	sort.Strings(tenants)
+	return tenants
+}
+
+// nextLoad numbers a load as it starts. The caller must hold r.mu.
+func (r *Registry) nextLoad() uint64 {
+	r.loads++
+	return r.loads
+}
+
+// store caches c as the client of tenant unless a load that started later
+// already stored one, and returns the client the tenant now has. The caller
+// must hold r.mu.
+func (r *Registry) store(tenant string, load uint64, c client.Client) client.Client {
+	if current, ok := r.clients[tenant]; ok && r.stored[tenant] > load {
+		return current
+	}
+	r.clients[tenant] = c
+	r.stored[tenant] = load
+	return c
+}
+
+// build loads a tenant configuration and creates its client. The client is
+// given a copy of the private key, wiped once parsed so it does not linger
+// in memory; the provider's bytes are left alone.
+func (r *Registry) build(ctx context.Context, tenant string) (client.Client, error) {
+	config, err := r.provider.Load(ctx, tenant)
+	if err != nil {
+		return client.Client{}, fmt.Errorf("failed to load config for tenant %s: %w", tenant, err)
+	}
+	if config.MerchantPrivateKey != nil {
+		config.MerchantPrivateKey = append([]byte(nil), config.MerchantPrivateKey...)
+		defer wipe(config.MerchantPrivateKey)
+	}
+
+	c, err := client.New(config)
+	if err != nil {
+		return client.Client{}, fmt.Errorf("failed to create client for tenant %s: %w", tenant, err)
+	}
+	return c, nil
+}
+
+// wait blocks until the in-flight load completes or ctx is cancelled
+func (p *pendingLoad) wait(ctx context.Context) (client.Client, error) {
+	select {
+	case <-p.done:
+		return p.client, p.err
+	case <-ctx.Done():
+		return client.Client{}, ctx.Err()
+	}
+}
+
+// wipe zeroes secret key material in place
+func wipe(secret []byte) {
+	for i := range secret {
+		secret[i] = 0
+	}
+}
@@ -0,0 +1,208 @@
+// Package settlement parses the settlement reports returned by
+// Client.DownloadSettlementReport one line at a time, so reports of any size
+// can be processed without loading them into memory.
+package settlement
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"iter"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Record is one settled transaction
+type Record struct {
+	MerchantOrderNo string    `json:"merchant_order_no"`
+	TransactionID   string    `json:"transaction_id,omitempty"`
+	StoreNo         string    `json:"store_no,omitempty"`
+	Currency        string    `json:"currency,omitempty"`
+	Type            string    `json:"type,omitempty"` // e.g. PAYMENT or REFUND, when the report has the column
+	GrossAmount     float64   `json:"gross_amount"`
+	Fees            float64   `json:"fees"`
+	NetAmount       float64   `json:"net_amount"`
+	SettlementDate  time.Time `json:"settlement_date"`
+}
+
+// Refund reports whether the line pays back a refund rather than settling a
+// payment: its type says so, or its gross amount is negative
+func (r Record) Refund() bool {
+	return strings.Contains(strings.ToUpper(r.Type), "REFUND") || r.GrossAmount < 0
+}
+
+// columns maps each record field to the header names it may appear under
+var columns = map[string][]string{
+	"merchant_order_no": {"merchant_order_no", "order_no", "merchant order no"},
+	"transaction_id":    {"transaction_id", "trans_id", "transaction id"},
+	"store_no":          {"store_no", "store no"},
+	"currency":          {"currency", "price_currency"},
+	"type":              {"type", "transaction_type", "trans_type", "transaction type"},
+	"gross_amount":      {"gross_amount", "gross", "order_amount", "gross amount"},
+	"fees":              {"fees", "fee", "fee_amount", "fees amount"},
+	"net_amount":        {"net_amount", "net", "settlement_amount", "net amount"},
+	"settlement_date":   {"settlement_date", "settle_date", "settlement date"},
+}
+
+// required lists the columns a report must have
+var required = []string{"merchant_order_no", "gross_amount", "fees", "net_amount", "settlement_date"}
+
+// dateLayouts are the settlement date formats accepted
+var dateLayouts = []string{"2006-01-02", "20060102", "2006-01-02 15:04:05", time.RFC3339, "2006/01/02"}
+
+// ParseError reports a malformed line in a report
+type ParseError struct {
+	Line   int
+	Column string
+	Err    error
+}
+
+func (e ParseError) Error() string {
+	return fmt.Sprintf("settlement report line %d, column %s: %v", e.Line, e.Column, e.Err)
+}
+
+func (e ParseError) Unwrap() error {
+	return e.Err
+}
+
+// Records parses a CSV settlement report from r. The first line is the
+// header; columns are matched by name, so their order does not matter and
+// extra columns are ignored. Parsing stops at the first error.
+func Records(r io.Reader) iter.Seq2[Record, error] {
+	return func(yield func(Record, error) bool) {
+		reader := csv.NewReader(r)
+		reader.FieldsPerRecord = -1
+		reader.ReuseRecord = true
+		reader.TrimLeadingSpace = true
+
+		header, err := reader.Read()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return
+			}
+			yield(Record{}, fmt.Errorf("failed to read settlement report header: %w", err))
+			return
+		}
+		index, err := columnIndex(header)
+		if err != nil {
+			yield(Record{}, err)
+			return
+		}
+
+		for {
+			row, err := reader.Read()
+			if errors.Is(err, io.EOF) {
+				return
+			}
+			if err != nil {
+				yield(Record{}, fmt.Errorf("failed to read settlement report: %w", err))
+				return
+			}
+			line, _ := reader.FieldPos(0)
+			if blank(row) {
+				continue
+			}
+
+			record, err := parseRow(row, index, line)
+			if !yield(record, err) || err != nil {
+				return
+			}
+		}
+	}
+}
+
+// columnIndex finds the position of every known column in header
+func columnIndex(header []string) (map[string]int, error) {
+	index := make(map[string]int)
+	for i, name := range header {
+		name = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")))
+		for field, aliases := range columns {
+			for _, alias := range aliases {
+				if name == alias {
+					if _, seen := index[field]; !seen {
+						index[field] = i
+					}
+				}
+			}
+		}
+	}
+
+	for _, field := range required {
+		if _, ok := index[field]; !ok {
+			return nil, fmt.Errorf("settlement report has no %s column", field)
+		}
+	}
+	return index, nil
+}
+
+// parseRow converts one CSV row into a record
+func parseRow(row []string, index map[string]int, line int) (Record, error) {
+	get := func(field string) string {
+		i, ok := index[field]
+		if !ok || i >= len(row) {
+			return ""
+		}
+		return strings.TrimSpace(row[i])
+	}
+
+	record := Record{
+		MerchantOrderNo: get("merchant_order_no"),
+		TransactionID:   get("transaction_id"),
+		StoreNo:         get("store_no"),
+		Currency:        get("currency"),
+		Type:            get("type"),
+	}
+
+	amounts := []struct {
+		field string
+		dest  *float64
+	}{
+		{"gross_amount", &record.GrossAmount},
+		{"fees", &record.Fees},
+		{"net_amount", &record.NetAmount},
+	}
+	for _, amount := range amounts {
+		value, err := parseAmount(get(amount.field))
+		if err != nil {
+			return Record{}, ParseError{Line: line, Column: amount.field, Err: err}
+		}
+		*amount.dest = value
+	}
+
+	date, err := parseDate(get("settlement_date"))
+	if err != nil {
+		return Record{}, ParseError{Line: line, Column: "settlement_date", Err: err}
+	}
+	record.SettlementDate = date
+	return record, nil
+}
+
+// parseAmount parses a decimal amount, allowing thousands separators
+func parseAmount(value string) (float64, error) {
+	if value == "" {
+		return 0, nil
+	}
+	return strconv.ParseFloat(strings.ReplaceAll(value, ",", ""), 64)
+}
+
+// parseDate parses a settlement date in any of the accepted layouts
+func parseDate(value string) (time.Time, error) {
+	for _, layout := range dateLayouts {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("unrecognised date %q", value)
+}
+
+// blank reports whether every field of row is empty
+func blank(row []string) bool {
+	for _, field := range row {
+		if strings.TrimSpace(field) != "" {
+			return false
+		}
+	}
+	return true
+}
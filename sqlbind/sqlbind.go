@@ -0,0 +1,55 @@
+// Package sqlbind rewrites the "?" placeholders used by the SQL stores in
+// this module into the bind style of the target database driver.
+package sqlbind
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Style is a bind parameter syntax
+type Style int
+
+const (
+	Question Style = iota // ? (MySQL, SQLite)
+	Dollar                // $1 (PostgreSQL)
+	AtP                   // @p1 (SQL Server)
+)
+
+// Rebind converts the "?" placeholders in query to style s
+func (s Style) Rebind(query string) string {
+	if s == Question {
+		return query
+	}
+
+	var b strings.Builder
+	n := 0
+	for _, r := range query {
+		if r != '?' {
+			b.WriteRune(r)
+			continue
+		}
+		n++
+		if s == Dollar {
+			b.WriteString("$")
+		} else {
+			b.WriteString("@p")
+		}
+		b.WriteString(strconv.Itoa(n))
+	}
+	return b.String()
+}
+
+// CheckIdentifier rejects table names that are not plain, optionally
+// schema-qualified SQL identifiers, since they are inserted into queries
+func CheckIdentifier(name string) error {
+	if !identifier.MatchString(name) {
+		return fmt.Errorf("invalid SQL identifier %q", name)
+	}
+	return nil
+}
+
+// identifier matches a plain or schema-qualified SQL identifier
+var identifier = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*(\.[A-Za-z_][A-Za-z0-9_]*)?$`)
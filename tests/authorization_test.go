@@ -0,0 +1,94 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/mdwt/addpay-go/client"
+	"github.com/mdwt/addpay-go/types"
+)
+
+func TestAuthorizeCaptureVoid(t *testing.T) {
+	expiresAt := time.Now().Add(7 * 24 * time.Hour).Unix()
+
+	remaining := 0.0
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		form := r.PostForm
+		switch r.URL.Path {
+		case "/authorize":
+			remaining, _ = strconv.ParseFloat(form.Get("order_amount"), 64)
+			w.Write([]byte(`{"success":true,"data":{"transaction_id":"TX-1","auth_status":"AUTHORIZED","authorized_amount":` +
+				form.Get("order_amount") + `,"expires_at":` + strconv.FormatInt(expiresAt, 10) + `}}`))
+		case "/capture":
+			if form.Get("merchant_order_no") == "EXPIRED" {
+				w.Write([]byte(`{"success":true,"data":{"auth_status":"EXPIRED"}}`))
+				return
+			}
+			amount := remaining
+			status := "CAPTURED"
+			if form.Has("capture_amount") {
+				amount, _ = strconv.ParseFloat(form.Get("capture_amount"), 64)
+				if amount < remaining {
+					status = "PARTIALLY_CAPTURED"
+				}
+			}
+			remaining -= amount
+			w.Write([]byte(`{"success":true,"data":{"capture_no":"` + form.Get("capture_no") + `","auth_status":"` + status +
+				`","captured_amount":` + strconv.FormatFloat(amount, 'f', 2, 64) + `,"remaining_amount":` + strconv.FormatFloat(remaining, 'f', 2, 64) + `}}`))
+		case "/void":
+			w.Write([]byte(`{"success":true,"data":{"transaction_id":"TX-2","auth_status":"VOIDED"}}`))
+		default:
+			http.NotFound(w, r)
+		}
+	})
+
+	c := newTestClient(t, handler)
+	ctx := context.Background()
+
+	auth, err := c.Authorize(ctx, types.AuthorizeRequest{MerchantOrderNo: "RENTAL-1", Token: "tok", PriceCurrency: "ZAR", OrderAmount: 500})
+	if err != nil {
+		t.Fatalf("Authorize() error = %v", err)
+	}
+	if auth.AuthStatus != types.AuthStatusAuthorized || !auth.AuthStatus.Capturable() || auth.AuthorizedAmount != 500 {
+		t.Errorf("Authorize() = %+v", auth)
+	}
+	if auth.Expired(time.Now()) || !auth.Expired(auth.Expiry()) {
+		t.Errorf("Expired() does not follow ExpiresAt %d", auth.ExpiresAt)
+	}
+
+	partial, err := c.Capture(ctx, types.CaptureRequest{MerchantOrderNo: "RENTAL-1", CaptureNo: "CAP-1", CaptureAmount: 200})
+	if err != nil {
+		t.Fatalf("Capture() partial error = %v", err)
+	}
+	if partial.AuthStatus != types.AuthStatusPartiallyCaptured || partial.RemainingAmount != 300 || !partial.AuthStatus.Capturable() {
+		t.Errorf("Capture() partial = %+v", partial)
+	}
+
+	full, err := c.Capture(ctx, types.CaptureRequest{MerchantOrderNo: "RENTAL-1", CaptureNo: "CAP-2"})
+	if err != nil {
+		t.Fatalf("Capture() full error = %v", err)
+	}
+	if full.AuthStatus != types.AuthStatusCaptured || full.CapturedAmount != 300 || !full.AuthStatus.Final() {
+		t.Errorf("Capture() full = %+v", full)
+	}
+
+	if expired, err := c.Capture(ctx, types.CaptureRequest{MerchantOrderNo: "EXPIRED", CaptureNo: "CAP-3"}); !errors.Is(err, client.ErrAuthorizationExpired) || expired != (types.CaptureResponse{}) {
+		t.Errorf("Capture() of a lapsed authorization = %+v, %v, want a zero response and ErrAuthorizationExpired", expired, err)
+	}
+	if _, err := c.Capture(ctx, types.CaptureRequest{MerchantOrderNo: "RENTAL-1", CaptureAmount: -1}); err == nil {
+		t.Error("Capture() accepted a negative amount")
+	}
+
+	void, err := c.Void(ctx, types.VoidRequest{MerchantOrderNo: "RENTAL-2", Reason: "car returned early"})
+	if err != nil {
+		t.Fatalf("Void() error = %v", err)
+	}
+	if void.AuthStatus != types.AuthStatusVoided || !void.AuthStatus.Final() {
+		t.Errorf("Void() = %+v", void)
+	}
+}
@@ -0,0 +1,75 @@
+package tests
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/mdwt/addpay-go/auth"
+	"github.com/mdwt/addpay-go/checkout"
+	"github.com/mdwt/addpay-go/types"
+)
+
+func TestVerifyReturn(t *testing.T) {
+	merchantKey, _ := generateTestKeys(t)
+	gatewayPrivate, gatewayPublic := generateTestKeys(t)
+	gateway, err := auth.NewRSAAuth(gatewayPrivate, gatewayPublic)
+	if err != nil {
+		t.Fatalf("NewRSAAuth() error = %v", err)
+	}
+
+	queries := 0
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		queries++
+		r.ParseForm()
+		if r.URL.Path != "/query-order" || r.PostForm.Get("merchant_order_no") != "ORDER-2" {
+			t.Errorf("unexpected request %s %v", r.URL.Path, r.PostForm)
+		}
+		w.Write([]byte(`{"success":true,"data":{"merchant_order_no":"ORDER-2","transaction_id":"TX-2","order_status":"PENDING","order_amount":50}}`))
+	})
+
+	client := newTestClientWithConfig(t, handler, types.Config{
+		MerchantPrivateKey: merchantKey,
+		GatewayPublicKey:   gatewayPublic,
+	})
+	verifier := checkout.NewVerifier(client)
+
+	// Signed return parameters are trusted without a gateway round trip
+	signed := signForm(t, gateway, map[string]interface{}{
+		"merchant_order_no": "ORDER-1",
+		"transaction_id":    "TX-1",
+		"order_status":      "SUCCESS",
+		"order_amount":      "99.99",
+	})
+	result, err := verifier.VerifyReturn(httptest.NewRequest(http.MethodGet, "/return?"+signed.Encode(), nil))
+	if err != nil {
+		t.Fatalf("VerifyReturn() signed error = %v", err)
+	}
+	if !result.Paid() || result.Source != checkout.SourceSignature || result.MerchantOrderNo != "ORDER-1" || result.OrderAmount != 99.99 {
+		t.Errorf("VerifyReturn() signed = %+v", result)
+	}
+
+	// A customer editing the query string does not get a paid result
+	signed.Set("order_status", "SUCCESS")
+	signed.Set("order_amount", "0.01")
+	if _, err := verifier.VerifyReturn(httptest.NewRequest(http.MethodGet, "/return?"+signed.Encode(), nil)); err == nil {
+		t.Error("VerifyReturn() accepted tampered parameters")
+	}
+
+	// Unsigned parameters fall back to querying the order
+	result, err = verifier.VerifyReturn(httptest.NewRequest(http.MethodGet, "/return?merchant_order_no=ORDER-2&order_status=SUCCESS", nil))
+	if err != nil {
+		t.Fatalf("VerifyReturn() unsigned error = %v", err)
+	}
+	if result.Paid() || result.Status != checkout.StatusPending || result.Source != checkout.SourceOrderQuery {
+		t.Errorf("VerifyReturn() unsigned = %+v, want pending from the order query", result)
+	}
+
+	if _, err := verifier.VerifyReturn(httptest.NewRequest(http.MethodGet, "/return", nil)); !errors.Is(err, checkout.ErrMissingOrderNo) {
+		t.Errorf("VerifyReturn() without order error = %v, want ErrMissingOrderNo", err)
+	}
+	if queries != 1 {
+		t.Errorf("gateway queried %d times, want 1", queries)
+	}
+}
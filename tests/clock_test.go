@@ -0,0 +1,143 @@
+package tests
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/mdwt/addpay-go/client"
+	"github.com/mdwt/addpay-go/types"
+)
+
+// recordingLogger keeps the messages logged at warn level
+type recordingLogger struct {
+	mu    sync.Mutex
+	warns []string
+}
+
+func (l *recordingLogger) Debug(msg string, keysAndValues ...interface{}) {}
+func (l *recordingLogger) Info(msg string, keysAndValues ...interface{})  {}
+func (l *recordingLogger) Error(msg string, keysAndValues ...interface{}) {}
+
+func (l *recordingLogger) Warn(msg string, keysAndValues ...interface{}) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.warns = append(l.warns, msg)
+}
+
+// newSkewedGateway serves checkouts from a clock ahead of the local one by
+// skew, rejecting timestamps more than a minute off. Without sendDate the
+// responses carry no Date header.
+func newSkewedGateway(t *testing.T, skew time.Duration, sendDate bool, requests *int32, expires *int64) (client.Client, *recordingLogger) {
+	t.Helper()
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(requests, 1)
+		gatewayNow := time.Now().Add(skew)
+		if sendDate {
+			w.Header().Set("Date", gatewayNow.UTC().Format(http.TimeFormat))
+		} else {
+			w.Header()["Date"] = nil
+		}
+
+		r.ParseForm()
+		timestamp, _ := strconv.ParseInt(r.PostForm.Get("timestamp"), 10, 64)
+		if d := gatewayNow.Sub(time.Unix(timestamp, 0)); d > time.Minute || d < -time.Minute {
+			w.Write([]byte(`{"success":false,"error":{"code":"INVALID_TIMESTAMP","message":"request timestamp expired"}}`))
+			return
+		}
+		*expires, _ = strconv.ParseInt(r.PostForm.Get("expires"), 10, 64)
+		w.Write([]byte(`{"success":true,"data":{"pay_url":"https://pay.example/1"}}`))
+	})
+
+	log := &recordingLogger{}
+	c := newTestClientWithConfig(t, handler, types.Config{
+		Logger: log,
+	})
+	return c, log
+}
+
+func TestClockSkewCompensation(t *testing.T) {
+	var requests int32
+	var expires int64
+	skew := 10 * time.Minute
+	c, log := newSkewedGateway(t, skew, true, &requests, &expires)
+
+	// The first request is rejected, measures the skew and is retried
+	_, err := c.HostedCheckout(context.Background(), types.CheckoutRequest{MerchantOrderNo: "SKEW-1", ExpiresIn: time.Hour})
+	if err != nil {
+		t.Fatalf("HostedCheckout() error = %v", err)
+	}
+	if requests != 2 {
+		t.Errorf("requests = %d, want a rejected request and one retry", requests)
+	}
+	if offset := c.ClockOffset(); offset < skew-2*time.Second || offset > skew+2*time.Second {
+		t.Errorf("ClockOffset() = %v, want about %v", offset, skew)
+	}
+	if len(log.warns) == 0 || !strings.Contains(log.warns[0], "clock") {
+		t.Errorf("warnings = %v, want the skew reported", log.warns)
+	}
+
+	// ExpiresIn is measured on the gateway clock
+	want := time.Now().Add(skew + time.Hour).Unix()
+	if expires < want-5 || expires > want+5 {
+		t.Errorf("expires = %d, want about %d", expires, want)
+	}
+
+	// Later requests are signed with the corrected clock straight away
+	c.HostedCheckout(context.Background(), types.CheckoutRequest{MerchantOrderNo: "SKEW-2"})
+	if requests != 3 {
+		t.Errorf("requests = %d, want no further rejection", requests)
+	}
+}
+
+func TestClockSkewWithoutDate(t *testing.T) {
+	var requests int32
+	var expires int64
+	c, log := newSkewedGateway(t, -10*time.Minute, false, &requests, &expires)
+
+	_, err := c.HostedCheckout(context.Background(), types.CheckoutRequest{MerchantOrderNo: "SKEW-3"})
+	if err == nil || !strings.Contains(err.Error(), "timestamp") {
+		t.Fatalf("HostedCheckout() error = %v, want the timestamp rejection", err)
+	}
+	if requests != 1 || c.ClockOffset() != 0 {
+		t.Errorf("requests = %d, offset = %v, want no retry without a measured offset", requests, c.ClockOffset())
+	}
+	if len(log.warns) != 1 {
+		t.Errorf("warnings = %v, want a clock warning", log.warns)
+	}
+}
+
+func TestCheckoutExpiry(t *testing.T) {
+	var requests int32
+	var expires int64
+	c, _ := newSkewedGateway(t, 0, true, &requests, &expires)
+	ctx := context.Background()
+
+	at := time.Now().Add(30 * time.Minute).Truncate(time.Second)
+	if _, err := c.HostedCheckout(ctx, types.CheckoutRequest{MerchantOrderNo: "EXP-1", ExpiresAt: at}); err != nil {
+		t.Fatalf("HostedCheckout() error = %v", err)
+	}
+	if expires != at.Unix() {
+		t.Errorf("expires = %d, want %d", expires, at.Unix())
+	}
+
+	invalid := []types.CheckoutRequest{
+		{MerchantOrderNo: "EXP-2", Expires: at.Unix(), ExpiresIn: time.Hour},
+		{MerchantOrderNo: "EXP-3", ExpiresAt: time.Now().Add(-time.Minute)},
+		{MerchantOrderNo: "EXP-4", ExpiresIn: -time.Minute},
+	}
+	for _, req := range invalid {
+		if _, err := c.HostedCheckout(ctx, req); err == nil {
+			t.Errorf("HostedCheckout(%s) accepted an invalid expiry", req.MerchantOrderNo)
+		}
+	}
+	if requests != 1 {
+		t.Errorf("requests = %d, want invalid expiries rejected before sending", requests)
+	}
+}
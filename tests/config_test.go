@@ -0,0 +1,150 @@
+package tests
+
+import (
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mdwt/addpay-go/config"
+	"github.com/mdwt/addpay-go/types"
+)
+
+func TestConfigFromLookup(t *testing.T) {
+	privateKey, publicKey := generateTestKeys(t)
+
+	dir := t.TempDir()
+	keyPath := filepath.Join(dir, "gateway.pem")
+	if err := os.WriteFile(keyPath, publicKey, 0o600); err != nil {
+		t.Fatalf("Failed to write key file: %v", err)
+	}
+
+	env := map[string]string{
+		config.EnvAppID:                "app-123",
+		config.EnvEndpoint:             "https://api.example.com",
+		config.EnvFailoverEndpoints:    "https://eu.example.com, https://us.example.com",
+		config.EnvMerchantNo:           "M001",
+		config.EnvStoreNo:              "S001",
+		config.EnvTimeout:              "15s",
+		config.EnvPrivateKeyPKCS1:      string(privateKey),
+		config.EnvGatewayPublicKeyFile: keyPath,
+	}
+
+	cfg, err := config.FromLookup(func(name string) (string, bool) {
+		value, ok := env[name]
+		return value, ok
+	})
+	if err != nil {
+		t.Fatalf("FromLookup() unexpected error = %v", err)
+	}
+
+	if cfg.AppID != "app-123" || cfg.MerchantNo != "M001" || cfg.StoreNo != "S001" {
+		t.Errorf("FromLookup() identifiers = %s/%s/%s", cfg.AppID, cfg.MerchantNo, cfg.StoreNo)
+	}
+	if cfg.Timeout != 15*time.Second {
+		t.Errorf("Timeout = %v, want 15s", cfg.Timeout)
+	}
+	if len(cfg.FailoverURLs) != 2 || cfg.FailoverURLs[1] != "https://us.example.com" {
+		t.Errorf("FailoverURLs = %v", cfg.FailoverURLs)
+	}
+	if string(cfg.GatewayPublicKey) != string(publicKey) {
+		t.Error("GatewayPublicKey was not loaded from file")
+	}
+	if strings.TrimSpace(string(cfg.MerchantPrivateKey)) != strings.TrimSpace(string(privateKey)) {
+		t.Error("MerchantPrivateKey was not loaded from environment")
+	}
+}
+
+func TestConfigFromFile(t *testing.T) {
+	privateKey, publicKey := generateTestKeys(t)
+
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "merchant.pem"), privateKey, 0o600); err != nil {
+		t.Fatalf("Failed to write key file: %v", err)
+	}
+
+	var gatewayKey strings.Builder
+	for _, line := range strings.Split(strings.TrimSpace(string(publicKey)), "\n") {
+		gatewayKey.WriteString("  " + line + "\n")
+	}
+
+	yamlConfig := `# AddPay configuration
+app_id: "app-123"
+environment: production
+merchant_no: M001 # default merchant
+store_no: 'S001'
+timeout: 20s
+failover_urls:
+  - https://eu.example.com
+merchant_private_key_file: merchant.pem
+gateway_public_key: |
+` + gatewayKey.String()
+
+	jsonConfig := `{
+  "app_id": "app-123",
+  "environment": "production",
+  "merchant_no": "M001",
+  "store_no": "S001",
+  "timeout": "20s",
+  "failover_urls": ["https://eu.example.com"],
+  "merchant_private_key_file": "merchant.pem",
+  "gateway_public_key": ` + strconvQuote(string(publicKey)) + `
+}`
+
+	for name, content := range map[string]string{"addpay.yaml": yamlConfig, "addpay.json": jsonConfig} {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(dir, name)
+			if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+				t.Fatalf("Failed to write config file: %v", err)
+			}
+
+			cfg, err := config.FromFile(path)
+			if err != nil {
+				t.Fatalf("FromFile() unexpected error = %v", err)
+			}
+
+			if cfg.AppID != "app-123" || cfg.Environment != types.Production {
+				t.Errorf("FromFile() app = %s, environment = %s", cfg.AppID, cfg.Environment)
+			}
+			if cfg.MerchantNo != "M001" || cfg.StoreNo != "S001" {
+				t.Errorf("FromFile() merchant = %s, store = %s", cfg.MerchantNo, cfg.StoreNo)
+			}
+			if cfg.Timeout != 20*time.Second {
+				t.Errorf("Timeout = %v, want 20s", cfg.Timeout)
+			}
+			if len(cfg.FailoverURLs) != 1 || cfg.FailoverURLs[0] != "https://eu.example.com" {
+				t.Errorf("FailoverURLs = %v", cfg.FailoverURLs)
+			}
+			if string(cfg.MerchantPrivateKey) != string(privateKey) {
+				t.Error("MerchantPrivateKey was not loaded from file")
+			}
+			if strings.TrimSpace(string(cfg.GatewayPublicKey)) != strings.TrimSpace(string(publicKey)) {
+				t.Errorf("GatewayPublicKey = %q", cfg.GatewayPublicKey)
+			}
+		})
+	}
+}
+
+// TestTypesIsLeaf keeps the types package free of imports from this module,
+// so every other package can depend on it
+func TestTypesIsLeaf(t *testing.T) {
+	files, err := filepath.Glob("../types/*.go")
+	if err != nil || len(files) == 0 {
+		t.Fatalf("no types sources found: %v", err)
+	}
+	fset := token.NewFileSet()
+	for _, file := range files {
+		parsed, err := parser.ParseFile(fset, file, nil, parser.ImportsOnly)
+		if err != nil {
+			t.Fatalf("failed to parse %s: %v", file, err)
+		}
+		for _, spec := range parsed.Imports {
+			if strings.Contains(spec.Path.Value, "github.com/mdwt/addpay-go") {
+				t.Errorf("%s imports %s", file, spec.Path.Value)
+			}
+		}
+	}
+}
@@ -0,0 +1,213 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/mdwt/addpay-go/sqlbind"
+	"github.com/mdwt/addpay-go/types"
+	"github.com/mdwt/addpay-go/webhook"
+)
+
+func TestWebhookDeduplication(t *testing.T) {
+	gateway, verifier := newTestGateway(t)
+
+	calls := 0
+	fail := true
+	handler := webhook.NewHandler(verifier, func(ctx context.Context, n types.Notification) error {
+		calls++
+		if fail {
+			return errors.New("temporary failure")
+		}
+		return nil
+	}).Deduplicate(webhook.NewMemoryStore(), 5*time.Minute)
+
+	body := signedNotification(t, gateway, "ORDER-1", "PAID").Encode()
+	const form = "application/x-www-form-urlencoded"
+
+	// A failed attempt is released so the gateway's retry is processed
+	if rec := postNotification(handler, body, form); rec.Code != http.StatusInternalServerError {
+		t.Fatalf("failing handler got %d, want 500", rec.Code)
+	}
+	fail = false
+	if rec := postNotification(handler, body, form); rec.Code != http.StatusOK {
+		t.Fatalf("retry got %d, want 200", rec.Code)
+	}
+
+	// Resends are acknowledged without being processed again
+	if rec := postNotification(handler, body, form); rec.Code != http.StatusOK || rec.Body.String() != "success" {
+		t.Errorf("duplicate got %d %q, want 200 success", rec.Code, rec.Body.String())
+	}
+	if calls != 2 {
+		t.Errorf("handler called %d times, want 2", calls)
+	}
+
+	// A different status of the same order is a new event
+	if rec := postNotification(handler, signedNotification(t, gateway, "ORDER-1", "REFUNDED").Encode(), form); rec.Code != http.StatusOK {
+		t.Errorf("new status got %d, want 200", rec.Code)
+	}
+	if calls != 3 {
+		t.Errorf("handler called %d times, want 3", calls)
+	}
+}
+
+func TestWebhookFreshnessWindow(t *testing.T) {
+	gateway, verifier := newTestGateway(t)
+
+	calls := 0
+	handler := webhook.NewHandler(verifier, func(ctx context.Context, n types.Notification) error {
+		calls++
+		return nil
+	}).Deduplicate(webhook.NewMemoryStore(), 5*time.Minute)
+
+	stale := signForm(t, gateway, map[string]interface{}{
+		"merchant_order_no": "ORDER-2",
+		"order_status":      "PAID",
+		"timestamp":         fmt.Sprintf("%d", time.Now().Add(-time.Hour).Unix()),
+	})
+	if rec := postNotification(handler, stale.Encode(), "application/x-www-form-urlencoded"); rec.Code != http.StatusBadRequest {
+		t.Errorf("stale notification got %d, want 400", rec.Code)
+	}
+	if calls != 0 {
+		t.Errorf("handler called for a stale notification")
+	}
+
+	n := types.Notification{Timestamp: time.Now().Unix()}
+	if err := webhook.CheckFreshness(n, time.Minute, time.Now()); err != nil {
+		t.Errorf("CheckFreshness() fresh unexpected error = %v", err)
+	}
+	if err := webhook.CheckFreshness(types.Notification{}, time.Minute, time.Now()); !errors.Is(err, webhook.ErrStaleNotification) {
+		t.Errorf("CheckFreshness() without timestamp error = %v, want ErrStaleNotification", err)
+	}
+}
+
+func TestEventKey(t *testing.T) {
+	byID := webhook.EventKey(types.Notification{NotifyID: "N1", MerchantOrderNo: "ORDER-1", OrderStatus: "PAID"})
+	if byID != "notify:N1" {
+		t.Errorf("EventKey() with notify ID = %s", byID)
+	}
+
+	paid := webhook.EventKey(types.Notification{MerchantNo: "M1", MerchantOrderNo: "ORDER-1", OrderStatus: "PAID"})
+	refunded := webhook.EventKey(types.Notification{MerchantNo: "M1", MerchantOrderNo: "ORDER-1", OrderStatus: "REFUNDED"})
+	if paid == refunded {
+		t.Errorf("EventKey() does not distinguish statuses: %s", paid)
+	}
+}
+
+func TestWebhookDeduplicationInProgress(t *testing.T) {
+	gateway, verifier := newTestGateway(t)
+	store := webhook.NewMemoryStore()
+	ctx := context.Background()
+
+	calls := 0
+	handler := webhook.NewHandler(verifier, func(ctx context.Context, n types.Notification) error {
+		calls++
+		return nil
+	}).Deduplicate(store, 5*time.Minute)
+
+	// Another instance is processing the event, so the resend is retried later
+	body := signedNotification(t, gateway, "ORDER-3", "PAID").Encode()
+	if got, _ := store.Claim(ctx, "notify:N-ORDER-3-PAID", time.Now().Add(time.Minute)); got != webhook.ClaimAcquired {
+		t.Fatalf("Claim() = %v, want acquired", got)
+	}
+	if rec := postNotification(handler, body, "application/x-www-form-urlencoded"); rec.Code != http.StatusInternalServerError || calls != 0 {
+		t.Errorf("resend during processing got %d after %d calls, want 500 and no call", rec.Code, calls)
+	}
+
+	// That instance crashed: once its lease ends the event is processed
+	store.Release(ctx, "notify:N-ORDER-3-PAID")
+	store.Claim(ctx, "notify:N-ORDER-3-PAID", time.Now().Add(-time.Second))
+	if rec := postNotification(handler, body, "application/x-www-form-urlencoded"); rec.Code != http.StatusOK || calls != 1 {
+		t.Errorf("resend after the lease got %d after %d calls, want 200 and one call", rec.Code, calls)
+	}
+	if got, _ := store.Claim(ctx, "notify:N-ORDER-3-PAID", time.Now().Add(time.Minute)); got != webhook.ClaimDone {
+		t.Errorf("Claim() after processing = %v, want done", got)
+	}
+}
+
+// testDedupStore checks the claim, complete, release and expiry rules of a store
+func testDedupStore(t *testing.T, store webhook.Store) {
+	t.Helper()
+	ctx := context.Background()
+	lease := time.Now().Add(time.Minute)
+
+	claim := func(key string, leaseUntil time.Time, want webhook.ClaimResult) {
+		t.Helper()
+		got, err := store.Claim(ctx, key, leaseUntil)
+		if err != nil || got != want {
+			t.Errorf("Claim(%s) = %v, %v, want %v", key, got, err, want)
+		}
+	}
+
+	claim("a", lease, webhook.ClaimAcquired)
+	claim("a", lease, webhook.ClaimInProgress)
+	if err := store.Complete(ctx, "a", time.Time{}); err != nil {
+		t.Fatalf("Complete() error = %v", err)
+	}
+	claim("a", lease, webhook.ClaimDone)
+
+	// A released key is claimed again
+	claim("b", lease, webhook.ClaimAcquired)
+	if err := store.Release(ctx, "b"); err != nil {
+		t.Fatalf("Release() error = %v", err)
+	}
+	claim("b", lease, webhook.ClaimAcquired)
+
+	// An ended lease and an expired done key are claimed again
+	claim("c", time.Now().Add(-time.Second), webhook.ClaimAcquired)
+	claim("c", lease, webhook.ClaimAcquired)
+	store.Complete(ctx, "c", time.Now().Add(-time.Second))
+	claim("c", lease, webhook.ClaimAcquired)
+}
+
+func TestMemoryStoreClaims(t *testing.T) {
+	testDedupStore(t, webhook.NewMemoryStore())
+}
+
+func TestSQLStoreClaims(t *testing.T) {
+	db := newFakeDB(t)
+	ctx := context.Background()
+
+	if _, err := webhook.NewSQLStore(db, "events; DROP TABLE x"); err == nil {
+		t.Error("NewSQLStore() accepted an invalid table name")
+	}
+	store, err := webhook.NewSQLStore(db, "addpay_webhook_events")
+	if err != nil {
+		t.Fatalf("NewSQLStore() error = %v", err)
+	}
+	store = store.WithBindStyle(sqlbind.AtP)
+	if err := store.CreateTable(ctx); err != nil {
+		t.Fatalf("CreateTable() error = %v", err)
+	}
+	testDedupStore(t, store)
+
+	// Purge drops expired keys and ended leases but keeps the rest
+	store.Claim(ctx, "ended", time.Now().Add(-time.Second))
+	if err := store.Purge(ctx); err != nil {
+		t.Fatalf("Purge() error = %v", err)
+	}
+	var keys int
+	if err := db.QueryRow("SELECT COUNT(*) FROM addpay_webhook_events").Scan(&keys); err != nil || keys != 3 {
+		t.Errorf("%d keys after Purge(), %v, want a, b and c", keys, err)
+	}
+}
+
+func TestSQLBindRebind(t *testing.T) {
+	query := "DELETE FROM t WHERE a = ? AND b <= ?"
+	if got := sqlbind.Question.Rebind(query); got != query {
+		t.Errorf("Question.Rebind() = %s", got)
+	}
+	if got := sqlbind.Dollar.Rebind(query); got != "DELETE FROM t WHERE a = $1 AND b <= $2" {
+		t.Errorf("Dollar.Rebind() = %s", got)
+	}
+	if got := sqlbind.AtP.Rebind(query); got != "DELETE FROM t WHERE a = @p1 AND b <= @p2" {
+		t.Errorf("AtP.Rebind() = %s", got)
+	}
+	if err := sqlbind.CheckIdentifier("addpay.events; DROP TABLE x"); err == nil {
+		t.Error("CheckIdentifier() accepted an injection")
+	}
+}
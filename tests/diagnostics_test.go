@@ -0,0 +1,130 @@
+package tests
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mdwt/addpay-go/auth"
+	"github.com/mdwt/addpay-go/diagnostics"
+)
+
+func TestExplainSignString(t *testing.T) {
+	report := diagnostics.ExplainSignString(map[string]interface{}{
+		"app_id":      "123",
+		"method":      "/checkout",
+		"expires":     0,
+		"description": "",
+		"geolocation": nil,
+		"sign":        "abc",
+	})
+
+	if report.SignString != "app_id=123&method=%2Fcheckout" {
+		t.Errorf("SignString = %s", report.SignString)
+	}
+	if len(report.Included) != 2 {
+		t.Errorf("Included = %v, want [app_id method]", report.Included)
+	}
+
+	wantFiltered := []string{"description", "expires", "geolocation", "sign"}
+	if len(report.Filtered) != len(wantFiltered) {
+		t.Fatalf("Filtered = %+v", report.Filtered)
+	}
+	for i, key := range wantFiltered {
+		if report.Filtered[i].Key != key || report.Filtered[i].Reason == "" {
+			t.Errorf("Filtered[%d] = %+v, want key %s with a reason", i, report.Filtered[i], key)
+		}
+	}
+}
+
+func TestDetectKeyFormat(t *testing.T) {
+	privateKey, publicKey := generateTestKeys(t)
+	otherPrivate, _ := generateTestKeys(t)
+
+	if info := diagnostics.DetectKeyFormat(privateKey); info.Format != diagnostics.FormatPKCS1Private || info.Encoding != "PEM" || info.Bits != 2048 {
+		t.Errorf("DetectKeyFormat(private) = %+v", info)
+	}
+	if info := diagnostics.DetectKeyFormat(publicKey); info.Format != diagnostics.FormatX509Public {
+		t.Errorf("DetectKeyFormat(public) = %+v", info)
+	}
+
+	parsed, _ := auth.ParsePrivateKey(privateKey)
+	portalKey, _ := auth.PublicKeyBase64(&parsed.PublicKey)
+	if info := diagnostics.DetectKeyFormat([]byte(portalKey)); info.Format != diagnostics.FormatX509Public || info.Encoding != "base64" {
+		t.Errorf("DetectKeyFormat(base64 public) = %+v", info)
+	}
+
+	if err := diagnostics.CheckKeyPair(privateKey, publicKey); err != nil {
+		t.Errorf("CheckKeyPair() matching keys unexpected error = %v", err)
+	}
+	if err := diagnostics.CheckKeyPair(otherPrivate, publicKey); err == nil {
+		t.Error("CheckKeyPair() with mismatched keys should return an error")
+	}
+}
+
+func TestVerifyCapture(t *testing.T) {
+	privateKey, publicKey := generateTestKeys(t)
+
+	gateway, err := auth.NewRSAAuth(privateKey, publicKey)
+	if err != nil {
+		t.Fatalf("NewRSAAuth() unexpected error = %v", err)
+	}
+	signature, _ := gateway.SignParameters(map[string]interface{}{
+		"merchant_order_no": "ORDER-1",
+		"order_status":      "SUCCESS",
+	})
+
+	body := url.Values{}
+	body.Set("merchant_order_no", "ORDER-1")
+	body.Set("order_status", "SUCCESS")
+	body.Set("sign", signature)
+
+	params, err := diagnostics.ParseCapture([]byte(body.Encode()))
+	if err != nil {
+		t.Fatalf("ParseCapture() unexpected error = %v", err)
+	}
+
+	key, _ := auth.ParseGatewayKey("gw", publicKey, time.Time{}, time.Time{})
+	keys := auth.NewKeySet(key)
+
+	if report := diagnostics.VerifyCapture(params, keys); !report.Valid || report.KeyID != "gw" {
+		t.Errorf("VerifyCapture() = %+v, want valid", report)
+	}
+
+	params["order_status"] = "FAILED"
+	if report := diagnostics.VerifyCapture(params, keys); report.Valid || report.Error == "" {
+		t.Errorf("VerifyCapture() on tampered capture = %+v, want invalid", report)
+	}
+}
+
+func TestVerifyCaptureJSONNumbers(t *testing.T) {
+	privateKey, publicKey := generateTestKeys(t)
+
+	gateway, err := auth.NewRSAAuth(privateKey, publicKey)
+	if err != nil {
+		t.Fatalf("NewRSAAuth() unexpected error = %v", err)
+	}
+	signature, _ := gateway.SignParameters(map[string]interface{}{
+		"merchant_order_no": "ORDER-2",
+		"order_amount":      "100",
+		"timestamp":         "1760000000",
+	})
+
+	capture := fmt.Sprintf(`{"merchant_order_no":"ORDER-2","order_amount":100,"timestamp":1760000000,"sign":%q}`, signature)
+	params, err := diagnostics.ParseCapture([]byte(capture))
+	if err != nil {
+		t.Fatalf("ParseCapture() unexpected error = %v", err)
+	}
+
+	report := diagnostics.ExplainSignString(params)
+	if !strings.Contains(report.SignString, "order_amount=100&") || !strings.Contains(report.SignString, "timestamp=1760000000") {
+		t.Errorf("SignString = %s, want numbers as written", report.SignString)
+	}
+
+	key, _ := auth.ParseGatewayKey("gw", publicKey, time.Time{}, time.Time{})
+	if report := diagnostics.VerifyCapture(params, auth.NewKeySet(key)); !report.Valid {
+		t.Errorf("VerifyCapture() = %+v, want valid", report)
+	}
+}
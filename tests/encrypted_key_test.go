@@ -0,0 +1,101 @@
+package tests
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mdwt/addpay-go"
+	"github.com/mdwt/addpay-go/auth"
+	"github.com/mdwt/addpay-go/types"
+)
+
+// testKeyPassphrase protects the encrypted fixtures in testdata
+const testKeyPassphrase = "s3cret"
+
+func TestEncryptedPrivateKeyFormats(t *testing.T) {
+	publicPEM, err := os.ReadFile(filepath.Join("testdata", "merchant_public.pem"))
+	if err != nil {
+		t.Fatalf("Failed to read public key fixture: %v", err)
+	}
+	key, err := auth.ParseGatewayKey("merchant", publicPEM, time.Time{}, time.Time{})
+	if err != nil {
+		t.Fatalf("ParseGatewayKey() unexpected error = %v", err)
+	}
+
+	fixtures := []string{
+		"merchant_encrypted.pem", // PKCS#8 PBES2, AES-256-CBC
+		"merchant.p12",           // PKCS#12, PBES2 with SHA-256 MAC
+		"merchant_legacy.p12",    // PKCS#12, SHA1 3DES with SHA-1 MAC
+	}
+
+	for _, fixture := range fixtures {
+		t.Run(fixture, func(t *testing.T) {
+			data, err := os.ReadFile(filepath.Join("testdata", fixture))
+			if err != nil {
+				t.Fatalf("Failed to read fixture: %v", err)
+			}
+
+			if !auth.IsEncryptedPrivateKey(data) {
+				t.Error("IsEncryptedPrivateKey() = false, want true")
+			}
+
+			privateKey, err := auth.ParsePrivateKeyWithPassphrase(data, func() ([]byte, error) {
+				return []byte(testKeyPassphrase), nil
+			})
+			if err != nil {
+				t.Fatalf("ParsePrivateKeyWithPassphrase() unexpected error = %v", err)
+			}
+			if !privateKey.PublicKey.Equal(key.PublicKey) {
+				t.Error("decrypted key does not match the public key fixture")
+			}
+
+			if _, err := auth.ParsePrivateKeyWithPassphrase(data, func() ([]byte, error) {
+				return []byte("wrong"), nil
+			}); err == nil {
+				t.Error("ParsePrivateKeyWithPassphrase() with wrong passphrase should return an error")
+			}
+
+			if _, err := auth.ParsePrivateKeyWithPassphrase(data, nil); err == nil {
+				t.Error("ParsePrivateKeyWithPassphrase() without passphrase should return an error")
+			}
+
+			// The client decrypts the key using the configured passphrase
+			_, err = addpay.NewClient(types.Config{
+				AppID:                 "test-app-id",
+				GatewayURL:            "https://api.example.com",
+				MerchantPrivateKey:    data,
+				MerchantKeyPassphrase: []byte(testKeyPassphrase),
+				GatewayPublicKey:      publicPEM,
+				Logger:                addpay.NewNoOpLogger(),
+			})
+			if err != nil {
+				t.Errorf("NewClient() unexpected error = %v", err)
+			}
+		})
+	}
+}
+
+func TestPassphraseCallbackError(t *testing.T) {
+	data, err := os.ReadFile(filepath.Join("testdata", "merchant_encrypted.pem"))
+	if err != nil {
+		t.Fatalf("Failed to read fixture: %v", err)
+	}
+	publicPEM, _ := os.ReadFile(filepath.Join("testdata", "merchant_public.pem"))
+
+	_, err = addpay.NewClient(types.Config{
+		AppID:              "test-app-id",
+		GatewayURL:         "https://api.example.com",
+		MerchantPrivateKey: data,
+		MerchantKeyPassphraseFunc: func() ([]byte, error) {
+			return nil, fmt.Errorf("vault unavailable")
+		},
+		GatewayPublicKey: publicPEM,
+		Logger:           addpay.NewNoOpLogger(),
+	})
+	if err == nil {
+		t.Error("NewClient() with failing passphrase callback should return an error")
+	}
+}
@@ -0,0 +1,200 @@
+package tests
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/mdwt/addpay-go"
+	"github.com/mdwt/addpay-go/types"
+)
+
+func TestEnvironmentPreset(t *testing.T) {
+	privateKey, publicKey := generateTestKeys(t)
+
+	client, err := addpay.NewClient(types.Config{
+		AppID:              "test-app-id",
+		Environment:        types.Production,
+		MerchantPrivateKey: privateKey,
+		GatewayPublicKey:   publicKey,
+		Logger:             addpay.NewNoOpLogger(),
+	})
+	if err != nil {
+		t.Fatalf("NewClient() unexpected error = %v", err)
+	}
+
+	if got := client.GetConfig().GatewayURL; got != "https://api.paycloud.africa" {
+		t.Errorf("GatewayURL = %s, want the production preset", got)
+	}
+
+	_, err = addpay.NewClient(types.Config{
+		AppID:              "test-app-id",
+		Environment:        types.Environment("sandbox"),
+		MerchantPrivateKey: privateKey,
+		GatewayPublicKey:   publicKey,
+	})
+	if err == nil {
+		t.Error("NewClient() with unknown environment should return an error")
+	}
+
+	// Presets carry no gateway key, since it is issued per app
+	_, err = addpay.NewClient(types.Config{
+		AppID:              "test-app-id",
+		Environment:        types.Production,
+		MerchantPrivateKey: privateKey,
+	})
+	if err == nil || !strings.Contains(err.Error(), "gateway_public_key is required") {
+		t.Errorf("NewClient() without a gateway key error = %v, want gateway_public_key is required", err)
+	}
+}
+
+func TestGatewayURLValidation(t *testing.T) {
+	privateKey, publicKey := generateTestKeys(t)
+
+	tests := []struct {
+		name    string
+		url     string
+		wantErr bool
+	}{
+		{name: "https", url: "https://api.example.com", wantErr: false},
+		{name: "trailing slash", url: "https://api.example.com/", wantErr: false},
+		{name: "loopback http", url: "http://127.0.0.1:8080", wantErr: false},
+		{name: "localhost http", url: "http://localhost:8080", wantErr: false},
+		{name: "remote http", url: "http://api.example.com", wantErr: true},
+		{name: "missing scheme", url: "api.example.com", wantErr: true},
+		{name: "unsupported scheme", url: "ftp://api.example.com", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := addpay.NewClient(types.Config{
+				AppID:              "test-app-id",
+				GatewayURL:         tt.url,
+				MerchantPrivateKey: privateKey,
+				GatewayPublicKey:   publicKey,
+				Logger:             addpay.NewNoOpLogger(),
+			})
+			if (err != nil) != tt.wantErr {
+				t.Errorf("NewClient() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestGatewayFailover(t *testing.T) {
+	privateKey, publicKey := generateTestKeys(t)
+
+	primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer primary.Close()
+
+	secondary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"success":true,"data":{"pay_url":"https://pay.example.com/checkout/1"}}`))
+	}))
+	defer secondary.Close()
+
+	client, err := addpay.NewClient(types.Config{
+		AppID:              "test-app-id",
+		GatewayURL:         primary.URL,
+		FailoverURLs:       []string{secondary.URL},
+		MerchantPrivateKey: privateKey,
+		GatewayPublicKey:   publicKey,
+		Logger:             addpay.NewNoOpLogger(),
+	})
+	if err != nil {
+		t.Fatalf("NewClient() unexpected error = %v", err)
+	}
+
+	response, err := client.HostedCheckout(context.Background(), types.CheckoutRequest{
+		MerchantOrderNo: "ORDER-001",
+		PriceCurrency:   "ZAR",
+		OrderAmount:     10,
+	})
+	if err != nil {
+		t.Fatalf("HostedCheckout failed: %v", err)
+	}
+	if response.PayURL != "https://pay.example.com/checkout/1" {
+		t.Errorf("PayURL = %s, want failover response", response.PayURL)
+	}
+}
+
+func TestGatewayFailoverAfterProcessing(t *testing.T) {
+	privateKey, publicKey := generateTestKeys(t)
+
+	// The primary charges the card, then the response is lost upstream
+	var charged, secondaryCalls int32
+	primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&charged, 1)
+		w.WriteHeader(http.StatusGatewayTimeout)
+	}))
+	defer primary.Close()
+
+	secondary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&secondaryCalls, 1)
+		w.Write([]byte(`{"success":true,"data":{"transaction_id":"TX-2","transaction_status":"PAID"}}`))
+	}))
+	defer secondary.Close()
+
+	client, err := addpay.NewClient(types.Config{
+		AppID:              "test-app-id",
+		GatewayURL:         primary.URL,
+		FailoverURLs:       []string{secondary.URL},
+		MerchantPrivateKey: privateKey,
+		GatewayPublicKey:   publicKey,
+		Logger:             addpay.NewNoOpLogger(),
+	})
+	if err != nil {
+		t.Fatalf("NewClient() unexpected error = %v", err)
+	}
+
+	_, err = client.TokenizedPay(context.Background(), types.TokenizedPayRequest{
+		MerchantOrderNo: "ORDER-504",
+		Token:           "tok_123",
+		PriceCurrency:   "ZAR",
+		OrderAmount:     10,
+	})
+	if err == nil {
+		t.Fatal("TokenizedPay() error = nil, want the 504 from the primary")
+	}
+	if atomic.LoadInt32(&charged) != 1 || atomic.LoadInt32(&secondaryCalls) != 0 {
+		t.Errorf("primary calls = %d, secondary calls = %d, want the payment sent once", charged, secondaryCalls)
+	}
+}
+
+func TestGatewayFailoverOnConnectError(t *testing.T) {
+	privateKey, publicKey := generateTestKeys(t)
+
+	// A closed server refuses connections, so nothing was sent
+	unreachable := httptest.NewServer(http.NotFoundHandler())
+	unreachable.Close()
+
+	secondary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"success":true,"data":{"merchant_order_no":"ORDER-1","order_status":"PAID"}}`))
+	}))
+	defer secondary.Close()
+
+	client, err := addpay.NewClient(types.Config{
+		AppID:              "test-app-id",
+		GatewayURL:         unreachable.URL,
+		FailoverURLs:       []string{secondary.URL},
+		MerchantPrivateKey: privateKey,
+		GatewayPublicKey:   publicKey,
+		Logger:             addpay.NewNoOpLogger(),
+	})
+	if err != nil {
+		t.Fatalf("NewClient() unexpected error = %v", err)
+	}
+
+	order, err := client.QueryOrder(context.Background(), types.QueryOrderRequest{MerchantOrderNo: "ORDER-1"})
+	if err != nil {
+		t.Fatalf("QueryOrder() error = %v", err)
+	}
+	if order.OrderStatus != "PAID" {
+		t.Errorf("OrderStatus = %q, want the failover response", order.OrderStatus)
+	}
+}
@@ -0,0 +1,80 @@
+package tests
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/mdwt/addpay-go"
+	"github.com/mdwt/addpay-go/client"
+	"github.com/mdwt/addpay-go/types"
+)
+
+// generateTestKeys creates a throwaway RSA key pair in PEM format
+func generateTestKeys(t *testing.T) (privateKeyPEM, publicKeyPEM []byte) {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Failed to generate RSA key: %v", err)
+	}
+
+	publicDER, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		t.Fatalf("Failed to marshal public key: %v", err)
+	}
+
+	privateKeyPEM = pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+	publicKeyPEM = pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicDER})
+	return privateKeyPEM, publicKeyPEM
+}
+
+// strconvQuote quotes a string as a JSON string literal
+func strconvQuote(s string) string {
+	quoted, _ := json.Marshal(s)
+	return string(quoted)
+}
+
+// newTestClient starts a fake gateway serving handler and returns a client
+// for it with throwaway keys and no logging
+func newTestClient(t *testing.T, handler http.Handler) client.Client {
+	t.Helper()
+	return newTestClientWithConfig(t, handler, types.Config{})
+}
+
+// newTestClientWithConfig is like newTestClient, but starts from config.
+// The app ID, gateway URL, keys and logger are filled in when not set.
+func newTestClientWithConfig(t *testing.T, handler http.Handler, config types.Config) client.Client {
+	t.Helper()
+
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	if config.AppID == "" {
+		config.AppID = "test-app-id"
+	}
+	if config.GatewayURL == "" {
+		config.GatewayURL = server.URL
+	}
+	if len(config.MerchantPrivateKey) == 0 && config.MerchantSigner == nil {
+		privateKey, publicKey := generateTestKeys(t)
+		config.MerchantPrivateKey = privateKey
+		if len(config.GatewayPublicKey) == 0 && config.GatewayKeySet == nil {
+			config.GatewayPublicKey = publicKey
+		}
+	}
+	if config.Logger == nil {
+		config.Logger = addpay.NewNoOpLogger()
+	}
+
+	c, err := addpay.NewClient(config)
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+	return c
+}
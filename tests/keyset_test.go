@@ -0,0 +1,97 @@
+package tests
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mdwt/addpay-go/auth"
+)
+
+func TestGatewayKeySetRotation(t *testing.T) {
+	oldPrivate, oldPublic := generateTestKeys(t)
+	newPrivate, newPublic := generateTestKeys(t)
+
+	oldKey, err := auth.ParseGatewayKey("2025", oldPublic, time.Time{}, time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatalf("ParseGatewayKey() unexpected error = %v", err)
+	}
+	newKey, err := auth.ParseGatewayKey("2026", newPublic, time.Now().Add(-time.Hour), time.Time{})
+	if err != nil {
+		t.Fatalf("ParseGatewayKey() unexpected error = %v", err)
+	}
+
+	keys := auth.NewKeySet(oldKey, newKey)
+	data := []byte("order_status=SUCCESS&merchant_order_no=ORDER-1")
+
+	// Responses signed with either gateway key verify during the overlap
+	for name, privateKey := range map[string][]byte{"2025": oldPrivate, "2026": newPrivate} {
+		gateway, err := auth.NewRSAAuth(privateKey, newPublic)
+		if err != nil {
+			t.Fatalf("NewRSAAuth() unexpected error = %v", err)
+		}
+		signature, err := gateway.Sign(data)
+		if err != nil {
+			t.Fatalf("Sign() unexpected error = %v", err)
+		}
+
+		keyID, err := keys.Verify(data, signature)
+		if err != nil {
+			t.Errorf("Verify() with key %s unexpected error = %v", name, err)
+		}
+		if keyID != name {
+			t.Errorf("Verify() matched key %s, want %s", keyID, name)
+		}
+	}
+
+	// After a reload that retires the old key, its signatures are rejected
+	expired := oldKey
+	expired.NotAfter = time.Now().Add(-time.Minute)
+	keys.Replace(expired, newKey)
+
+	gateway, _ := auth.NewRSAAuth(oldPrivate, oldPublic)
+	signature, _ := gateway.Sign(data)
+	if _, err := keys.Verify(data, signature); err == nil {
+		t.Error("Verify() with an expired key should return an error")
+	}
+
+	active, ok := keys.Active(time.Now())
+	if !ok || active.ID != "2026" {
+		t.Errorf("Active() = %s, want 2026", active.ID)
+	}
+}
+
+func TestGatewayKeySetWithoutPublicKey(t *testing.T) {
+	privateKey, publicKey := generateTestKeys(t)
+	key, err := auth.ParseGatewayKey("gw", publicKey, time.Time{}, time.Time{})
+	if err != nil {
+		t.Fatalf("ParseGatewayKey() unexpected error = %v", err)
+	}
+
+	gateway, _ := auth.NewRSAAuth(privateKey, publicKey)
+	data := []byte("merchant_order_no=ORDER-1")
+	signature, _ := gateway.Sign(data)
+
+	// A key without a public key is skipped rather than used
+	keys := auth.NewKeySet(auth.GatewayKey{ID: "empty"}, key)
+	if keyID, err := keys.Verify(data, signature); err != nil || keyID != "gw" {
+		t.Errorf("Verify() = %q, %v, want gw", keyID, err)
+	}
+	if active, ok := keys.Active(time.Now()); !ok || active.ID != "gw" {
+		t.Errorf("Active() = %s, %v, want gw", active.ID, ok)
+	}
+
+	keys.Replace(auth.GatewayKey{ID: "empty"})
+	if _, err := keys.Verify(data, signature); err == nil || !strings.Contains(err.Error(), `key "empty" has no public key`) {
+		t.Errorf("Verify() error = %v, want the empty key reported", err)
+	}
+
+	signer, _ := auth.ParsePrivateKey(privateKey)
+	rsaAuth, err := auth.NewRSAAuthWithKeySet(signer, keys)
+	if err != nil {
+		t.Fatalf("NewRSAAuthWithKeySet() unexpected error = %v", err)
+	}
+	if _, err := rsaAuth.Encrypt([]byte("4111111111111111")); err == nil {
+		t.Error("Encrypt() with no usable gateway key should return an error")
+	}
+}
@@ -0,0 +1,157 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/mdwt/addpay-go"
+	"github.com/mdwt/addpay-go/logger"
+	"github.com/mdwt/addpay-go/types"
+)
+
+// logLines decodes JSON log output into one map per line
+func logLines(t *testing.T, buf *bytes.Buffer) []map[string]interface{} {
+	t.Helper()
+
+	var lines []map[string]interface{}
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		if line == "" {
+			continue
+		}
+		var entry map[string]interface{}
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			t.Fatalf("invalid log line %q: %v", line, err)
+		}
+		lines = append(lines, entry)
+	}
+	return lines
+}
+
+func TestLoggerOptions(t *testing.T) {
+	var buf bytes.Buffer
+	level := new(slog.LevelVar)
+	level.Set(slog.LevelWarn)
+	log := logger.New(logger.Options{Level: level, Output: &buf})
+
+	log.Info("hidden", "key", "value")
+	log.Warn("shown", "key", "value")
+	level.Set(slog.LevelDebug)
+	log.Debug("shown after level change")
+
+	lines := logLines(t, &buf)
+	if len(lines) != 2 || lines[0]["msg"] != "shown" {
+		t.Fatalf("log lines = %v", lines)
+	}
+	group, _ := lines[0][logger.Group].(map[string]interface{})
+	if group["key"] != "value" {
+		t.Errorf("attributes not nested in the %q group: %v", logger.Group, lines[0])
+	}
+}
+
+func TestLoggerContext(t *testing.T) {
+	var buf bytes.Buffer
+	base := logger.FromSlog(slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{AddSource: true}))).
+		WithContextAttrs(func(ctx context.Context) []slog.Attr {
+			return []slog.Attr{slog.String("tenant", "acme")}
+		})
+
+	ctx := logger.WithTraceID(logger.WithRequestID(context.Background(), "req-1"), "trace-1")
+	logger.WithContext(base, ctx).Info("bound")
+	base.Info("unbound")
+
+	lines := logLines(t, &buf)
+	if len(lines) != 2 {
+		t.Fatalf("log lines = %v", lines)
+	}
+	if lines[0]["request_id"] != "req-1" || lines[0]["trace_id"] != "trace-1" || lines[0]["tenant"] != "acme" {
+		t.Errorf("bound line = %v", lines[0])
+	}
+	if _, ok := lines[1]["request_id"]; ok {
+		t.Errorf("unbound line = %v", lines[1])
+	}
+
+	// The source is the caller, not the wrapper
+	source, _ := lines[0]["source"].(map[string]interface{})
+	if file, _ := source["file"].(string); !strings.HasSuffix(file, "logger_test.go") {
+		t.Errorf("source = %v, want the calling file", source)
+	}
+
+	// Loggers without context support are returned unchanged
+	noop := addpay.NewNoOpLogger()
+	if logger.WithContext(noop, ctx) != noop {
+		t.Error("WithContext() wrapped a logger without context support")
+	}
+}
+
+func TestClientLogging(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"success":true,"data":{"merchant_order_no":"LOG-1","order_status":"PAID"}}`))
+	})
+
+	var buf bytes.Buffer
+	c := newTestClientWithConfig(t, handler, types.Config{
+		Logger: addpay.LoggerFromSlog(slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))),
+	})
+
+	ctx := logger.WithRequestID(context.Background(), "req-42")
+	if _, err := c.QueryOrder(ctx, types.QueryOrderRequest{MerchantOrderNo: "LOG-1"}); err != nil {
+		t.Fatalf("QueryOrder() error = %v", err)
+	}
+
+	var request map[string]interface{}
+	for _, line := range logLines(t, &buf) {
+		if line["request_id"] != "req-42" {
+			t.Errorf("line without request ID: %v", line)
+		}
+		if line["msg"] == "Making API request" {
+			group, _ := line[logger.Group].(map[string]interface{})
+			request, _ = group["request"].(map[string]interface{})
+		}
+	}
+	if request["method"] != "POST" || request["url"] == nil {
+		t.Errorf("addpay.request group = %v", request)
+	}
+}
+
+func TestClientDefaultLogger(t *testing.T) {
+	var buf bytes.Buffer
+	previous := slog.Default()
+	slog.SetDefault(slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelWarn})))
+	t.Cleanup(func() { slog.SetDefault(previous) })
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"success":false,"error":{"code":"ORDER_NOT_FOUND","message":"order not found"}}`))
+	})
+	privateKey, publicKey := generateTestKeys(t)
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	c, err := addpay.NewClient(types.Config{
+		AppID:              "test-app-id",
+		GatewayURL:         server.URL,
+		MerchantPrivateKey: privateKey,
+		GatewayPublicKey:   publicKey,
+	})
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+	if _, err := c.QueryOrder(context.Background(), types.QueryOrderRequest{MerchantOrderNo: "LOG-2"}); err == nil {
+		t.Fatal("QueryOrder() error = nil, want the gateway error")
+	}
+
+	lines := logLines(t, &buf)
+	if len(lines) == 0 {
+		t.Fatal("nothing logged through slog.Default()")
+	}
+	for _, line := range lines {
+		if line["level"] == "INFO" || line["level"] == "DEBUG" {
+			t.Errorf("line below the default handler's level: %v", line)
+		}
+	}
+}
@@ -0,0 +1,51 @@
+package tests
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/mdwt/addpay-go/types"
+)
+
+func TestQueryOrderAndRefund(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		switch r.URL.Path {
+		case "/query-order":
+			if r.PostForm.Get("merchant_order_no") != "ORDER-1" {
+				t.Errorf("merchant_order_no = %s, want ORDER-1", r.PostForm.Get("merchant_order_no"))
+			}
+			w.Write([]byte(`{"success":true,"data":{"merchant_order_no":"ORDER-1","transaction_id":"TX-1","order_status":"SUCCESS","order_amount":99.99}}`))
+		case "/refund":
+			if r.PostForm.Get("refund_amount") != "10" {
+				t.Errorf("refund_amount = %s, want 10", r.PostForm.Get("refund_amount"))
+			}
+			w.Write([]byte(`{"success":true,"data":{"refund_no":"REFUND-1","refund_id":"RF-1","refund_status":"PROCESSING"}}`))
+		default:
+			http.NotFound(w, r)
+		}
+	})
+
+	client := newTestClient(t, handler)
+
+	order, err := client.QueryOrder(context.Background(), types.QueryOrderRequest{MerchantOrderNo: "ORDER-1"})
+	if err != nil {
+		t.Fatalf("QueryOrder failed: %v", err)
+	}
+	if order.OrderStatus != "SUCCESS" || order.TransactionID != "TX-1" {
+		t.Errorf("QueryOrder() = %+v", order)
+	}
+
+	refund, err := client.Refund(context.Background(), types.RefundRequest{
+		MerchantOrderNo: "ORDER-1",
+		RefundNo:        "REFUND-1",
+		RefundAmount:    10,
+	})
+	if err != nil {
+		t.Fatalf("Refund failed: %v", err)
+	}
+	if refund.RefundID != "RF-1" || refund.RefundStatus != "PROCESSING" {
+		t.Errorf("Refund() = %+v", refund)
+	}
+}
@@ -0,0 +1,113 @@
+package tests
+
+import (
+	"errors"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mdwt/addpay-go/orderno"
+)
+
+func TestOrderNoGenerator(t *testing.T) {
+	g, err := orderno.NewGenerator(orderno.Config{Prefix: "INV-", StoreNo: "store-042", Checksum: true})
+	if err != nil {
+		t.Fatalf("NewGenerator() error = %v", err)
+	}
+
+	before := time.Now().Truncate(time.Millisecond)
+	n := g.Next()
+	if len(n) != orderno.MaxLength || !strings.HasPrefix(n, "INV-") || !strings.Contains(n, "STORE042") {
+		t.Errorf("Next() = %q", n)
+	}
+	if err := orderno.Validate(n); err != nil {
+		t.Errorf("Validate(%q) error = %v", n, err)
+	}
+	if err := g.Verify(n); err != nil {
+		t.Errorf("Verify(%q) error = %v", n, err)
+	}
+	created, err := g.Time(n)
+	if err != nil || created.Before(before) || created.After(time.Now()) {
+		t.Errorf("Time(%q) = %v, %v", n, created, err)
+	}
+
+	// The check character catches any single mistyped character
+	for i := len("INV-"); i < len(n); i++ {
+		for _, c := range []byte("0AZ9") {
+			if c == n[i] {
+				continue
+			}
+			typo := n[:i] + string(c) + n[i+1:]
+			if err := g.Verify(typo); !errors.Is(err, orderno.ErrInvalid) {
+				t.Fatalf("Verify(%q) accepted a typo of %q", typo, n)
+			}
+		}
+	}
+}
+
+func TestOrderNoConcurrent(t *testing.T) {
+	g, err := orderno.NewGenerator(orderno.Config{Prefix: "ORD-", Length: 24})
+	if err != nil {
+		t.Fatalf("NewGenerator() error = %v", err)
+	}
+
+	const workers, each = 8, 1000
+	var mu sync.Mutex
+	var all []string
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var previous string
+			for i := 0; i < each; i++ {
+				n := g.Next()
+				if n <= previous {
+					t.Errorf("%q does not sort after %q", n, previous)
+				}
+				previous = n
+				mu.Lock()
+				all = append(all, n)
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	sort.Strings(all)
+	for i := 1; i < len(all); i++ {
+		if all[i] == all[i-1] {
+			t.Fatalf("duplicate order number %q", all[i])
+		}
+	}
+	if len(all[0]) != 24 {
+		t.Errorf("length = %d, want 24", len(all[0]))
+	}
+}
+
+func TestOrderNoConfigErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  orderno.Config
+	}{
+		{"over gateway limit", orderno.Config{Length: 40}},
+		{"prefix charset", orderno.Config{Prefix: "INV/"}},
+		{"no room for randomness", orderno.Config{Prefix: "INVOICE-", StoreNo: "STORE0042", Length: 24}},
+		{"empty store code", orderno.Config{StoreNo: "--"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := orderno.NewGenerator(tt.cfg); err == nil {
+				t.Error("NewGenerator() = nil error")
+			}
+		})
+	}
+
+	for _, n := range []string{"", "ORDER 1", strings.Repeat("A", orderno.MaxLength+1)} {
+		if err := orderno.Validate(n); !errors.Is(err, orderno.ErrInvalid) {
+			t.Errorf("Validate(%q) = %v, want ErrInvalid", n, err)
+		}
+	}
+}
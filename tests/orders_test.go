@@ -0,0 +1,226 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mdwt/addpay-go/orders"
+	"github.com/mdwt/addpay-go/sqlbind"
+	"github.com/mdwt/addpay-go/types"
+)
+
+func TestOrderTransitions(t *testing.T) {
+	tests := []struct {
+		from, to orders.State
+		allowed  bool
+	}{
+		{orders.StateCreated, orders.StatePending, true},
+		{orders.StateCreated, orders.StatePaid, true},
+		{orders.StatePending, orders.StatePaid, true},
+		{orders.StatePending, orders.StateExpired, true},
+		{orders.StatePaid, orders.StateRefunded, true},
+		{orders.StatePaid, orders.StatePaid, true},
+		{orders.StatePaid, orders.StatePending, false},
+		{orders.StatePaid, orders.StateFailed, false},
+		{orders.StateFailed, orders.StatePaid, false},
+		{orders.StateExpired, orders.StatePending, false},
+		{orders.StateRefunded, orders.StatePaid, false},
+		{orders.StateCreated, orders.StateRefunded, false},
+	}
+	for _, tt := range tests {
+		if got := tt.from.CanTransition(tt.to); got != tt.allowed {
+			t.Errorf("%s.CanTransition(%s) = %v, want %v", tt.from, tt.to, got, tt.allowed)
+		}
+	}
+}
+
+func TestOrderTracker(t *testing.T) {
+	ctx := context.Background()
+	tracker := orders.NewTracker(orders.NewMemoryStore())
+
+	if _, err := tracker.Create(ctx, orders.Order{MerchantOrderNo: "ORD-1", Currency: "ZAR", Amount: 100}); err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	if _, err := tracker.Create(ctx, orders.Order{MerchantOrderNo: "ORD-1"}); !errors.Is(err, orders.ErrExists) {
+		t.Errorf("Create() duplicate error = %v, want ErrExists", err)
+	}
+
+	o, err := tracker.RecordCheckout(ctx, "ORD-1", types.CheckoutResponse{PayURL: "https://pay.example/ORD-1"})
+	if err != nil || o.State != orders.StatePending || o.PayURL == "" || o.Source != orders.SourceCheckout {
+		t.Fatalf("RecordCheckout() = %+v, %v", o, err)
+	}
+
+	paid := types.Notification{MerchantOrderNo: "ORD-1", TransactionID: "TX-1", OrderStatus: "SUCCESS", PaidAmount: 100}
+	o, err = tracker.RecordNotification(ctx, paid)
+	if err != nil || o.State != orders.StatePaid || o.TransactionID != "TX-1" {
+		t.Fatalf("RecordNotification() = %+v, %v", o, err)
+	}
+	version := o.Version
+
+	// A resent notification changes nothing
+	o, err = tracker.RecordNotification(ctx, paid)
+	if err != nil || o.Version != version {
+		t.Errorf("duplicate notification = %+v, %v", o, err)
+	}
+
+	// A late failure cannot undo a payment
+	failed := types.Notification{MerchantOrderNo: "ORD-1", OrderStatus: "FAILED"}
+	if _, err := tracker.RecordNotification(ctx, failed); !errors.Is(err, orders.ErrIllegalTransition) {
+		t.Errorf("paid → failed error = %v, want ErrIllegalTransition", err)
+	}
+	if err := tracker.HandleNotification(ctx, failed); err != nil {
+		t.Errorf("HandleNotification() = %v, want rejected notifications acknowledged", err)
+	}
+
+	o, err = tracker.RecordNotification(ctx, types.Notification{MerchantOrderNo: "ORD-1", OrderStatus: "REFUNDED", RefundNo: "R-1"})
+	if err != nil || o.State != orders.StateRefunded {
+		t.Errorf("refund notification = %+v, %v", o, err)
+	}
+
+	if _, err := tracker.RecordNotification(ctx, types.Notification{MerchantOrderNo: "ORD-404", OrderStatus: "PAID"}); !errors.Is(err, orders.ErrNotFound) {
+		t.Errorf("unknown order error = %v, want ErrNotFound", err)
+	}
+}
+
+func TestOrderTrackerTokenizedPay(t *testing.T) {
+	ctx := context.Background()
+	tracker := orders.NewTracker(orders.NewMemoryStore())
+	tracker.Create(ctx, orders.Order{MerchantOrderNo: "ORD-2"})
+
+	o, err := tracker.RecordTokenizedPay(ctx, "ORD-2", types.TokenizedPayResponse{TransactionID: "TX-2", TransactionStatus: "PROCESSING"})
+	if err != nil || o.State != orders.StatePending || o.TransactionID != "TX-2" {
+		t.Errorf("RecordTokenizedPay() = %+v, %v", o, err)
+	}
+}
+
+func TestOrderTrackerConcurrentUpdates(t *testing.T) {
+	ctx := context.Background()
+	tracker := orders.NewTracker(orders.NewMemoryStore())
+	tracker.Create(ctx, orders.Order{MerchantOrderNo: "ORD-3"})
+
+	// The webhook and a poller race to record the same payment
+	var wg sync.WaitGroup
+	errs := make(chan error, 2)
+	for _, source := range []orders.Source{orders.SourceNotification, orders.SourceOrderQuery} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := tracker.Apply(ctx, "ORD-3", orders.Update{State: orders.StatePaid, Source: source})
+			errs <- err
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Errorf("Apply() error = %v", err)
+		}
+	}
+
+	o, _ := tracker.Get(ctx, "ORD-3")
+	if o.State != orders.StatePaid || o.Version != 1 {
+		t.Errorf("order = %+v, want paid once", o)
+	}
+}
+
+func TestOrderTrackerSync(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"success":true,"data":{"merchant_order_no":"ORD-4","transaction_id":"TX-4","order_status":"EXPIRED"}}`))
+	})
+
+	c := newTestClient(t, handler)
+
+	ctx := context.Background()
+	tracker := orders.NewTracker(orders.NewMemoryStore())
+	tracker.Create(ctx, orders.Order{MerchantOrderNo: "ORD-4"})
+
+	o, err := tracker.Sync(ctx, c, "ORD-4")
+	if err != nil || o.State != orders.StateExpired || o.Source != orders.SourceOrderQuery || !o.State.Final() {
+		t.Errorf("Sync() = %+v, %v", o, err)
+	}
+}
+
+func TestOrderSQLStore(t *testing.T) {
+	db := newFakeDB(t)
+	ctx := context.Background()
+
+	if _, err := orders.NewSQLStore(db, "orders; DROP TABLE x"); err == nil {
+		t.Error("NewSQLStore() accepted an invalid table name")
+	}
+	store, err := orders.NewSQLStore(db, "addpay_orders")
+	if err != nil {
+		t.Fatalf("NewSQLStore() error = %v", err)
+	}
+	store = store.WithBindStyle(sqlbind.Dollar)
+
+	// Without the table the insert fails and the order isn't found, so the
+	// insert error is returned rather than ErrExists
+	if err := store.Create(ctx, orders.Order{MerchantOrderNo: "SQL-0"}); err == nil || errors.Is(err, orders.ErrExists) {
+		t.Errorf("Create() without a table error = %v, want the insert error", err)
+	}
+	if err := store.CreateTable(ctx); err != nil {
+		t.Fatalf("CreateTable() error = %v", err)
+	}
+	if err := store.CreateTable(ctx); err != nil {
+		t.Errorf("CreateTable() twice error = %v", err)
+	}
+
+	created := time.Unix(1700000000, 0)
+	order := orders.Order{
+		MerchantOrderNo: "SQL-1",
+		MerchantNo:      "M-1",
+		StoreNo:         "S-1",
+		State:           orders.StateCreated,
+		Source:          orders.SourceCheckout,
+		Currency:        "ZAR",
+		Amount:          99.5,
+		CreatedAt:       created,
+		UpdatedAt:       created,
+	}
+	if err := store.Create(ctx, order); err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	if err := store.Create(ctx, order); !errors.Is(err, orders.ErrExists) {
+		t.Errorf("Create() duplicate error = %v, want ErrExists", err)
+	}
+
+	got, err := store.Get(ctx, "SQL-1")
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	if got.MerchantNo != "M-1" || got.StoreNo != "S-1" || got.State != orders.StateCreated || got.Source != orders.SourceCheckout ||
+		got.Currency != "ZAR" || got.Amount != 99.5 || !got.CreatedAt.Equal(created) || got.Version != 0 {
+		t.Errorf("Get() = %+v, want the created order", got)
+	}
+	if _, err := store.Get(ctx, "SQL-404"); !errors.Is(err, orders.ErrNotFound) {
+		t.Errorf("Get() unknown order error = %v, want ErrNotFound", err)
+	}
+
+	stale := got
+	got.State = orders.StatePaid
+	got.Source = orders.SourceNotification
+	got.TransactionID = "TX-1"
+	got.PaidAmount = 99.5
+	got.UpdatedAt = created.Add(time.Minute)
+	if err := store.Update(ctx, got); err != nil {
+		t.Fatalf("Update() error = %v", err)
+	}
+	updated, _ := store.Get(ctx, "SQL-1")
+	if updated.State != orders.StatePaid || updated.TransactionID != "TX-1" || updated.PaidAmount != 99.5 ||
+		!updated.UpdatedAt.Equal(got.UpdatedAt) || updated.Version != 1 {
+		t.Errorf("updated order = %+v", updated)
+	}
+
+	// A writer holding the order from before the update conflicts
+	stale.State = orders.StateFailed
+	if err := store.Update(ctx, stale); !errors.Is(err, orders.ErrConflict) {
+		t.Errorf("Update() stale version error = %v, want ErrConflict", err)
+	}
+	if err := store.Update(ctx, orders.Order{MerchantOrderNo: "SQL-404"}); !errors.Is(err, orders.ErrNotFound) {
+		t.Errorf("Update() unknown order error = %v, want ErrNotFound", err)
+	}
+}
@@ -0,0 +1,356 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/mdwt/addpay-go/client"
+	"github.com/mdwt/addpay-go/outbox"
+	"github.com/mdwt/addpay-go/sqlbind"
+	"github.com/mdwt/addpay-go/types"
+)
+
+// newOutboxGateway serves checkouts and order queries, counting checkouts.
+// Orders listed in known exist at the gateway; "REJECT-" orders are refused
+// and "DOWN-" orders fail with a server error.
+func newOutboxGateway(t *testing.T, known map[string]bool, checkouts *int32) client.Client {
+	t.Helper()
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		orderNo := r.PostForm.Get("merchant_order_no")
+		switch r.URL.Path {
+		case "/checkout":
+			atomic.AddInt32(checkouts, 1)
+			switch orderNo {
+			case "REJECT-1":
+				w.Write([]byte(`{"success":false,"error":{"code":"INVALID_AMOUNT","message":"invalid amount"}}`))
+			case "DOWN-1":
+				w.WriteHeader(http.StatusBadGateway)
+				w.Write([]byte("upstream unavailable"))
+			default:
+				w.Write([]byte(`{"success":true,"data":{"pay_url":"https://pay.example/` + orderNo + `"}}`))
+			}
+		case "/query-order":
+			if !known[orderNo] {
+				w.Write([]byte(`{"success":false,"error":{"code":"ORDER_NOT_EXIST","message":"order does not exist"}}`))
+				return
+			}
+			w.Write([]byte(`{"success":true,"data":{"merchant_order_no":"` + orderNo + `","order_status":"WAIT_PAY"}}`))
+		default:
+			http.NotFound(w, r)
+		}
+	})
+
+	c := newTestClient(t, handler)
+	return c
+}
+
+// enqueueCheckout adds a checkout message, optionally as left by a crashed worker
+func enqueueCheckout(t *testing.T, store *outbox.MemoryStore, orderNo string, crashed bool) outbox.Message {
+	t.Helper()
+
+	m, err := outbox.HostedCheckout(types.CheckoutRequest{MerchantOrderNo: orderNo, PriceCurrency: "ZAR", OrderAmount: 10, ExpiresIn: time.Hour})
+	if err != nil {
+		t.Fatalf("HostedCheckout() error = %v", err)
+	}
+	if crashed {
+		m.Status = outbox.StatusInFlight
+		m.Attempts = 1
+		m.NextAttemptAt = time.Now().Add(-time.Second)
+	}
+	if err := store.Enqueue(context.Background(), m); err != nil {
+		t.Fatalf("Enqueue() error = %v", err)
+	}
+	return m
+}
+
+func TestOutboxDispatch(t *testing.T) {
+	var checkouts int32
+	c := newOutboxGateway(t, nil, &checkouts)
+	store := outbox.NewMemoryStore()
+	ctx := context.Background()
+
+	m := enqueueCheckout(t, store, "ORDER-1", false)
+	if m.ID != "hosted_checkout:ORDER-1" {
+		t.Errorf("ID = %q", m.ID)
+	}
+	// A relative expiry is fixed when the call is recorded
+	var payload types.CheckoutRequest
+	if err := json.Unmarshal(m.Payload, &payload); err != nil || payload.Expires < time.Now().Add(59*time.Minute).Unix() {
+		t.Errorf("payload = %s, want the expiry kept", m.Payload)
+	}
+	if err := store.Enqueue(ctx, m); err == nil {
+		t.Error("Enqueue() accepted the same call twice")
+	}
+
+	var outcomes []outbox.Message
+	worker := outbox.NewWorker(store, c).OnOutcome(func(ctx context.Context, m outbox.Message) error {
+		outcomes = append(outcomes, m)
+		return nil
+	})
+
+	n, err := worker.RunOnce(ctx)
+	if err != nil || n != 1 {
+		t.Fatalf("RunOnce() = %d, %v", n, err)
+	}
+	done, _ := store.Get(ctx, m.ID)
+	var response types.CheckoutResponse
+	if err := done.DecodeResult(&response); err != nil {
+		t.Fatalf("DecodeResult() error = %v", err)
+	}
+	if done.Status != outbox.StatusDone || response.PayURL != "https://pay.example/ORDER-1" || len(outcomes) != 1 {
+		t.Errorf("message = %+v", done)
+	}
+
+	// Done messages are not sent again
+	if n, _ := worker.RunOnce(ctx); n != 0 || atomic.LoadInt32(&checkouts) != 1 {
+		t.Errorf("second run attempted %d messages, %d checkouts", n, checkouts)
+	}
+}
+
+func TestOutboxRecovery(t *testing.T) {
+	var checkouts int32
+	c := newOutboxGateway(t, map[string]bool{"SENT-1": true}, &checkouts)
+	store := outbox.NewMemoryStore()
+	ctx := context.Background()
+
+	// One call reached the gateway before the crash, the other did not
+	sent := enqueueCheckout(t, store, "SENT-1", true)
+	lost := enqueueCheckout(t, store, "LOST-1", true)
+
+	if _, err := outbox.NewWorker(store, c).RunOnce(ctx); err != nil {
+		t.Fatalf("RunOnce() error = %v", err)
+	}
+
+	m, _ := store.Get(ctx, sent.ID)
+	var order types.QueryOrderResponse
+	if m.Status != outbox.StatusDone || !m.Recovered || m.DecodeResult(&order) != nil || order.OrderStatus != "WAIT_PAY" {
+		t.Errorf("sent message = %+v", m)
+	}
+	m, _ = store.Get(ctx, lost.ID)
+	if m.Status != outbox.StatusDone || m.Recovered {
+		t.Errorf("lost message = %+v", m)
+	}
+	if checkouts != 1 {
+		t.Errorf("checkouts = %d, want only the lost call resent", checkouts)
+	}
+}
+
+func TestOutboxFailures(t *testing.T) {
+	var checkouts int32
+	c := newOutboxGateway(t, nil, &checkouts)
+	store := outbox.NewMemoryStore()
+	ctx := context.Background()
+
+	rejected := enqueueCheckout(t, store, "REJECT-1", false)
+	down := enqueueCheckout(t, store, "DOWN-1", false)
+
+	if _, err := outbox.NewWorker(store, c).RunOnce(ctx); err != nil {
+		t.Fatalf("RunOnce() error = %v", err)
+	}
+
+	m, _ := store.Get(ctx, rejected.ID)
+	if m.Status != outbox.StatusFailed || m.LastError == "" {
+		t.Errorf("rejected message = %+v", m)
+	}
+
+	// A server error leaves the outcome unknown, so the message waits to be recovered
+	m, _ = store.Get(ctx, down.ID)
+	if m.Status != outbox.StatusInFlight || m.Attempts != 1 || !m.NextAttemptAt.After(time.Now()) || m.LastError == "" {
+		t.Errorf("unavailable message = %+v", m)
+	}
+}
+
+func TestOutboxRefundRecovery(t *testing.T) {
+	// The order was partly refunded by REFUND-A; REFUND-B never reached the gateway
+	var refunds int32
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		refundNo := r.PostForm.Get("refund_no")
+		switch r.URL.Path {
+		case "/query-order":
+			w.Write([]byte(`{"success":true,"data":{"merchant_order_no":"PAID-1","order_status":"PARTIALLY_REFUNDED"}}`))
+		case "/query-refund":
+			if refundNo != "REFUND-A" {
+				w.Write([]byte(`{"success":false,"error":{"code":"REFUND_NOT_EXIST","message":"refund does not exist"}}`))
+				return
+			}
+			w.Write([]byte(`{"success":true,"data":{"refund_no":"REFUND-A","refund_id":"R-1","refund_status":"SUCCESS"}}`))
+		case "/refund":
+			atomic.AddInt32(&refunds, 1)
+			w.Write([]byte(`{"success":true,"data":{"refund_no":"` + refundNo + `","refund_id":"R-2","refund_status":"PROCESSING"}}`))
+		default:
+			http.NotFound(w, r)
+		}
+	})
+	c := newTestClient(t, handler)
+	store := outbox.NewMemoryStore()
+	ctx := context.Background()
+
+	ids := map[string]string{}
+	for _, refundNo := range []string{"REFUND-A", "REFUND-B"} {
+		m, err := outbox.Refund(types.RefundRequest{MerchantOrderNo: "PAID-1", RefundNo: refundNo, RefundAmount: 5})
+		if err != nil {
+			t.Fatalf("Refund() error = %v", err)
+		}
+		m.Status = outbox.StatusInFlight
+		m.Attempts = 1
+		m.NextAttemptAt = time.Now().Add(-time.Second)
+		if err := store.Enqueue(ctx, m); err != nil {
+			t.Fatalf("Enqueue() error = %v", err)
+		}
+		ids[refundNo] = m.ID
+	}
+
+	if _, err := outbox.NewWorker(store, c).RunOnce(ctx); err != nil {
+		t.Fatalf("RunOnce() error = %v", err)
+	}
+
+	var refund types.RefundResponse
+	m, _ := store.Get(ctx, ids["REFUND-A"])
+	if m.Status != outbox.StatusDone || !m.Recovered || m.DecodeResult(&refund) != nil || refund.RefundID != "R-1" {
+		t.Errorf("sent refund = %+v", m)
+	}
+	m, _ = store.Get(ctx, ids["REFUND-B"])
+	if m.Status != outbox.StatusDone || m.Recovered {
+		t.Errorf("lost refund = %+v, want it sent despite the refunded order status", m)
+	}
+	if refunds != 1 {
+		t.Errorf("refunds = %d, want only the lost refund sent", refunds)
+	}
+}
+
+func TestOutboxLeaseLost(t *testing.T) {
+	store := outbox.NewMemoryStore()
+	ctx := context.Background()
+	m := enqueueCheckout(t, store, "SLOW-1", false)
+
+	// The first worker's lease runs out and a second worker claims the message
+	if ok, err := store.Claim(ctx, m, time.Now().Add(-time.Second)); !ok || err != nil {
+		t.Fatalf("Claim() = %v, %v", ok, err)
+	}
+	first, _ := store.Get(ctx, m.ID)
+	if ok, err := store.Claim(ctx, first, time.Now().Add(time.Minute)); !ok || err != nil {
+		t.Fatalf("second Claim() = %v, %v", ok, err)
+	}
+
+	first.Status = outbox.StatusFailed
+	if err := store.Save(ctx, first); !errors.Is(err, outbox.ErrLeaseLost) {
+		t.Errorf("Save() by the first worker error = %v, want ErrLeaseLost", err)
+	}
+	if current, _ := store.Get(ctx, m.ID); current.Status != outbox.StatusInFlight || current.Attempts != 2 {
+		t.Errorf("message = %+v, want the second claim kept", current)
+	}
+}
+
+func TestOutboxSQLStore(t *testing.T) {
+	db := newFakeDB(t)
+	ctx := context.Background()
+
+	if _, err := outbox.NewSQLStore(db, "outbox; DROP TABLE x"); err == nil {
+		t.Error("NewSQLStore() accepted an invalid table name")
+	}
+	store, err := outbox.NewSQLStore(db, "addpay_outbox")
+	if err != nil {
+		t.Fatalf("NewSQLStore() error = %v", err)
+	}
+	store = store.WithBindStyle(sqlbind.Dollar)
+	if err := store.CreateTable(ctx); err != nil {
+		t.Fatalf("CreateTable() error = %v", err)
+	}
+	if err := store.CreateTable(ctx); err != nil {
+		t.Errorf("CreateTable() twice error = %v", err)
+	}
+
+	enqueue := func(orderNo string, commit bool) outbox.Message {
+		t.Helper()
+		m, err := outbox.TokenizedPay(types.TokenizedPayRequest{MerchantOrderNo: orderNo, Token: "tok", PriceCurrency: "ZAR", OrderAmount: 10})
+		if err != nil {
+			t.Fatalf("TokenizedPay() error = %v", err)
+		}
+		tx, err := db.BeginTx(ctx, nil)
+		if err != nil {
+			t.Fatalf("BeginTx() error = %v", err)
+		}
+		if err := store.Enqueue(ctx, tx, m); err != nil {
+			t.Fatalf("Enqueue() error = %v", err)
+		}
+		if commit {
+			err = tx.Commit()
+		} else {
+			err = tx.Rollback()
+		}
+		if err != nil {
+			t.Fatalf("ending transaction: %v", err)
+		}
+		return m
+	}
+
+	m := enqueue("SQL-1", true)
+	rolledBack := enqueue("SQL-2", false)
+	if _, err := store.Get(ctx, rolledBack.ID); !errors.Is(err, outbox.ErrNotFound) {
+		t.Errorf("Get() rolled back message error = %v, want ErrNotFound", err)
+	}
+	tx, _ := db.BeginTx(ctx, nil)
+	if err := store.Enqueue(ctx, tx, m); err == nil {
+		t.Error("Enqueue() accepted the same call twice")
+	}
+	tx.Rollback()
+
+	due, err := store.Due(ctx, time.Now().Add(time.Second), 10)
+	if err != nil || len(due) != 1 || due[0].ID != m.ID || due[0].Status != outbox.StatusPending || string(due[0].Payload) != string(m.Payload) {
+		t.Fatalf("Due() = %+v, %v", due, err)
+	}
+
+	// Only one of two workers that read the same row gets the claim
+	if ok, err := store.Claim(ctx, due[0], time.Now().Add(-time.Second)); !ok || err != nil {
+		t.Fatalf("Claim() = %v, %v", ok, err)
+	}
+	if ok, err := store.Claim(ctx, due[0], time.Now().Add(time.Minute)); ok || err != nil {
+		t.Errorf("stale Claim() = %v, %v, want false", ok, err)
+	}
+
+	// An expired lease is claimed again, and the first worker's outcome is refused
+	first, _ := store.Get(ctx, m.ID)
+	if first.Status != outbox.StatusInFlight || first.Attempts != 1 {
+		t.Fatalf("claimed message = %+v", first)
+	}
+	due, _ = store.Due(ctx, time.Now(), 10)
+	if len(due) != 1 {
+		t.Fatalf("Due() after an expired lease = %+v", due)
+	}
+	if ok, err := store.Claim(ctx, due[0], time.Now().Add(time.Minute)); !ok || err != nil {
+		t.Fatalf("second Claim() = %v, %v", ok, err)
+	}
+	first.Status = outbox.StatusDone
+	if err := store.Save(ctx, first); !errors.Is(err, outbox.ErrLeaseLost) {
+		t.Errorf("Save() by the first worker error = %v, want ErrLeaseLost", err)
+	}
+
+	second, _ := store.Get(ctx, m.ID)
+	second.Status = outbox.StatusDone
+	second.Result = json.RawMessage(`{"transaction_id":"TX-1"}`)
+	second.Recovered = true
+	if err := store.Save(ctx, second); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+	saved, _ := store.Get(ctx, m.ID)
+	if saved.Status != outbox.StatusDone || saved.Attempts != 2 || !saved.Recovered || string(saved.Result) != `{"transaction_id":"TX-1"}` {
+		t.Errorf("saved message = %+v", saved)
+	}
+	if due, _ := store.Due(ctx, time.Now().Add(time.Hour), 10); len(due) != 0 {
+		t.Errorf("Due() returned a done message: %+v", due)
+	}
+
+	gone := m
+	gone.ID = "tokenized_pay:MISSING"
+	if err := store.Save(ctx, gone); !errors.Is(err, outbox.ErrNotFound) {
+		t.Errorf("Save() of an unknown message error = %v, want ErrNotFound", err)
+	}
+}
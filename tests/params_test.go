@@ -0,0 +1,59 @@
+package tests
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/mdwt/addpay-go/types"
+)
+
+// TestSignedParameterFormat pins how numbers are written into the signed
+// request parameters. The gateway verifies the signature over these exact
+// strings, so a change here breaks every request that carries the value.
+func TestSignedParameterFormat(t *testing.T) {
+	var form url.Values
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		form = r.PostForm
+		w.Write([]byte(`{"success":true,"data":{}}`))
+	})
+	c := newTestClient(t, handler)
+	ctx := context.Background()
+
+	_, err := c.HostedCheckout(ctx, types.CheckoutRequest{
+		MerchantOrderNo: "FMT-1",
+		PriceCurrency:   "ZAR",
+		OrderAmount:     1000000,
+		Expires:         1760000000,
+	})
+	if err != nil {
+		t.Fatalf("HostedCheckout() error = %v", err)
+	}
+	// Unix times and large amounts are written in full, never as 1.76e+09 or 1e+06
+	if form.Get("expires") != "1760000000" || form.Get("order_amount") != "1000000" {
+		t.Errorf("checkout params = %v", form)
+	}
+
+	_, err = c.TokenizedPay(ctx, types.TokenizedPayRequest{
+		MerchantOrderNo: "FMT-2",
+		Token:           "tok_abcdef123456",
+		PriceCurrency:   "ZAR",
+		OrderAmount:     1234567.89,
+	})
+	if err != nil {
+		t.Fatalf("TokenizedPay() error = %v", err)
+	}
+	if form.Get("order_amount") != "1234567.89" {
+		t.Errorf("order_amount = %q, want 1234567.89", form.Get("order_amount"))
+	}
+
+	_, err = c.Refund(ctx, types.RefundRequest{MerchantOrderNo: "FMT-2", RefundNo: "R-1", RefundAmount: 0.5})
+	if err != nil {
+		t.Fatalf("Refund() error = %v", err)
+	}
+	if form.Get("refund_amount") != "0.5" {
+		t.Errorf("refund_amount = %q, want 0.5", form.Get("refund_amount"))
+	}
+}
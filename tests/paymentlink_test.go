@@ -0,0 +1,161 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mdwt/addpay-go/types"
+)
+
+func TestPaymentLinks(t *testing.T) {
+	var created map[string]string
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		form := r.PostForm
+		switch r.URL.Path {
+		case "/create-payment-link":
+			created = map[string]string{}
+			for key := range form {
+				created[key] = form.Get(key)
+			}
+			w.Write([]byte(`{"success":true,"data":{"link_id":"LNK-1","link_url":"https://pay.example/l/LNK-1","title":"` +
+				form.Get("title") + `","status":"ACTIVE","use_count":0,"max_uses":` + form.Get("max_uses") +
+				`,"metadata":` + strconv.Quote(form.Get("metadata")) + `}}`))
+		case "/query-payment-link":
+			w.Write([]byte(`{"success":true,"data":{"link_id":"LNK-1","status":"ACTIVE","use_count":3,"max_uses":3,"metadata":{"invoice":"INV-7"}}}`))
+		case "/update-payment-link":
+			w.Write([]byte(`{"success":true,"data":{"link_id":"LNK-1","status":"` + form.Get("status") + `"}}`))
+		case "/delete-payment-link":
+			w.Write([]byte(`{"success":true,"data":{"link_id":"LNK-1","status":"DELETED"}}`))
+		case "/list-payment-link-payments":
+			if form.Get("page_no") == "1" {
+				w.Write([]byte(`{"success":true,"data":{"total":2,"transactions":[{"merchant_order_no":"L-1","order_status":"PAID"},{"merchant_order_no":"L-2","order_status":"PAID"}]}}`))
+				return
+			}
+			t.Errorf("unexpected page %s", form.Get("page_no"))
+		default:
+			http.NotFound(w, r)
+		}
+	})
+
+	c := newTestClient(t, handler)
+	ctx := context.Background()
+
+	link, err := c.CreatePaymentLink(ctx, types.CreatePaymentLinkRequest{
+		Title:         "Invoice 7",
+		PriceCurrency: "ZAR",
+		MinAmount:     10,
+		Expires:       time.Now().Add(24 * time.Hour).Unix(),
+		MaxUses:       3,
+		Metadata:      types.Metadata{"invoice": "INV-7"},
+	})
+	if err != nil {
+		t.Fatalf("CreatePaymentLink() error = %v", err)
+	}
+	if link.LinkID != "LNK-1" || link.Metadata["invoice"] != "INV-7" || !link.OpenAmount() || link.RemainingUses() != 3 {
+		t.Errorf("CreatePaymentLink() = %+v", link)
+	}
+
+	// Metadata travels as one JSON-encoded parameter, and an open amount is not sent
+	var metadata map[string]string
+	if err := json.Unmarshal([]byte(created["metadata"]), &metadata); err != nil || metadata["invoice"] != "INV-7" {
+		t.Errorf("metadata parameter = %q", created["metadata"])
+	}
+	if _, ok := created["amount"]; ok {
+		t.Errorf("open-amount link sent amount %q", created["amount"])
+	}
+
+	// A link that reached its maximum uses no longer accepts payment
+	link, err = c.GetPaymentLink(ctx, "LNK-1")
+	if err != nil {
+		t.Fatalf("GetPaymentLink() error = %v", err)
+	}
+	if link.RemainingUses() != 0 || link.Payable(time.Now()) || link.Metadata["invoice"] != "INV-7" {
+		t.Errorf("GetPaymentLink() = %+v", link)
+	}
+
+	link, err = c.UpdatePaymentLink(ctx, types.UpdatePaymentLinkRequest{LinkID: "LNK-1", Status: types.LinkStatusInactive})
+	if err != nil || link.Status != types.LinkStatusInactive {
+		t.Errorf("UpdatePaymentLink() = %+v, %v", link, err)
+	}
+	if _, err := c.UpdatePaymentLink(ctx, types.UpdatePaymentLinkRequest{LinkID: "LNK-1", Status: types.LinkStatusExpired}); err == nil {
+		t.Error("UpdatePaymentLink() accepted a status the merchant cannot set")
+	}
+
+	if err := c.DeletePaymentLink(ctx, "LNK-1"); err != nil {
+		t.Errorf("DeletePaymentLink() error = %v", err)
+	}
+
+	var orders []string
+	for tx, err := range c.LinkPayments(ctx, "LNK-1") {
+		if err != nil {
+			t.Fatalf("LinkPayments() error = %v", err)
+		}
+		orders = append(orders, tx.MerchantOrderNo)
+	}
+	if len(orders) != 2 {
+		t.Errorf("LinkPayments() = %v, want 2 payments", orders)
+	}
+}
+
+func TestPaymentLinkValidation(t *testing.T) {
+	tests := []struct {
+		name string
+		req  types.CreatePaymentLinkRequest
+	}{
+		{"negative amount", types.CreatePaymentLinkRequest{Amount: -1}},
+		{"limits on fixed amount", types.CreatePaymentLinkRequest{Amount: 50, MaxAmount: 100}},
+		{"min above max", types.CreatePaymentLinkRequest{MinAmount: 100, MaxAmount: 50}},
+		{"negative uses", types.CreatePaymentLinkRequest{Amount: 50, MaxUses: -1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.req.Validate(); err == nil {
+				t.Error("Validate() = nil, want error")
+			}
+		})
+	}
+
+	if err := (types.CreatePaymentLinkRequest{Amount: 50, MaxUses: 1}).Validate(); err != nil {
+		t.Errorf("Validate() fixed amount error = %v", err)
+	}
+}
+
+func TestLinkPaymentsIgnoredPageNumber(t *testing.T) {
+	// A full page of 100 payments, returned whatever page_no is asked for
+	var page strings.Builder
+	page.WriteString(`{"success":true,"data":{"transactions":[`)
+	for i := 0; i < 100; i++ {
+		if i > 0 {
+			page.WriteByte(',')
+		}
+		fmt.Fprintf(&page, `{"transaction_id":"TX-%d","merchant_order_no":"L-%d"}`, i, i)
+	}
+	page.WriteString(`]}}`)
+
+	requests := 0
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Write([]byte(page.String()))
+	})
+	c := newTestClient(t, handler)
+
+	payments := 0
+	var listErr error
+	for _, err := range c.LinkPayments(context.Background(), "LNK-1") {
+		if err != nil {
+			listErr = err
+			break
+		}
+		payments++
+	}
+	if listErr == nil || payments != 100 || requests != 2 {
+		t.Errorf("LinkPayments() = %d payments after %d requests, error %v; want the first page then an error", payments, requests, listErr)
+	}
+}
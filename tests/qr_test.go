@@ -0,0 +1,198 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"image/png"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mdwt/addpay-go/qrcode"
+	"github.com/mdwt/addpay-go/types"
+)
+
+// helloLow is "hello" at level Low, cross-checked against an independent encoder
+var helloLow = []string{
+	"#######..#.##.#######",
+	"#.....#.##.#..#.....#",
+	"#.###.#.##..#.#.###.#",
+	"#.###.#..#.#..#.###.#",
+	"#.###.#.#...#.#.###.#",
+	"#.....#.#..##.#.....#",
+	"#######.#.#.#.#######",
+	"........#####........",
+	"##.#..##.##...###.##.",
+	".#####.###....#....##",
+	"..##.####.#.##...##.#",
+	"...#.#..#..#.....#.##",
+	"....#.##.##.#.#.#....",
+	"........####...##.#.#",
+	"#######.###..#.#.###.",
+	"#.....#..#####.##....",
+	"#.###.#..#.#..###...#",
+	"#.###.#.#.##...#.####",
+	"#.###.#..##.#...#.#.#",
+	"#.....#.###..##......",
+	"#######.#.###..#.#.#.",
+}
+
+func TestQREncode(t *testing.T) {
+	code, err := qrcode.Encode([]byte("hello"), qrcode.Low)
+	if err != nil {
+		t.Fatalf("Encode() error = %v", err)
+	}
+	if code.Version() != 1 || code.Size() != 21 {
+		t.Fatalf("Encode() version %d size %d, want 1 and 21", code.Version(), code.Size())
+	}
+	for y, row := range helloLow {
+		for x, module := range row {
+			if code.Dark(x, y) != (module == '#') {
+				t.Fatalf("module %d,%d differs from the reference symbol", x, y)
+			}
+		}
+	}
+
+	// Longer payloads and higher levels need larger versions
+	payload := []byte("https://pay.example.com/qr/" + strings.Repeat("a", 200))
+	low, _ := qrcode.Encode(payload, qrcode.Low)
+	high, err := qrcode.Encode(payload, qrcode.High)
+	if err != nil {
+		t.Fatalf("Encode() High error = %v", err)
+	}
+	if high.Version() <= low.Version() || high.Size() != high.Version()*4+17 {
+		t.Errorf("High version %d, Low version %d", high.Version(), low.Version())
+	}
+
+	if _, err := qrcode.Encode(make([]byte, 3000), qrcode.Low); !errors.Is(err, qrcode.ErrTooLong) {
+		t.Errorf("Encode() oversized error = %v, want ErrTooLong", err)
+	}
+}
+
+func TestQRRender(t *testing.T) {
+	code, _ := qrcode.Encode([]byte("hello"), qrcode.Low)
+
+	data, err := code.PNG(4)
+	if err != nil {
+		t.Fatalf("PNG() error = %v", err)
+	}
+	img, err := png.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("PNG() output does not decode: %v", err)
+	}
+	if width := img.Bounds().Dx(); width != (21+8)*4 {
+		t.Errorf("PNG width = %d, want %d", width, (21+8)*4)
+	}
+	// The quiet zone is light and the finder corner is dark
+	if r, _, _, _ := img.At(0, 0).RGBA(); r == 0 {
+		t.Error("quiet zone is not light")
+	}
+	if r, _, _, _ := img.At(4*4, 4*4).RGBA(); r != 0 {
+		t.Error("top left module is not dark")
+	}
+
+	svg := string(code.SVG(4))
+	if !strings.HasPrefix(svg, "<svg") || !strings.Contains(svg, `viewBox="0 0 29 29"`) || !strings.Contains(svg, "M4 4h1v1h-1z") {
+		t.Errorf("SVG() = %.120s...", svg)
+	}
+}
+
+func TestQROrderFlow(t *testing.T) {
+	queries := 0
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		switch r.URL.Path {
+		case "/qr-order":
+			if r.PostForm.Get("store_no") != "POS-STORE" {
+				t.Errorf("store_no = %s, want the configured store", r.PostForm.Get("store_no"))
+			}
+			w.Write([]byte(`{"success":true,"data":{"merchant_order_no":"QR-1","transaction_id":"TX-1","qr_code":"https://pay.example.com/qr/TX-1"}}`))
+		case "/query-order":
+			queries++
+			status := "PENDING"
+			if queries >= 3 {
+				status = "SUCCESS"
+			}
+			w.Write([]byte(`{"success":true,"data":{"merchant_order_no":"` + r.PostForm.Get("merchant_order_no") + `","order_status":"` + status + `"}}`))
+		case "/cancel-order":
+			w.Write([]byte(`{"success":true,"data":{"merchant_order_no":"QR-2","order_status":"CANCELLED"}}`))
+		default:
+			http.NotFound(w, r)
+		}
+	})
+
+	c := newTestClientWithConfig(t, handler, types.Config{
+		StoreNo: "POS-STORE",
+	})
+	ctx := context.Background()
+
+	order, err := c.CreateQROrder(ctx, types.QROrderRequest{MerchantOrderNo: "QR-1", PriceCurrency: "ZAR", OrderAmount: 25})
+	if err != nil {
+		t.Fatalf("CreateQROrder() error = %v", err)
+	}
+	if _, err := qrcode.Encode([]byte(order.QRCode), qrcode.Medium); err != nil {
+		t.Errorf("QR payload does not encode: %v", err)
+	}
+
+	paid, err := c.WaitForPayment(ctx, types.QueryOrderRequest{MerchantOrderNo: "QR-1"}, time.Millisecond)
+	if err != nil {
+		t.Fatalf("WaitForPayment() error = %v", err)
+	}
+	if paid.OrderStatus != "SUCCESS" || queries != 3 {
+		t.Errorf("WaitForPayment() = %+v after %d queries", paid, queries)
+	}
+
+	// A deadline ends the wait while the order is still pending
+	queries = -100
+	waitCtx, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+	defer cancel()
+	if _, err := c.WaitForPayment(waitCtx, types.QueryOrderRequest{MerchantOrderNo: "QR-2"}, 5*time.Millisecond); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("WaitForPayment() past deadline error = %v", err)
+	}
+
+	cancelled, err := c.CancelOrder(ctx, types.CancelOrderRequest{MerchantOrderNo: "QR-2"})
+	if err != nil {
+		t.Fatalf("CancelOrder() error = %v", err)
+	}
+	if types.ParsePaymentStatus(cancelled.OrderStatus) != types.PaymentCancelled {
+		t.Errorf("CancelOrder() = %+v", cancelled)
+	}
+}
+
+func TestWaitForPaymentRetriesFailedQueries(t *testing.T) {
+	queries := 0
+	failUntil := 1
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		queries++
+		if queries <= failUntil {
+			http.Error(w, "temporarily unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte(`{"success":true,"data":{"merchant_order_no":"QR-3","order_status":"SUCCESS"}}`))
+	})
+	c := newTestClient(t, handler)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	paid, err := c.WaitForPayment(ctx, types.QueryOrderRequest{MerchantOrderNo: "QR-3"}, time.Millisecond)
+	if err != nil {
+		t.Fatalf("WaitForPayment() error = %v", err)
+	}
+	if paid.OrderStatus != "SUCCESS" || queries != 2 {
+		t.Errorf("WaitForPayment() = %+v after %d queries", paid, queries)
+	}
+
+	// A gateway that keeps failing is polled until the deadline
+	queries, failUntil = 0, 1<<30
+	waitCtx, cancelWait := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancelWait()
+	_, err = c.WaitForPayment(waitCtx, types.QueryOrderRequest{MerchantOrderNo: "QR-3"}, time.Millisecond)
+	if !errors.Is(err, context.DeadlineExceeded) || !strings.Contains(err.Error(), "HTTP 503") {
+		t.Errorf("WaitForPayment() error = %v, want deadline and last query error", err)
+	}
+	if queries < 2 {
+		t.Errorf("WaitForPayment() stopped after %d failed queries", queries)
+	}
+}
@@ -0,0 +1,153 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/mdwt/addpay-go/reconcile"
+	"github.com/mdwt/addpay-go/settlement"
+	"github.com/mdwt/addpay-go/types"
+)
+
+// reconcileInput covers every kind of discrepancy alongside one clean order
+func reconcileInput() reconcile.Input {
+	return reconcile.Input{
+		Ledger: []reconcile.LedgerEntry{
+			{MerchantOrderNo: "OK", Amount: 100},
+			{MerchantOrderNo: "NOT-SETTLED", Amount: 50},
+			{MerchantOrderNo: "NO-WEBHOOK", Amount: 20},
+			{MerchantOrderNo: "SHORT", Amount: 80},
+			{MerchantOrderNo: "UNPAID", Amount: 10},
+		},
+		Notifications: []types.Notification{
+			{MerchantOrderNo: "OK", OrderStatus: "SUCCESS", OrderAmount: 100},
+			{MerchantOrderNo: "NOT-SETTLED", OrderStatus: "SUCCESS", OrderAmount: 50},
+			{MerchantOrderNo: "SHORT", OrderStatus: "SUCCESS", OrderAmount: 80},
+			{MerchantOrderNo: "UNPAID", OrderStatus: "PENDING", OrderAmount: 10},
+		},
+		Settlements: []settlement.Record{
+			{MerchantOrderNo: "OK", GrossAmount: 100, Fees: 2, NetAmount: 98},
+			{MerchantOrderNo: "NO-WEBHOOK", GrossAmount: 20, NetAmount: 19.5},
+			{MerchantOrderNo: "SHORT", GrossAmount: 79.99, NetAmount: 78},
+			{MerchantOrderNo: "STRAY", GrossAmount: 5, NetAmount: 4.9},
+		},
+	}
+}
+
+func TestReconcile(t *testing.T) {
+	report := reconcile.Reconcile(reconcileInput())
+
+	want := []struct {
+		kind    reconcile.Kind
+		orderNo string
+	}{
+		{reconcile.AmountMismatch, "SHORT"},
+		{reconcile.MissingWebhook, "NO-WEBHOOK"},
+		{reconcile.PaidNotSettled, "NOT-SETTLED"},
+		{reconcile.SettledWithoutOrder, "STRAY"},
+	}
+	if len(report.Discrepancies) != len(want) {
+		t.Fatalf("Discrepancies = %+v", report.Discrepancies)
+	}
+	for i, w := range want {
+		if d := report.Discrepancies[i]; d.Kind != w.kind || d.MerchantOrderNo != w.orderNo {
+			t.Errorf("Discrepancies[%d] = %s %s, want %s %s", i, d.Kind, d.MerchantOrderNo, w.kind, w.orderNo)
+		}
+	}
+	if report.Orders != 5 || report.Matched != 1 {
+		t.Errorf("Orders = %d, Matched = %d, want 5 and 1", report.Orders, report.Matched)
+	}
+
+	var jsonOut bytes.Buffer
+	if err := report.WriteJSON(&jsonOut); err != nil {
+		t.Fatalf("WriteJSON() error = %v", err)
+	}
+	var decoded reconcile.Report
+	if err := json.Unmarshal(jsonOut.Bytes(), &decoded); err != nil || len(decoded.Discrepancies) != 4 {
+		t.Errorf("WriteJSON() output did not round trip: %v", err)
+	}
+
+	var csvOut bytes.Buffer
+	if err := report.WriteCSV(&csvOut); err != nil {
+		t.Fatalf("WriteCSV() error = %v", err)
+	}
+	rows, err := csv.NewReader(&csvOut).ReadAll()
+	if err != nil {
+		t.Fatalf("WriteCSV() output is not CSV: %v", err)
+	}
+	if len(rows) != 5 || rows[1][0] != "amount_mismatch" || rows[1][2] != "80.00" || rows[1][4] != "79.99" {
+		t.Errorf("WriteCSV() rows = %v", rows)
+	}
+}
+
+func TestReconcileWithClient(t *testing.T) {
+	// The gateway knows UNPAID was paid, though no webhook arrived yet
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		status := "PENDING"
+		if r.PostForm.Get("merchant_order_no") == "UNPAID" {
+			status = "SUCCESS"
+		}
+		w.Write([]byte(`{"success":true,"data":{"merchant_order_no":"` + r.PostForm.Get("merchant_order_no") + `","order_status":"` + status + `"}}`))
+	})
+
+	client := newTestClient(t, handler)
+
+	report, err := reconcile.ReconcileWithClient(context.Background(), client, reconcileInput())
+	if err != nil {
+		t.Fatalf("ReconcileWithClient() error = %v", err)
+	}
+
+	kinds := map[reconcile.Kind]int{}
+	for _, d := range report.Discrepancies {
+		if d.MerchantOrderNo == "UNPAID" {
+			kinds[d.Kind]++
+		}
+	}
+	if kinds[reconcile.MissingWebhook] != 1 || kinds[reconcile.PaidNotSettled] != 1 {
+		t.Errorf("UNPAID discrepancies = %v, want missing webhook and not settled", kinds)
+	}
+}
+
+func TestReconcileRefundsAndCurrency(t *testing.T) {
+	report := reconcile.Reconcile(reconcile.Input{
+		Ledger: []reconcile.LedgerEntry{
+			{MerchantOrderNo: "PART-REFUND", Amount: 100, Currency: "ZAR"},
+			{MerchantOrderNo: "TYPED-REFUND", Amount: 60, Currency: "ZAR"},
+			{MerchantOrderNo: "OVER-REFUND", Amount: 40, Currency: "ZAR"},
+			{MerchantOrderNo: "WRONG-CURRENCY", Amount: 25, Currency: "ZAR"},
+		},
+		Notifications: []types.Notification{
+			// The later partial refund notification must not replace the paid amount
+			{MerchantOrderNo: "PART-REFUND", OrderStatus: "SUCCESS", PriceCurrency: "ZAR", OrderAmount: 100, Timestamp: 1},
+			{MerchantOrderNo: "PART-REFUND", OrderStatus: "PARTIALLY_REFUNDED", PriceCurrency: "ZAR", OrderAmount: 30, Timestamp: 2},
+			{MerchantOrderNo: "TYPED-REFUND", OrderStatus: "SUCCESS", PriceCurrency: "ZAR", OrderAmount: 60},
+			{MerchantOrderNo: "OVER-REFUND", OrderStatus: "SUCCESS", PriceCurrency: "ZAR", OrderAmount: 40},
+			{MerchantOrderNo: "WRONG-CURRENCY", OrderStatus: "SUCCESS", PriceCurrency: "USD", OrderAmount: 25},
+		},
+		Settlements: []settlement.Record{
+			{MerchantOrderNo: "PART-REFUND", Currency: "ZAR", GrossAmount: 100},
+			{MerchantOrderNo: "PART-REFUND", Currency: "ZAR", GrossAmount: -30},
+			{MerchantOrderNo: "TYPED-REFUND", Currency: "ZAR", GrossAmount: 60},
+			{MerchantOrderNo: "TYPED-REFUND", Currency: "ZAR", Type: "REFUND", GrossAmount: 60},
+			{MerchantOrderNo: "OVER-REFUND", Currency: "ZAR", GrossAmount: 40},
+			{MerchantOrderNo: "OVER-REFUND", Currency: "ZAR", GrossAmount: -45},
+			{MerchantOrderNo: "WRONG-CURRENCY", Currency: "ZAR", GrossAmount: 25},
+		},
+	})
+
+	if report.Matched != 2 || len(report.Discrepancies) != 2 {
+		t.Fatalf("Matched = %d, Discrepancies = %+v, want the refunded orders matched", report.Matched, report.Discrepancies)
+	}
+	over, currency := report.Discrepancies[0], report.Discrepancies[1]
+	if over.Kind != reconcile.AmountMismatch || over.MerchantOrderNo != "OVER-REFUND" || over.RefundedAmount == nil || *over.RefundedAmount != 45 || *over.SettledAmount != 40 {
+		t.Errorf("Discrepancies[0] = %+v, want the refund exceeding the payment", over)
+	}
+	if currency.Kind != reconcile.CurrencyMismatch || currency.MerchantOrderNo != "WRONG-CURRENCY" {
+		t.Errorf("Discrepancies[1] = %+v, want a currency mismatch", currency)
+	}
+}
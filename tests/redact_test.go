@@ -0,0 +1,208 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/mdwt/addpay-go"
+	"github.com/mdwt/addpay-go/logger"
+	"github.com/mdwt/addpay-go/redact"
+	"github.com/mdwt/addpay-go/types"
+)
+
+func TestRedactString(t *testing.T) {
+	r := redact.Default()
+
+	tests := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{"pan", "card 4111111111111111 declined", "card 411111******1111 declined"},
+		{"pan with spaces", "card 4111 1111 1111 1111", "card 411111******1111"},
+		{"not a pan", "order 4111111111111112", "order 4111111111111112"},
+		{"email", "sent to jane.doe@example.com", "sent to j***@example.com"},
+		{"phone", "call +27 82 123 4567", "call +** ** *** *567"},
+		{"json fields", `{"token":"tok_abcdef123456","account_number":"62001234567"}`, `{"token":"****3456","account_number":"****4567"}`},
+		{"form fields", "app_id=1&sign=c2lnbmF0dXJl&sign_type=RSA2", "app_id=1&sign=[REDACTED]&sign_type=RSA2"},
+		{"plain text", "order ORD-1 paid", "order ORD-1 paid"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := r.String(tt.input); got != tt.want {
+				t.Errorf("String(%q) = %q, want %q", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRedactValues(t *testing.T) {
+	r := redact.Default().WithRules(redact.Rule{
+		Name:    "id_number",
+		Keys:    []string{"id_number"},
+		Pattern: regexp.MustCompile(`\b\d{13}\b`),
+	})
+
+	params := r.Params(map[string]interface{}{
+		"Token":           "tok_abcdef123456",
+		"card_number":     "4111111111111111",
+		"id_number":       "8001015009087",
+		"note":            "customer 8001015009087",
+		"merchant_no":     "M-1",
+		"order_amount":    10.5,
+		"customer_email":  "jane@example.com",
+		"bank_account_no": "",
+	})
+	want := map[string]interface{}{
+		"Token":           "****3456",
+		"card_number":     "411111******1111",
+		"id_number":       "[REDACTED]",
+		"note":            "customer [REDACTED]",
+		"merchant_no":     "M-1",
+		"order_amount":    10.5,
+		"customer_email":  "j***@example.com",
+		"bank_account_no": "",
+	}
+	for key, value := range want {
+		if params[key] != value {
+			t.Errorf("Params()[%q] = %v, want %v", key, params[key], value)
+		}
+	}
+
+	if got := redact.New().String("4111111111111111"); got != "4111111111111111" {
+		t.Errorf("redactor without rules masked %q", got)
+	}
+}
+
+func TestRedactError(t *testing.T) {
+	base := errors.New("declined")
+	err := redact.Default().Error(errors.Join(base, errors.New("card 4111111111111111")))
+
+	if strings.Contains(err.Error(), "4111111111111111") {
+		t.Errorf("Error() = %q, card number not masked", err)
+	}
+	if !errors.Is(err, base) {
+		t.Error("masked error no longer matches the original")
+	}
+}
+
+func TestLoggerRedaction(t *testing.T) {
+	var buf bytes.Buffer
+	log := logger.New(logger.Options{Output: &buf})
+
+	log.Info("paying",
+		"token", "tok_abcdef123456",
+		slog.Group("request", "account_number", "62001234567", "note", "mail jane@example.com"))
+
+	lines := logLines(t, &buf)
+	group, _ := lines[0][logger.Group].(map[string]interface{})
+	request, _ := group["request"].(map[string]interface{})
+	if group["token"] != "****3456" || request["account_number"] != "****4567" || request["note"] != "mail j***@example.com" {
+		t.Errorf("attributes not masked: %v", lines[0])
+	}
+}
+
+func TestClientRedaction(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+		w.Write([]byte(`upstream rejected card_number=4111111111111111 for MEMBER-12345`))
+	})
+
+	// Extra rules add to the defaults, so the token is still masked
+	var buf bytes.Buffer
+	member := redact.Rule{Name: "member", Pattern: regexp.MustCompile(`MEMBER-\d+`)}
+	c := newTestClientWithConfig(t, handler, types.Config{
+		Logger:      addpay.LoggerFromSlog(slog.New(slog.NewJSONHandler(&buf, nil))),
+		RedactRules: []redact.Rule{member},
+	})
+
+	_, err := c.TokenizedPay(context.Background(), types.TokenizedPayRequest{
+		MerchantOrderNo: "RED-1",
+		Token:           "tok_abcdef123456",
+		PriceCurrency:   "ZAR",
+		OrderAmount:     10,
+	})
+	if err == nil {
+		t.Fatal("TokenizedPay() error = nil, want HTTP error")
+	}
+	if want := "HTTP 502: upstream rejected card_number=411111******1111 for [REDACTED]"; err.Error() != want {
+		t.Errorf("error = %q, want %q", err, want)
+	}
+
+	output := buf.String()
+	for _, secret := range []string{"tok_abcdef123456", "4111111111111111", "MEMBER-12345"} {
+		if strings.Contains(output, secret) {
+			t.Errorf("log output contains %q: %s", secret, output)
+		}
+	}
+	if !strings.Contains(output, "****3456") {
+		t.Errorf("token not logged in masked form: %s", output)
+	}
+}
+
+// valueLogger keeps the values of every attribute it is given, unmasked
+type valueLogger struct {
+	mu     sync.Mutex
+	values []interface{}
+}
+
+func (l *valueLogger) record(keysAndValues []interface{}) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.values = append(l.values, keysAndValues...)
+}
+
+func (l *valueLogger) Debug(msg string, keysAndValues ...interface{}) { l.record(keysAndValues) }
+func (l *valueLogger) Info(msg string, keysAndValues ...interface{})  { l.record(keysAndValues) }
+func (l *valueLogger) Warn(msg string, keysAndValues ...interface{})  { l.record(keysAndValues) }
+func (l *valueLogger) Error(msg string, keysAndValues ...interface{}) { l.record(keysAndValues) }
+
+func TestClientSetLoggerRedaction(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"success":true,"data":{"token_status":"ACTIVE"}}`))
+	})
+
+	log := &valueLogger{}
+	c := newTestClient(t, handler).SetLogger(log)
+
+	if _, err := c.QueryToken(context.Background(), types.QueryTokenRequest{Token: "tok_abcdef123456"}); err != nil {
+		t.Fatalf("QueryToken() unexpected error = %v", err)
+	}
+
+	output := fmt.Sprint(log.values...)
+	if strings.Contains(output, "tok_abcdef123456") {
+		t.Errorf("log output contains the token: %s", output)
+	}
+	if !strings.Contains(output, "****3456") {
+		t.Errorf("token not logged in masked form: %s", output)
+	}
+}
+
+func TestClientRedactsAPIErrors(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"success":false,"error":{"code":"CARD_DECLINED","message":"card 4111111111111111 declined","details":"token=tok_abcdef123456"}}`))
+	})
+	c := newTestClient(t, handler)
+
+	_, err := c.TokenizedPay(context.Background(), types.TokenizedPayRequest{
+		MerchantOrderNo: "RED-2",
+		Token:           "tok_abcdef123456",
+		PriceCurrency:   "ZAR",
+		OrderAmount:     10,
+	})
+	var apiErr types.APIError
+	if !errors.As(err, &apiErr) || apiErr.Code != "CARD_DECLINED" {
+		t.Fatalf("TokenizedPay() error = %v, want API error CARD_DECLINED", err)
+	}
+	if apiErr.Message != "card 411111******1111 declined" || apiErr.Details != "token=****3456" {
+		t.Errorf("API error = %+v, want card number and token masked", apiErr)
+	}
+}
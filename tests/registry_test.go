@@ -0,0 +1,238 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/mdwt/addpay-go"
+	"github.com/mdwt/addpay-go/registry"
+	"github.com/mdwt/addpay-go/types"
+)
+
+func TestRegistryLazyLoadAndReload(t *testing.T) {
+	privateKey, publicKey := generateTestKeys(t)
+
+	var loads atomic.Int32
+	var issued [][]byte
+	var issuedMu sync.Mutex
+	provider := registry.KeyProviderFunc(func(ctx context.Context, tenant string) (types.Config, error) {
+		if tenant == "unknown" {
+			return types.Config{}, fmt.Errorf("no such tenant")
+		}
+		n := loads.Add(1)
+
+		key := append([]byte(nil), privateKey...)
+		issuedMu.Lock()
+		issued = append(issued, key)
+		issuedMu.Unlock()
+
+		return types.Config{
+			AppID:              fmt.Sprintf("%s-app-%d", tenant, n),
+			GatewayURL:         "https://api.example.com",
+			MerchantPrivateKey: key,
+			GatewayPublicKey:   publicKey,
+			Logger:             addpay.NewNoOpLogger(),
+		}, nil
+	})
+
+	reg := registry.New(provider)
+	ctx := context.Background()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := reg.Get(ctx, "acme"); err != nil {
+				t.Errorf("Get() unexpected error = %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if got := loads.Load(); got != 1 {
+		t.Errorf("provider loaded %d times, want 1", got)
+	}
+
+	c, _ := reg.Get(ctx, "acme")
+	if c.GetConfig().AppID != "acme-app-1" {
+		t.Errorf("AppID = %s, want acme-app-1", c.GetConfig().AppID)
+	}
+
+	if err := reg.Reload(ctx, "acme"); err != nil {
+		t.Fatalf("Reload() unexpected error = %v", err)
+	}
+	c, _ = reg.Get(ctx, "acme")
+	if c.GetConfig().AppID != "acme-app-2" {
+		t.Errorf("AppID after reload = %s, want acme-app-2", c.GetConfig().AppID)
+	}
+
+	if _, err := reg.Get(ctx, "unknown"); err == nil {
+		t.Error("Get() for unknown tenant should return an error")
+	}
+	if tenants := reg.Tenants(); len(tenants) != 1 || tenants[0] != "acme" {
+		t.Errorf("Tenants() = %v, want [acme]", tenants)
+	}
+
+	// The provider's bytes are left alone, while the client only keeps a
+	// wiped copy
+	issuedMu.Lock()
+	defer issuedMu.Unlock()
+	for _, key := range issued {
+		if !bytes.Equal(key, privateKey) {
+			t.Fatal("provider key material was modified by the registry")
+		}
+	}
+	for _, b := range c.GetConfig().MerchantPrivateKey {
+		if b != 0 {
+			t.Fatal("client config exposes the private key after loading")
+		}
+	}
+}
+
+func TestRegistryReloadCachedConfig(t *testing.T) {
+	privateKey, publicKey := generateTestKeys(t)
+
+	// The provider returns the same cached Config on every load
+	cached := types.Config{
+		AppID:              "acme-app",
+		GatewayURL:         "https://api.example.com",
+		MerchantPrivateKey: privateKey,
+		GatewayPublicKey:   publicKey,
+		Logger:             addpay.NewNoOpLogger(),
+	}
+	var loads atomic.Int32
+	reg := registry.New(registry.KeyProviderFunc(func(ctx context.Context, tenant string) (types.Config, error) {
+		loads.Add(1)
+		return cached, nil
+	}))
+	ctx := context.Background()
+
+	if _, err := reg.Get(ctx, "acme"); err != nil {
+		t.Fatalf("Get() unexpected error = %v", err)
+	}
+	for i := 0; i < 2; i++ {
+		if err := reg.Reload(ctx, "acme"); err != nil {
+			t.Fatalf("Reload() #%d unexpected error = %v", i+1, err)
+		}
+	}
+	if got := loads.Load(); got != 3 {
+		t.Errorf("provider loaded %d times, want 3", got)
+	}
+}
+
+// blockingProvider hands out configs whose nth load waits until gates[n-1]
+// is closed, naming each app after the load number
+type blockingProvider struct {
+	privateKey []byte
+	publicKey  []byte
+	loads      atomic.Int32
+	gates      []chan struct{}
+}
+
+func newBlockingProvider(t *testing.T, loads int) *blockingProvider {
+	privateKey, publicKey := generateTestKeys(t)
+	provider := &blockingProvider{privateKey: privateKey, publicKey: publicKey}
+	for i := 0; i < loads; i++ {
+		provider.gates = append(provider.gates, make(chan struct{}))
+	}
+	return provider
+}
+
+func (p *blockingProvider) Load(ctx context.Context, tenant string) (types.Config, error) {
+	n := p.loads.Add(1)
+	if int(n) > len(p.gates) {
+		return types.Config{}, fmt.Errorf("unexpected load %d of tenant %s", n, tenant)
+	}
+	select {
+	case <-p.gates[n-1]:
+	case <-ctx.Done():
+		return types.Config{}, ctx.Err()
+	}
+	return types.Config{
+		AppID:              fmt.Sprintf("%s-app-%d", tenant, n),
+		GatewayURL:         "https://api.example.com",
+		MerchantPrivateKey: append([]byte(nil), p.privateKey...),
+		GatewayPublicKey:   p.publicKey,
+		Logger:             addpay.NewNoOpLogger(),
+	}, nil
+}
+
+func TestRegistryGetSurvivesCancelledCaller(t *testing.T) {
+	provider := newBlockingProvider(t, 1)
+	reg := registry.New(provider)
+
+	first, cancel := context.WithCancel(context.Background())
+	firstErr := make(chan error, 1)
+	go func() {
+		_, err := reg.Get(first, "acme")
+		firstErr <- err
+	}()
+	for provider.loads.Load() == 0 {
+		runtime.Gosched()
+	}
+
+	second := make(chan error, 1)
+	go func() {
+		_, err := reg.Get(context.Background(), "acme")
+		second <- err
+	}()
+
+	cancel()
+	if err := <-firstErr; !errors.Is(err, context.Canceled) {
+		t.Errorf("cancelled Get() error = %v, want context.Canceled", err)
+	}
+	close(provider.gates[0])
+	if err := <-second; err != nil {
+		t.Errorf("Get() error = %v after another caller gave up", err)
+	}
+	if got := provider.loads.Load(); got != 1 {
+		t.Errorf("provider loaded %d times, want 1", got)
+	}
+}
+
+func TestRegistryReloadDuringGet(t *testing.T) {
+	provider := newBlockingProvider(t, 2)
+	reg := registry.New(provider)
+	ctx := context.Background()
+
+	got := make(chan types.Config, 1)
+	go func() {
+		c, err := reg.Get(ctx, "acme")
+		if err != nil {
+			t.Errorf("Get() error = %v", err)
+		}
+		got <- c.GetConfig()
+	}()
+	for provider.loads.Load() == 0 {
+		runtime.Gosched()
+	}
+
+	// The reload starts after the load of Get, so its client must win even
+	// though Get finishes last
+	reloaded := make(chan error, 1)
+	go func() { reloaded <- reg.Reload(ctx, "acme") }()
+	for provider.loads.Load() < 2 {
+		runtime.Gosched()
+	}
+	close(provider.gates[1])
+	if err := <-reloaded; err != nil {
+		t.Fatalf("Reload() error = %v", err)
+	}
+	close(provider.gates[0])
+	<-got
+
+	c, err := reg.Get(ctx, "acme")
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	if appID := c.GetConfig().AppID; appID != "acme-app-2" {
+		t.Errorf("AppID = %s, want the reloaded acme-app-2", appID)
+	}
+}
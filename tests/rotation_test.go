@@ -0,0 +1,57 @@
+package tests
+
+import (
+	"crypto/rsa"
+	"encoding/base64"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mdwt/addpay-go/auth"
+)
+
+func TestRotatingSigner(t *testing.T) {
+	currentPrivate, currentPublic := generateTestKeys(t)
+	nextPrivate, nextPublic := generateTestKeys(t)
+
+	switchAt := time.Now().Add(time.Hour)
+	signer, err := auth.NewRotatingSignerFromKeys(currentPrivate, nextPrivate, switchAt)
+	if err != nil {
+		t.Fatalf("NewRotatingSignerFromKeys() unexpected error = %v", err)
+	}
+
+	// Before the switch-over, signatures verify with the current public key
+	rsaAuth, err := auth.NewRSAAuthWithSigner(signer, currentPublic)
+	if err != nil {
+		t.Fatalf("NewRSAAuthWithSigner() unexpected error = %v", err)
+	}
+	data := []byte("app_id=test")
+	signature, err := rsaAuth.Sign(data)
+	if err != nil {
+		t.Fatalf("Sign() unexpected error = %v", err)
+	}
+	if err := rsaAuth.Verify(data, signature); err != nil {
+		t.Errorf("Verify() before switch-over unexpected error = %v", err)
+	}
+
+	// After the switch-over, the next key is active
+	nextKey, _ := auth.ParsePrivateKey(nextPrivate)
+	active := signer.Active(switchAt.Add(time.Second))
+	if !active.Public().(*rsa.PublicKey).Equal(&nextKey.PublicKey) {
+		t.Error("Active() after switch-over should return the next key")
+	}
+
+	// The portal form is the base64 X.509 body of the PEM public key
+	encoded, err := auth.PublicKeyBase64(&nextKey.PublicKey)
+	if err != nil {
+		t.Fatalf("PublicKeyBase64() unexpected error = %v", err)
+	}
+	pemBody := strings.Join(strings.Split(strings.TrimSpace(string(nextPublic)), "\n")[1:], "")
+	pemBody = strings.TrimSuffix(pemBody, "-----END PUBLIC KEY-----")
+	if encoded != pemBody {
+		t.Errorf("PublicKeyBase64() = %s, want %s", encoded, pemBody)
+	}
+	if _, err := base64.StdEncoding.DecodeString(encoded); err != nil {
+		t.Errorf("PublicKeyBase64() is not valid base64: %v", err)
+	}
+}
@@ -0,0 +1,156 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mdwt/addpay-go/settlement"
+	"github.com/mdwt/addpay-go/types"
+)
+
+func TestDownloadSettlementReport(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		if r.URL.Path != "/settlement-report" {
+			http.NotFound(w, r)
+			return
+		}
+		if r.PostForm.Get("settlement_date") != "2025-03-01" {
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{"success":false,"error":{"code":"NO_REPORT","message":"no settlement for date"}}`))
+			return
+		}
+		if r.PostForm.Get("store_no") != "STORE-9" {
+			t.Errorf("store_no = %s, want STORE-9", r.PostForm.Get("store_no"))
+		}
+		w.Header().Set("Content-Type", "text/csv")
+		io.WriteString(w, "Order_No,Fee,Gross_Amount,Net_Amount,Settlement_Date,Extra\n"+
+			"ORDER-1,2.50,100.00,97.50,2025-03-01,x\n"+
+			"\n"+
+			"ORDER-2,\"1,000.00\",\"50,000.00\",\"49,000.00\",20250301,y\n")
+	})
+
+	client := newTestClient(t, handler)
+
+	date := time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC)
+	body, err := client.DownloadSettlementReport(context.Background(), date, "STORE-9")
+	if err != nil {
+		t.Fatalf("DownloadSettlementReport() error = %v", err)
+	}
+	defer body.Close()
+
+	var records []settlement.Record
+	for record, err := range settlement.Records(body) {
+		if err != nil {
+			t.Fatalf("Records() error = %v", err)
+		}
+		records = append(records, record)
+	}
+	if len(records) != 2 {
+		t.Fatalf("Records() returned %d records, want 2", len(records))
+	}
+	if r := records[0]; r.MerchantOrderNo != "ORDER-1" || r.GrossAmount != 100 || r.Fees != 2.5 || r.NetAmount != 97.5 || !r.SettlementDate.Equal(date) {
+		t.Errorf("record 1 = %+v", r)
+	}
+	if r := records[1]; r.GrossAmount != 50000 || r.NetAmount != 49000 || !r.SettlementDate.Equal(date) {
+		t.Errorf("record 2 = %+v", r)
+	}
+
+	_, err = client.DownloadSettlementReport(context.Background(), date.AddDate(0, 0, 1), "STORE-9")
+	var apiErr types.APIError
+	if !errors.As(err, &apiErr) || apiErr.Code != "NO_REPORT" {
+		t.Errorf("DownloadSettlementReport() missing day error = %v, want API error NO_REPORT", err)
+	}
+}
+
+func TestDownloadSettlementReportSlowBody(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/csv")
+		io.WriteString(w, "Order_No,Fee,Gross_Amount,Net_Amount,Settlement_Date\n")
+		for i := 1; i <= 5; i++ {
+			w.(http.Flusher).Flush()
+			time.Sleep(40 * time.Millisecond)
+			fmt.Fprintf(w, "ORDER-%d,1.00,10.00,9.00,2025-03-01\n", i)
+		}
+	})
+
+	// The file takes longer to stream than the request timeout
+	client := newTestClientWithConfig(t, handler, types.Config{Timeout: 100 * time.Millisecond})
+
+	date := time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC)
+	body, err := client.DownloadSettlementReport(context.Background(), date, "STORE-9")
+	if err != nil {
+		t.Fatalf("DownloadSettlementReport() error = %v", err)
+	}
+	defer body.Close()
+
+	count := 0
+	for _, err := range settlement.Records(body) {
+		if err != nil {
+			t.Fatalf("Records() error = %v", err)
+		}
+		count++
+	}
+	if count != 5 {
+		t.Errorf("Records() returned %d records, want 5", count)
+	}
+
+	// The caller's context still ends the download
+	ctx, cancel := context.WithCancel(context.Background())
+	body, err = client.DownloadSettlementReport(ctx, date, "STORE-9")
+	if err != nil {
+		t.Fatalf("DownloadSettlementReport() error = %v", err)
+	}
+	defer body.Close()
+	cancel()
+	if _, err := io.ReadAll(body); !errors.Is(err, context.Canceled) {
+		t.Errorf("reading after cancel error = %v, want context.Canceled", err)
+	}
+}
+
+func TestSettlementRecordsErrors(t *testing.T) {
+	for _, err := range settlement.Records(strings.NewReader("order_no,gross\nORDER-1,10\n")) {
+		if err == nil || !strings.Contains(err.Error(), "no fees column") {
+			t.Errorf("Records() missing column error = %v", err)
+		}
+	}
+
+	var parseErr settlement.ParseError
+	for _, err := range settlement.Records(strings.NewReader("order_no,gross,fees,net,settlement_date\nORDER-1,ten,0,10,2025-03-01\n")) {
+		if !errors.As(err, &parseErr) || parseErr.Line != 2 || parseErr.Column != "gross_amount" {
+			t.Errorf("Records() bad amount error = %v", err)
+		}
+	}
+}
+
+func TestSettlementRecordsStreaming(t *testing.T) {
+	// The report is produced while it is parsed, so it is never held in memory
+	const lines = 100000
+	reader, writer := io.Pipe()
+	go func() {
+		io.WriteString(writer, "merchant_order_no,gross_amount,fees,net_amount,settlement_date\n")
+		for i := 0; i < lines; i++ {
+			fmt.Fprintf(writer, "ORDER-%d,10.00,0.25,9.75,2025-03-01\n", i)
+		}
+		writer.Close()
+	}()
+
+	count := 0
+	var net float64
+	for record, err := range settlement.Records(reader) {
+		if err != nil {
+			t.Fatalf("Records() error = %v", err)
+		}
+		count++
+		net += record.NetAmount
+	}
+	if count != lines || net != 9.75*lines {
+		t.Errorf("Records() parsed %d records totalling %.2f", count, net)
+	}
+}
@@ -0,0 +1,77 @@
+package tests
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mdwt/addpay-go"
+	"github.com/mdwt/addpay-go/auth"
+	"github.com/mdwt/addpay-go/types"
+)
+
+func TestFileSigner(t *testing.T) {
+	privateKey, publicKey := generateTestKeys(t)
+
+	path := filepath.Join(t.TempDir(), "merchant.pem")
+	if err := os.WriteFile(path, privateKey, 0o600); err != nil {
+		t.Fatalf("Failed to write key file: %v", err)
+	}
+
+	signer, err := auth.NewFileSigner(path)
+	if err != nil {
+		t.Fatalf("NewFileSigner() unexpected error = %v", err)
+	}
+
+	// Sign with the external signer and verify against its own public key
+	rsaAuth, err := auth.NewRSAAuthWithSigner(signer, publicKey)
+	if err != nil {
+		t.Fatalf("NewRSAAuthWithSigner() unexpected error = %v", err)
+	}
+
+	data := []byte("app_id=test&method=%2Fcheckout")
+	signature, err := rsaAuth.Sign(data)
+	if err != nil {
+		t.Fatalf("Sign() unexpected error = %v", err)
+	}
+	if err := rsaAuth.Verify(data, signature); err != nil {
+		t.Errorf("Verify() unexpected error = %v", err)
+	}
+
+	encrypted, err := rsaAuth.Encrypt([]byte("secret"))
+	if err != nil {
+		t.Fatalf("Encrypt() unexpected error = %v", err)
+	}
+	decrypted, err := rsaAuth.Decrypt(encrypted)
+	if err != nil || string(decrypted) != "secret" {
+		t.Errorf("Decrypt() = %q, %v", decrypted, err)
+	}
+
+	// The client accepts a signer in place of raw key bytes
+	_, err = addpay.NewClient(types.Config{
+		AppID:            "test-app-id",
+		GatewayURL:       "https://api.example.com",
+		MerchantSigner:   signer,
+		GatewayPublicKey: publicKey,
+		Logger:           addpay.NewNoOpLogger(),
+	})
+	if err != nil {
+		t.Errorf("NewClient() with MerchantSigner unexpected error = %v", err)
+	}
+}
+
+func TestSignerRequiresRSAKey(t *testing.T) {
+	_, publicKey := generateTestKeys(t)
+
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate EC key: %v", err)
+	}
+
+	if _, err := auth.NewRSAAuthWithSigner(ecKey, publicKey); err == nil {
+		t.Error("NewRSAAuthWithSigner() with EC key should return an error")
+	}
+}
@@ -0,0 +1,689 @@
+package tests
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"unicode"
+)
+
+// fakeSQL is a database/sql driver backed by in-memory tables. It understands
+// only the statements the SQL stores issue: CREATE TABLE, INSERT, SELECT with
+// ORDER BY, UPDATE and DELETE, with WHERE clauses of comparisons and IN lists
+// joined by AND, plus the COUNT(*) the tests run. Primary keys are enforced
+// and a rolled back transaction restores the tables it started with.
+type fakeSQL struct {
+	mu  sync.Mutex
+	dbs map[string]*fakeDatabase
+}
+
+var fakeDriver = &fakeSQL{dbs: make(map[string]*fakeDatabase)}
+
+func init() {
+	sql.Register("addpayfake", fakeDriver)
+}
+
+// newFakeDB opens an empty database that is closed when the test ends
+func newFakeDB(t *testing.T) *sql.DB {
+	t.Helper()
+
+	db, err := sql.Open("addpayfake", t.Name())
+	if err != nil {
+		t.Fatalf("sql.Open() error = %v", err)
+	}
+	t.Cleanup(func() {
+		db.Close()
+		fakeDriver.mu.Lock()
+		delete(fakeDriver.dbs, t.Name())
+		fakeDriver.mu.Unlock()
+	})
+	return db
+}
+
+func (d *fakeSQL) Open(name string) (driver.Conn, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	db, ok := d.dbs[name]
+	if !ok {
+		db = &fakeDatabase{tables: make(map[string]*fakeTable)}
+		d.dbs[name] = db
+	}
+	return &fakeConn{db: db}, nil
+}
+
+// fakeDatabase holds the tables of one DSN
+type fakeDatabase struct {
+	mu     sync.Mutex
+	tables map[string]*fakeTable
+}
+
+// fakeTable is a table with its column order and primary key
+type fakeTable struct {
+	columns []string
+	key     []string
+	rows    []map[string]driver.Value
+}
+
+func (t *fakeTable) clone() *fakeTable {
+	c := &fakeTable{columns: t.columns, key: t.key, rows: make([]map[string]driver.Value, len(t.rows))}
+	for i, row := range t.rows {
+		c.rows[i] = cloneRow(row)
+	}
+	return c
+}
+
+func cloneRow(row map[string]driver.Value) map[string]driver.Value {
+	c := make(map[string]driver.Value, len(row))
+	for k, v := range row {
+		c[k] = v
+	}
+	return c
+}
+
+func (t *fakeTable) hasColumn(name string) bool {
+	for _, c := range t.columns {
+		if c == name {
+			return true
+		}
+	}
+	return false
+}
+
+// fakeConn runs statements directly; prepared statements defer to it
+type fakeConn struct {
+	db       *fakeDatabase
+	snapshot map[string]*fakeTable
+}
+
+func (c *fakeConn) Prepare(query string) (driver.Stmt, error) {
+	return &fakeStmt{conn: c, query: query}, nil
+}
+
+func (c *fakeConn) Close() error { return nil }
+
+func (c *fakeConn) Begin() (driver.Tx, error) {
+	c.db.mu.Lock()
+	defer c.db.mu.Unlock()
+
+	c.snapshot = make(map[string]*fakeTable, len(c.db.tables))
+	for name, table := range c.db.tables {
+		c.snapshot[name] = table.clone()
+	}
+	return c, nil
+}
+
+func (c *fakeConn) Commit() error {
+	c.snapshot = nil
+	return nil
+}
+
+func (c *fakeConn) Rollback() error {
+	c.db.mu.Lock()
+	defer c.db.mu.Unlock()
+
+	c.db.tables = c.snapshot
+	c.snapshot = nil
+	return nil
+}
+
+func (c *fakeConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	affected, _, err := c.db.run(query, args)
+	if err != nil {
+		return nil, err
+	}
+	return driver.RowsAffected(affected), nil
+}
+
+func (c *fakeConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	_, rows, err := c.db.run(query, args)
+	if err != nil {
+		return nil, err
+	}
+	if rows == nil {
+		return nil, fmt.Errorf("fakesql: %q returns no rows", query)
+	}
+	return rows, nil
+}
+
+// fakeStmt is a prepared statement, as used by transactions
+type fakeStmt struct {
+	conn  *fakeConn
+	query string
+}
+
+func (s *fakeStmt) Close() error  { return nil }
+func (s *fakeStmt) NumInput() int { return -1 }
+
+func (s *fakeStmt) Exec(args []driver.Value) (driver.Result, error) {
+	return s.conn.ExecContext(context.Background(), s.query, namedValues(args))
+}
+
+func (s *fakeStmt) Query(args []driver.Value) (driver.Rows, error) {
+	return s.conn.QueryContext(context.Background(), s.query, namedValues(args))
+}
+
+func namedValues(args []driver.Value) []driver.NamedValue {
+	named := make([]driver.NamedValue, len(args))
+	for i, v := range args {
+		named[i] = driver.NamedValue{Ordinal: i + 1, Value: v}
+	}
+	return named
+}
+
+// fakeRows returns the selected rows
+type fakeRows struct {
+	columns []string
+	values  [][]driver.Value
+}
+
+func (r *fakeRows) Columns() []string { return r.columns }
+func (r *fakeRows) Close() error      { return nil }
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if len(r.values) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.values[0])
+	r.values = r.values[1:]
+	return nil
+}
+
+// run executes one statement, returning the rows it affected or selected
+func (db *fakeDatabase) run(query string, args []driver.NamedValue) (int64, *fakeRows, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	tokens, err := tokenize(query)
+	if err != nil {
+		return 0, nil, err
+	}
+	p := &sqlParser{tokens: tokens, args: args}
+	switch strings.ToUpper(p.peek()) {
+	case "CREATE":
+		return 0, nil, db.create(p)
+	case "INSERT":
+		n, err := db.insert(p)
+		return n, nil, err
+	case "SELECT":
+		rows, err := db.selectRows(p)
+		return 0, rows, err
+	case "UPDATE":
+		n, err := db.update(p)
+		return n, nil, err
+	case "DELETE":
+		n, err := db.delete(p)
+		return n, nil, err
+	}
+	return 0, nil, fmt.Errorf("fakesql: unsupported statement %q", query)
+}
+
+func (db *fakeDatabase) table(name string) (*fakeTable, error) {
+	table, ok := db.tables[name]
+	if !ok {
+		return nil, fmt.Errorf("fakesql: no such table %s", name)
+	}
+	return table, nil
+}
+
+// create handles CREATE TABLE [IF NOT EXISTS] name (column definitions)
+func (db *fakeDatabase) create(p *sqlParser) error {
+	p.expect("CREATE", "TABLE")
+	ifNotExists := p.accept("IF", "NOT", "EXISTS")
+	name := p.next()
+	if _, ok := db.tables[name]; ok {
+		if ifNotExists {
+			return nil
+		}
+		return fmt.Errorf("fakesql: table %s already exists", name)
+	}
+
+	table := &fakeTable{}
+	p.expect("(")
+	for p.err == nil {
+		definition := p.until(",", ")")
+		if len(definition) == 0 {
+			p.err = errors.New("fakesql: empty column definition")
+			break
+		}
+		table.columns = append(table.columns, definition[0])
+		if strings.Contains(strings.ToUpper(strings.Join(definition, " ")), "PRIMARY KEY") {
+			table.key = append(table.key, definition[0])
+		}
+		if p.next() == ")" {
+			break
+		}
+	}
+	if p.err != nil {
+		return p.err
+	}
+	db.tables[name] = table
+	return nil
+}
+
+// insert handles INSERT INTO name (columns) VALUES (values)
+func (db *fakeDatabase) insert(p *sqlParser) (int64, error) {
+	p.expect("INSERT", "INTO")
+	table, err := db.table(p.next())
+	if err != nil {
+		return 0, err
+	}
+	columns := p.list()
+	p.expect("VALUES", "(")
+	row := make(map[string]driver.Value, len(table.columns))
+	for i, column := range columns {
+		if i > 0 {
+			p.expect(",")
+		}
+		if !table.hasColumn(column) {
+			return 0, fmt.Errorf("fakesql: no column %s", column)
+		}
+		row[column] = p.operand()
+	}
+	p.expect(")")
+	if p.err != nil {
+		return 0, p.err
+	}
+
+	if len(table.key) > 0 {
+		for _, existing := range table.rows {
+			duplicate := true
+			for _, column := range table.key {
+				if compare(existing[column], row[column]) != 0 {
+					duplicate = false
+				}
+			}
+			if duplicate {
+				return 0, errors.New("fakesql: UNIQUE constraint failed")
+			}
+		}
+	}
+	table.rows = append(table.rows, row)
+	return 1, nil
+}
+
+// selectRows handles SELECT columns|COUNT(*) FROM name [WHERE ...] [ORDER BY column]
+func (db *fakeDatabase) selectRows(p *sqlParser) (*fakeRows, error) {
+	p.expect("SELECT")
+	count := p.accept("COUNT", "(", "*", ")")
+	var columns []string
+	if !count {
+		columns = p.until("FROM")
+		columns = removeCommas(columns)
+	}
+	p.expect("FROM")
+	table, err := db.table(p.next())
+	if err != nil {
+		return nil, err
+	}
+	indexes, err := db.where(p, table)
+	if err != nil {
+		return nil, err
+	}
+	matches := make([]map[string]driver.Value, len(indexes))
+	for i, index := range indexes {
+		matches[i] = table.rows[index]
+	}
+	if p.accept("ORDER", "BY") {
+		column := p.next()
+		sort.SliceStable(matches, func(i, j int) bool {
+			return compare(matches[i][column], matches[j][column]) < 0
+		})
+	}
+	if p.err == nil && p.pos < len(p.tokens) {
+		p.err = fmt.Errorf("fakesql: unexpected %q", p.tokens[p.pos])
+	}
+	if p.err != nil {
+		return nil, p.err
+	}
+
+	if count {
+		return &fakeRows{columns: []string{"count"}, values: [][]driver.Value{{int64(len(matches))}}}, nil
+	}
+	rows := &fakeRows{columns: columns}
+	for _, row := range matches {
+		values := make([]driver.Value, len(columns))
+		for i, column := range columns {
+			if !table.hasColumn(column) {
+				return nil, fmt.Errorf("fakesql: no column %s", column)
+			}
+			values[i] = row[column]
+		}
+		rows.values = append(rows.values, values)
+	}
+	return rows, nil
+}
+
+// update handles UPDATE name SET column = value, ... [WHERE ...]
+func (db *fakeDatabase) update(p *sqlParser) (int64, error) {
+	p.expect("UPDATE")
+	table, err := db.table(p.next())
+	if err != nil {
+		return 0, err
+	}
+	p.expect("SET")
+	changes := make(map[string]driver.Value)
+	for p.err == nil {
+		column := p.next()
+		if !table.hasColumn(column) {
+			return 0, fmt.Errorf("fakesql: no column %s", column)
+		}
+		p.expect("=")
+		changes[column] = p.operand()
+		if !p.accept(",") {
+			break
+		}
+	}
+	matches, err := db.where(p, table)
+	if err != nil {
+		return 0, err
+	}
+	for _, i := range matches {
+		for column, value := range changes {
+			table.rows[i][column] = value
+		}
+	}
+	return int64(len(matches)), nil
+}
+
+// delete handles DELETE FROM name [WHERE ...]
+func (db *fakeDatabase) delete(p *sqlParser) (int64, error) {
+	p.expect("DELETE", "FROM")
+	table, err := db.table(p.next())
+	if err != nil {
+		return 0, err
+	}
+	matches, err := db.where(p, table)
+	if err != nil {
+		return 0, err
+	}
+	remove := make(map[int]bool, len(matches))
+	for _, i := range matches {
+		remove[i] = true
+	}
+	var kept []map[string]driver.Value
+	for i, row := range table.rows {
+		if !remove[i] {
+			kept = append(kept, row)
+		}
+	}
+	table.rows = kept
+	return int64(len(matches)), nil
+}
+
+// where returns the indexes of the rows matching an optional WHERE clause
+func (db *fakeDatabase) where(p *sqlParser, table *fakeTable) ([]int, error) {
+	var condition func(map[string]driver.Value) bool
+	if p.accept("WHERE") {
+		condition = p.andExpr(table)
+	}
+	if p.err != nil {
+		return nil, p.err
+	}
+	var matches []int
+	for i, row := range table.rows {
+		if condition == nil || condition(row) {
+			matches = append(matches, i)
+		}
+	}
+	return matches, nil
+}
+
+// sqlParser walks the tokens of one statement, binding arguments as it goes
+type sqlParser struct {
+	tokens []string
+	pos    int
+	args   []driver.NamedValue
+	bound  int
+	err    error
+}
+
+func (p *sqlParser) peek() string {
+	if p.pos < len(p.tokens) {
+		return p.tokens[p.pos]
+	}
+	return ""
+}
+
+func (p *sqlParser) next() string {
+	token := p.peek()
+	if token == "" && p.err == nil {
+		p.err = errors.New("fakesql: unexpected end of statement")
+	}
+	p.pos++
+	return token
+}
+
+// accept consumes words if they come next, ignoring case
+func (p *sqlParser) accept(words ...string) bool {
+	if p.pos+len(words) > len(p.tokens) {
+		return false
+	}
+	for i, word := range words {
+		if !strings.EqualFold(p.tokens[p.pos+i], word) {
+			return false
+		}
+	}
+	p.pos += len(words)
+	return true
+}
+
+func (p *sqlParser) expect(words ...string) {
+	if p.err == nil && !p.accept(words...) {
+		p.err = fmt.Errorf("fakesql: expected %q at %q", strings.Join(words, " "), p.peek())
+	}
+}
+
+// until returns the tokens up to one of stops at parenthesis depth zero
+func (p *sqlParser) until(stops ...string) []string {
+	var tokens []string
+	depth := 0
+	for p.pos < len(p.tokens) {
+		token := p.peek()
+		if depth == 0 {
+			for _, stop := range stops {
+				if strings.EqualFold(token, stop) {
+					return tokens
+				}
+			}
+		}
+		switch token {
+		case "(":
+			depth++
+		case ")":
+			depth--
+		}
+		tokens = append(tokens, token)
+		p.pos++
+	}
+	return tokens
+}
+
+// list reads a parenthesised list of names
+func (p *sqlParser) list() []string {
+	p.expect("(")
+	names := removeCommas(p.until(")"))
+	p.expect(")")
+	return names
+}
+
+func removeCommas(tokens []string) []string {
+	var names []string
+	for _, token := range tokens {
+		if token != "," {
+			names = append(names, token)
+		}
+	}
+	return names
+}
+
+// operand reads a placeholder or literal
+func (p *sqlParser) operand() driver.Value {
+	token := p.next()
+	switch {
+	case token == "?":
+		return p.arg(p.bound + 1)
+	case strings.HasPrefix(token, "$"):
+		n, _ := strconv.Atoi(token[1:])
+		return p.arg(n)
+	case strings.HasPrefix(token, "@p"):
+		n, _ := strconv.Atoi(token[2:])
+		return p.arg(n)
+	}
+	if n, err := strconv.ParseInt(token, 10, 64); err == nil {
+		return n
+	}
+	if p.err == nil {
+		p.err = fmt.Errorf("fakesql: unexpected operand %q", token)
+	}
+	return nil
+}
+
+// arg returns the nth bound argument, normalised for storage
+func (p *sqlParser) arg(n int) driver.Value {
+	p.bound++
+	if n < 1 || n > len(p.args) {
+		if p.err == nil {
+			p.err = fmt.Errorf("fakesql: missing argument %d", n)
+		}
+		return nil
+	}
+	switch v := p.args[n-1].Value.(type) {
+	case []byte:
+		return string(v)
+	case bool:
+		if v {
+			return int64(1)
+		}
+		return int64(0)
+	default:
+		return v
+	}
+}
+
+// andExpr parses conditions joined by AND
+func (p *sqlParser) andExpr(table *fakeTable) func(map[string]driver.Value) bool {
+	left := p.condition(table)
+	for p.accept("AND") {
+		a, b := left, p.condition(table)
+		left = func(row map[string]driver.Value) bool { return a(row) && b(row) }
+	}
+	return left
+}
+
+// condition parses a comparison or an IN list
+func (p *sqlParser) condition(table *fakeTable) func(map[string]driver.Value) bool {
+	never := func(map[string]driver.Value) bool { return false }
+
+	column := p.next()
+	if !table.hasColumn(column) {
+		if p.err == nil {
+			p.err = fmt.Errorf("fakesql: no column %s", column)
+		}
+		return never
+	}
+	if p.accept("IN") {
+		p.expect("(")
+		var values []driver.Value
+		for p.err == nil {
+			values = append(values, p.operand())
+			if !p.accept(",") {
+				break
+			}
+		}
+		p.expect(")")
+		return func(row map[string]driver.Value) bool {
+			for _, v := range values {
+				if compare(row[column], v) == 0 {
+					return true
+				}
+			}
+			return false
+		}
+	}
+
+	op := p.next()
+	value := p.operand()
+	test, ok := map[string]func(int) bool{
+		"=":  func(c int) bool { return c == 0 },
+		"<=": func(c int) bool { return c <= 0 },
+		">":  func(c int) bool { return c > 0 },
+	}[op]
+	if !ok {
+		if p.err == nil {
+			p.err = fmt.Errorf("fakesql: unsupported operator %q", op)
+		}
+		return never
+	}
+	return func(row map[string]driver.Value) bool { return test(compare(row[column], value)) }
+}
+
+// compare orders two stored values, numerically when both are numbers
+func compare(a, b driver.Value) int {
+	if x, ok := number(a); ok {
+		if y, ok := number(b); ok {
+			switch {
+			case x < y:
+				return -1
+			case x > y:
+				return 1
+			}
+			return 0
+		}
+	}
+	return strings.Compare(fmt.Sprint(a), fmt.Sprint(b))
+}
+
+func number(v driver.Value) (float64, bool) {
+	switch v := v.(type) {
+	case int64:
+		return float64(v), true
+	case float64:
+		return v, true
+	}
+	return 0, false
+}
+
+// tokenize splits a statement into words, numbers, placeholders and
+// punctuation
+func tokenize(query string) ([]string, error) {
+	var tokens []string
+	runes := []rune(query)
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '<' || r == '>':
+			if i+1 < len(runes) && runes[i+1] == '=' {
+				tokens = append(tokens, string(runes[i:i+2]))
+				i += 2
+			} else {
+				tokens = append(tokens, string(r))
+				i++
+			}
+		case strings.ContainsRune("(),=*?", r):
+			tokens = append(tokens, string(r))
+			i++
+		default:
+			j := i
+			for j < len(runes) && (unicode.IsLetter(runes[j]) || unicode.IsDigit(runes[j]) || strings.ContainsRune("_.$@", runes[j])) {
+				j++
+			}
+			if j == i {
+				return nil, fmt.Errorf("fakesql: unexpected %q in %q", r, query)
+			}
+			tokens = append(tokens, string(runes[i:j]))
+			i = j
+		}
+	}
+	return tokens, nil
+}
@@ -0,0 +1,77 @@
+package tests
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/mdwt/addpay-go/types"
+)
+
+func TestForStoreFillsDefaults(t *testing.T) {
+	var received url.Values
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		received = r.PostForm
+		w.Write([]byte(`{"success":true,"data":{"pay_url":"https://pay.example.com/1"}}`))
+	})
+
+	client := newTestClientWithConfig(t, handler, types.Config{
+		MerchantNo: "M-DEFAULT",
+		StoreNo:    "S-DEFAULT",
+	})
+
+	tests := []struct {
+		name         string
+		run          func() error
+		wantMerchant string
+		wantStore    string
+	}{
+		{
+			name: "config defaults",
+			run: func() error {
+				_, err := client.HostedCheckout(context.Background(), types.CheckoutRequest{MerchantOrderNo: "ORDER-1"})
+				return err
+			},
+			wantMerchant: "M-DEFAULT",
+			wantStore:    "S-DEFAULT",
+		},
+		{
+			name: "scoped store",
+			run: func() error {
+				_, err := client.ForStore("M-002", "S-002").HostedCheckout(context.Background(), types.CheckoutRequest{MerchantOrderNo: "ORDER-2"})
+				return err
+			},
+			wantMerchant: "M-002",
+			wantStore:    "S-002",
+		},
+		{
+			name: "explicit fields win",
+			run: func() error {
+				_, err := client.ForStore("M-002", "S-002").HostedCheckout(context.Background(), types.CheckoutRequest{
+					MerchantNo:      "M-003",
+					StoreNo:         "S-003",
+					MerchantOrderNo: "ORDER-3",
+				})
+				return err
+			},
+			wantMerchant: "M-003",
+			wantStore:    "S-003",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.run(); err != nil {
+				t.Fatalf("HostedCheckout failed: %v", err)
+			}
+			if got := received.Get("merchant_no"); got != tt.wantMerchant {
+				t.Errorf("merchant_no = %s, want %s", got, tt.wantMerchant)
+			}
+			if got := received.Get("store_no"); got != tt.wantStore {
+				t.Errorf("store_no = %s, want %s", got, tt.wantStore)
+			}
+		})
+	}
+}
@@ -0,0 +1,114 @@
+package tests
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/mdwt/addpay-go/types"
+)
+
+func TestListTransactions(t *testing.T) {
+	from := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	to := from.AddDate(0, 1, 0)
+
+	var pages []int
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		if r.URL.Path != "/list-transactions" {
+			http.NotFound(w, r)
+			return
+		}
+		form := r.PostForm
+		if form.Get("store_no") != "STORE-1" || form.Get("order_status") != "SUCCESS" || form.Get("pay_method") != "CARD" {
+			t.Errorf("filter not sent: %v", form)
+		}
+		if form.Get("start_time") != strconv.FormatInt(from.Unix(), 10) || form.Get("end_time") != strconv.FormatInt(to.Unix(), 10) {
+			t.Errorf("date range not sent: %v", form)
+		}
+
+		pageNo, _ := strconv.Atoi(form.Get("page_no"))
+		pages = append(pages, pageNo)
+
+		// Five transactions in pages of two
+		var items []string
+		for i := (pageNo-1)*2 + 1; i <= pageNo*2 && i <= 5; i++ {
+			items = append(items, fmt.Sprintf(`{"merchant_order_no":"ORDER-%d","order_status":"SUCCESS","order_amount":%d}`, i, i*10))
+		}
+		body := `{"success":true,"data":{"total":5,"page_no":` + strconv.Itoa(pageNo) + `,"transactions":[`
+		for i, item := range items {
+			if i > 0 {
+				body += ","
+			}
+			body += item
+		}
+		w.Write([]byte(body + `]}}`))
+	})
+
+	client := newTestClientWithConfig(t, handler, types.Config{
+		MerchantNo: "MERCHANT-1",
+		StoreNo:    "STORE-1",
+	})
+
+	filter := types.TransactionFilter{Status: "SUCCESS", PayMethod: "CARD", From: from, To: to, PageSize: 2}
+
+	var orders []string
+	for tx, err := range client.ListTransactions(context.Background(), filter) {
+		if err != nil {
+			t.Fatalf("ListTransactions() error = %v", err)
+		}
+		orders = append(orders, tx.MerchantOrderNo)
+	}
+	if len(orders) != 5 || orders[4] != "ORDER-5" {
+		t.Errorf("ListTransactions() = %v, want ORDER-1 to ORDER-5", orders)
+	}
+	if len(pages) != 3 {
+		t.Errorf("fetched pages %v, want 1 to 3", pages)
+	}
+
+	// Breaking out of the loop stops paging
+	pages = nil
+	for tx := range client.ListTransactions(context.Background(), filter) {
+		if tx.MerchantOrderNo == "ORDER-2" {
+			break
+		}
+	}
+	if len(pages) != 1 {
+		t.Errorf("fetched pages %v after break, want only page 1", pages)
+	}
+
+	// An inverted date range is reported through the iterator
+	for _, err := range client.ListTransactions(context.Background(), types.TransactionFilter{From: to, To: from}) {
+		if err == nil {
+			t.Error("ListTransactions() with inverted range did not fail")
+		}
+	}
+}
+
+func TestListTransactionsIgnoredPageNumber(t *testing.T) {
+	// The gateway ignores page_no and reports no total, so every page is full
+	requests := 0
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Write([]byte(`{"success":true,"data":{"total":0,"transactions":[` +
+			`{"transaction_id":"TX-1","merchant_order_no":"ORDER-1"},` +
+			`{"transaction_id":"TX-2","merchant_order_no":"ORDER-2"}]}}`))
+	})
+	client := newTestClient(t, handler)
+
+	var orders []string
+	var listErr error
+	for tx, err := range client.ListTransactions(context.Background(), types.TransactionFilter{PageSize: 2}) {
+		if err != nil {
+			listErr = err
+			break
+		}
+		orders = append(orders, tx.MerchantOrderNo)
+	}
+	if listErr == nil || len(orders) != 2 || requests != 2 {
+		t.Errorf("ListTransactions() = %v after %d requests, error %v; want the first page then an error", orders, requests, listErr)
+	}
+}
@@ -0,0 +1,149 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mdwt/addpay-go/auth"
+	"github.com/mdwt/addpay-go/types"
+	"github.com/mdwt/addpay-go/webhook"
+)
+
+// newTestGateway returns a signer standing in for the gateway and a verifier trusting it
+func newTestGateway(t *testing.T) (auth.RSAAuth, webhook.Verifier) {
+	t.Helper()
+
+	privateKey, publicKey := generateTestKeys(t)
+	gateway, err := auth.NewRSAAuth(privateKey, publicKey)
+	if err != nil {
+		t.Fatalf("NewRSAAuth() error = %v", err)
+	}
+	return gateway, webhook.NewVerifier(gateway.GatewayKeys())
+}
+
+// signedNotification returns form-encoded notification params signed by gateway
+func signedNotification(t *testing.T, gateway auth.RSAAuth, orderNo, status string) url.Values {
+	t.Helper()
+
+	return signForm(t, gateway, map[string]interface{}{
+		"notify_id":         "N-" + orderNo + "-" + status,
+		"merchant_no":       "M001",
+		"store_no":          "S001",
+		"merchant_order_no": orderNo,
+		"order_status":      status,
+		"price_currency":    "ZAR",
+		"order_amount":      "100.50",
+		"timestamp":         fmt.Sprintf("%d", time.Now().Unix()),
+	})
+}
+
+// signForm signs string params with gateway and returns them form-encoded
+func signForm(t *testing.T, gateway auth.RSAAuth, params map[string]interface{}) url.Values {
+	t.Helper()
+
+	signature, err := gateway.SignParameters(params)
+	if err != nil {
+		t.Fatalf("SignParameters() error = %v", err)
+	}
+
+	form := url.Values{"sign": {signature}}
+	for key, value := range params {
+		form.Set(key, value.(string))
+	}
+	return form
+}
+
+func postNotification(handler http.Handler, body, contentType string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/webhook", strings.NewReader(body))
+	req.Header.Set("Content-Type", contentType)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestWebhookHandler(t *testing.T) {
+	gateway, verifier := newTestGateway(t)
+
+	var received []types.Notification
+	handler := webhook.NewHandler(verifier, func(ctx context.Context, n types.Notification) error {
+		received = append(received, n)
+		return nil
+	})
+
+	form := signedNotification(t, gateway, "ORDER-1", "PAID")
+	rec := postNotification(handler, form.Encode(), "application/x-www-form-urlencoded")
+	if rec.Code != http.StatusOK || rec.Body.String() != "success" {
+		t.Fatalf("valid notification got %d %q", rec.Code, rec.Body.String())
+	}
+	if len(received) != 1 {
+		t.Fatalf("handler called %d times, want 1", len(received))
+	}
+	n := received[0]
+	if n.MerchantOrderNo != "ORDER-1" || n.OrderStatus != "PAID" || n.OrderAmount != 100.50 || n.Timestamp == 0 {
+		t.Errorf("notification = %+v", n)
+	}
+
+	// Tampering with any signed field invalidates the notification
+	form.Set("order_amount", "1.00")
+	rec = postNotification(handler, form.Encode(), "application/x-www-form-urlencoded")
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("tampered notification got %d, want 400", rec.Code)
+	}
+
+	form.Del("sign")
+	rec = postNotification(handler, form.Encode(), "application/x-www-form-urlencoded")
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("unsigned notification got %d, want 400", rec.Code)
+	}
+	if len(received) != 1 {
+		t.Errorf("handler called for invalid notifications")
+	}
+}
+
+func TestWebhookHandlerError(t *testing.T) {
+	gateway, verifier := newTestGateway(t)
+	handler := webhook.NewHandler(verifier, func(ctx context.Context, n types.Notification) error {
+		return errors.New("database unavailable")
+	})
+
+	form := signedNotification(t, gateway, "ORDER-2", "PAID")
+	rec := postNotification(handler, form.Encode(), "application/x-www-form-urlencoded")
+	if rec.Code != http.StatusInternalServerError {
+		t.Errorf("failing handler got %d, want 500 so the gateway retries", rec.Code)
+	}
+}
+
+func TestWebhookJSONBody(t *testing.T) {
+	gateway, verifier := newTestGateway(t)
+
+	// Numbers must be signed as written, not as reformatted floats
+	params := map[string]interface{}{
+		"merchant_order_no": "ORDER-3",
+		"order_status":      "PAID",
+		"order_amount":      "100.50",
+	}
+	signature, err := gateway.SignParameters(params)
+	if err != nil {
+		t.Fatalf("SignParameters() error = %v", err)
+	}
+	body := `{"merchant_order_no":"ORDER-3","order_status":"PAID","order_amount":100.50,"sign":` + strconvQuote(signature) + `}`
+
+	parsed, err := webhook.ParseBody("application/json", []byte(body))
+	if err != nil {
+		t.Fatalf("ParseBody() error = %v", err)
+	}
+	n, err := verifier.Verify(parsed)
+	if err != nil {
+		t.Fatalf("Verify() error = %v", err)
+	}
+	if n.OrderAmount != 100.50 {
+		t.Errorf("OrderAmount = %v, want 100.50", n.OrderAmount)
+	}
+}
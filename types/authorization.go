@@ -0,0 +1,110 @@
+package types
+
+import "time"
+
+// AuthStatus is the state of a card authorization
+type AuthStatus string
+
+const (
+	// AuthStatusPending is an authorization the issuer has not answered yet
+	AuthStatusPending AuthStatus = "PENDING"
+	// AuthStatusAuthorized holds funds that can be captured or voided
+	AuthStatusAuthorized AuthStatus = "AUTHORIZED"
+	// AuthStatusPartiallyCaptured has captured part of the funds; the rest can still be captured
+	AuthStatusPartiallyCaptured AuthStatus = "PARTIALLY_CAPTURED"
+	// AuthStatusCaptured has captured all the funds it will
+	AuthStatusCaptured AuthStatus = "CAPTURED"
+	// AuthStatusVoided released the held funds
+	AuthStatusVoided AuthStatus = "VOIDED"
+	// AuthStatusExpired lapsed before it was captured
+	AuthStatusExpired AuthStatus = "EXPIRED"
+	// AuthStatusDeclined was refused by the issuer
+	AuthStatusDeclined AuthStatus = "DECLINED"
+)
+
+// Capturable reports whether funds can still be captured
+func (s AuthStatus) Capturable() bool {
+	return s == AuthStatusAuthorized || s == AuthStatusPartiallyCaptured
+}
+
+// Final reports whether the authorization can no longer change
+func (s AuthStatus) Final() bool {
+	switch s {
+	case AuthStatusCaptured, AuthStatusVoided, AuthStatusExpired, AuthStatusDeclined:
+		return true
+	}
+	return false
+}
+
+// AuthorizeRequest represents a request to hold funds on a card token
+type AuthorizeRequest struct {
+	MerchantNo      string        `json:"merchant_no"`
+	StoreNo         string        `json:"store_no"`
+	MerchantOrderNo string        `json:"merchant_order_no"`
+	Token           string        `json:"token"`
+	PriceCurrency   string        `json:"price_currency"`
+	OrderAmount     float64       `json:"order_amount"`
+	Expires         int64         `json:"expires,omitempty"` // Optional: Unix time the hold should lapse at; gateway default when zero
+	ExpiresAt       time.Time     `json:"-"`                 // Optional: when the hold should lapse; sets Expires
+	ExpiresIn       time.Duration `json:"-"`                 // Optional: how long the hold should last once sent; sets Expires
+	NotifyURL       string        `json:"notify_url"`
+	Description     string        `json:"description,omitempty"`
+}
+
+// AuthorizeResponse represents the response from authorize
+type AuthorizeResponse struct {
+	TransactionID    string     `json:"transaction_id"`
+	AuthStatus       AuthStatus `json:"auth_status"`
+	AuthorizedAmount float64    `json:"authorized_amount"`
+	ExpiresAt        int64      `json:"expires_at"` // Unix time the hold lapses at
+}
+
+// Expiry returns the time the authorization lapses, or the zero time if unknown
+func (r AuthorizeResponse) Expiry() time.Time {
+	if r.ExpiresAt == 0 {
+		return time.Time{}
+	}
+	return time.Unix(r.ExpiresAt, 0)
+}
+
+// Expired reports whether the authorization has lapsed at now
+func (r AuthorizeResponse) Expired(now time.Time) bool {
+	if r.AuthStatus == AuthStatusExpired {
+		return true
+	}
+	expiry := r.Expiry()
+	return !expiry.IsZero() && !now.Before(expiry)
+}
+
+// CaptureRequest represents a request to capture authorized funds
+type CaptureRequest struct {
+	MerchantNo      string  `json:"merchant_no"`
+	StoreNo         string  `json:"store_no"`
+	MerchantOrderNo string  `json:"merchant_order_no"`
+	CaptureNo       string  `json:"capture_no"`
+	CaptureAmount   float64 `json:"capture_amount,omitempty"` // Optional: amount to capture; the full remaining amount when zero
+	FinalCapture    bool    `json:"final_capture,omitempty"`  // Optional: release any remaining amount after this capture
+}
+
+// CaptureResponse represents the response from capture
+type CaptureResponse struct {
+	CaptureNo       string     `json:"capture_no"`
+	TransactionID   string     `json:"transaction_id"`
+	AuthStatus      AuthStatus `json:"auth_status"`
+	CapturedAmount  float64    `json:"captured_amount"`
+	RemainingAmount float64    `json:"remaining_amount"`
+}
+
+// VoidRequest represents a request to release an authorization
+type VoidRequest struct {
+	MerchantNo      string `json:"merchant_no"`
+	StoreNo         string `json:"store_no"`
+	MerchantOrderNo string `json:"merchant_order_no"`
+	Reason          string `json:"reason,omitempty"`
+}
+
+// VoidResponse represents the response from void
+type VoidResponse struct {
+	TransactionID string     `json:"transaction_id"`
+	AuthStatus    AuthStatus `json:"auth_status"`
+}
@@ -0,0 +1,30 @@
+package types
+
+// Environment names an AddPay deployment with a preset gateway URL.
+// Presets carry no gateway public key: AddPay issues it per app in the
+// merchant portal, so GatewayPublicKey or GatewayKeySet is still required.
+// There is no sandbox preset; point GatewayURL at the endpoint that comes
+// with the test credentials from the PayCloud test integration docs.
+type Environment string
+
+const (
+	// Production is the live AddPay environment
+	Production Environment = "production"
+)
+
+// environmentURLs maps each named environment to its gateway base URL, as
+// given in the README configuration examples
+var environmentURLs = map[Environment]string{
+	Production: "https://api.paycloud.africa",
+}
+
+// GatewayURL returns the preset gateway base URL for the environment
+func (e Environment) GatewayURL() (string, bool) {
+	url, ok := environmentURLs[e]
+	return url, ok
+}
+
+// String returns the environment name
+func (e Environment) String() string {
+	return string(e)
+}
@@ -0,0 +1,67 @@
+package types
+
+import (
+	"fmt"
+	"time"
+)
+
+// Expiring is implemented by requests whose expiry can be given as Unix
+// seconds in Expires, as a time in ExpiresAt or as a duration in ExpiresIn.
+// The client resolves it each time the request is signed.
+type Expiring interface {
+	// ExpiresUnix returns the expiry in Unix seconds for a request sent at
+	// now on the gateway clock, or zero for none
+	ExpiresUnix(now time.Time) (int64, error)
+}
+
+// expiresUnix resolves whichever of expires, at and in is set. Setting more
+// than one is an error, as is an expiry already in the past.
+func expiresUnix(expires int64, at time.Time, in time.Duration, now time.Time) (int64, error) {
+	set := 0
+	for _, isSet := range []bool{expires != 0, !at.IsZero(), in != 0} {
+		if isSet {
+			set++
+		}
+	}
+	if set > 1 {
+		return 0, fmt.Errorf("set only one of Expires, ExpiresAt and ExpiresIn")
+	}
+
+	switch {
+	case in < 0:
+		return 0, fmt.Errorf("ExpiresIn must not be negative")
+	case in > 0:
+		return now.Add(in).Unix(), nil
+	case !at.IsZero():
+		if !at.After(now) {
+			return 0, fmt.Errorf("ExpiresAt %s is in the past", at.Format(time.RFC3339))
+		}
+		return at.Unix(), nil
+	}
+	return expires, nil
+}
+
+// ExpiresUnix returns the checkout expiry for a request sent at now
+func (r CheckoutRequest) ExpiresUnix(now time.Time) (int64, error) {
+	return expiresUnix(r.Expires, r.ExpiresAt, r.ExpiresIn, now)
+}
+
+// ExpiresUnix returns the QR code expiry for a request sent at now
+func (r QROrderRequest) ExpiresUnix(now time.Time) (int64, error) {
+	return expiresUnix(r.Expires, r.ExpiresAt, r.ExpiresIn, now)
+}
+
+// ExpiresUnix returns the hold expiry for a request sent at now
+func (r AuthorizeRequest) ExpiresUnix(now time.Time) (int64, error) {
+	return expiresUnix(r.Expires, r.ExpiresAt, r.ExpiresIn, now)
+}
+
+// ExpiresUnix returns the link expiry for a request sent at now
+func (r CreatePaymentLinkRequest) ExpiresUnix(now time.Time) (int64, error) {
+	return expiresUnix(r.Expires, r.ExpiresAt, r.ExpiresIn, now)
+}
+
+// ExpiresUnix returns the new link expiry for a request sent at now
+func (r UpdatePaymentLinkRequest) ExpiresUnix(now time.Time) (int64, error) {
+	return expiresUnix(r.Expires, r.ExpiresAt, r.ExpiresIn, now)
+}
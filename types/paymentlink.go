@@ -0,0 +1,177 @@
+package types
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// LinkStatus is the state of a payment link
+type LinkStatus string
+
+const (
+	// LinkStatusActive accepts payments
+	LinkStatusActive LinkStatus = "ACTIVE"
+	// LinkStatusInactive was deactivated by the merchant and can be reactivated
+	LinkStatusInactive LinkStatus = "INACTIVE"
+	// LinkStatusExpired passed its expiry time
+	LinkStatusExpired LinkStatus = "EXPIRED"
+	// LinkStatusExhausted reached its maximum number of uses
+	LinkStatusExhausted LinkStatus = "EXHAUSTED"
+	// LinkStatusDeleted was deleted and no longer resolves
+	LinkStatusDeleted LinkStatus = "DELETED"
+)
+
+// Metadata holds merchant key-value pairs attached to a payment link. It is
+// sent to the gateway as a single JSON-encoded parameter so it can be signed
+// like any other field.
+type Metadata map[string]string
+
+// MarshalJSON encodes the metadata as a JSON string
+func (m Metadata) MarshalJSON() ([]byte, error) {
+	if len(m) == 0 {
+		return []byte(`""`), nil
+	}
+	encoded, err := json.Marshal(map[string]string(m))
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(string(encoded))
+}
+
+// UnmarshalJSON accepts the metadata as a JSON object or a JSON-encoded string
+func (m *Metadata) UnmarshalJSON(data []byte) error {
+	var encoded string
+	if err := json.Unmarshal(data, &encoded); err == nil {
+		if encoded == "" {
+			*m = nil
+			return nil
+		}
+		data = []byte(encoded)
+	}
+	var values map[string]string
+	if err := json.Unmarshal(data, &values); err != nil {
+		return fmt.Errorf("invalid metadata: %w", err)
+	}
+	*m = values
+	return nil
+}
+
+// CreatePaymentLinkRequest represents a request to create a reusable payment link
+type CreatePaymentLinkRequest struct {
+	MerchantNo    string        `json:"merchant_no"`
+	StoreNo       string        `json:"store_no"`
+	Title         string        `json:"title"`
+	Description   string        `json:"description,omitempty"`
+	PriceCurrency string        `json:"price_currency"`
+	Amount        float64       `json:"amount,omitempty"`     // Optional: fixed amount; the customer enters the amount when zero
+	MinAmount     float64       `json:"min_amount,omitempty"` // Optional: lowest amount accepted by an open-amount link
+	MaxAmount     float64       `json:"max_amount,omitempty"` // Optional: highest amount accepted by an open-amount link
+	Expires       int64         `json:"expires,omitempty"`    // Optional: Unix time the link stops accepting payment
+	ExpiresAt     time.Time     `json:"-"`                    // Optional: when the link stops accepting payment; sets Expires
+	ExpiresIn     time.Duration `json:"-"`                    // Optional: how long the link accepts payment once created; sets Expires
+	MaxUses       int           `json:"max_uses,omitempty"`   // Optional: number of successful payments allowed; unlimited when zero
+	NotifyURL     string        `json:"notify_url,omitempty"`
+	ReturnURL     string        `json:"return_url,omitempty"`
+	Metadata      Metadata      `json:"metadata,omitempty"`
+}
+
+// OpenAmount reports whether the customer chooses the amount to pay
+func (r CreatePaymentLinkRequest) OpenAmount() bool {
+	return r.Amount == 0
+}
+
+// Validate checks the amount and usage limits before the request is sent
+func (r CreatePaymentLinkRequest) Validate() error {
+	if r.Amount < 0 || r.MinAmount < 0 || r.MaxAmount < 0 {
+		return fmt.Errorf("payment link amounts must not be negative")
+	}
+	if !r.OpenAmount() && (r.MinAmount != 0 || r.MaxAmount != 0) {
+		return fmt.Errorf("min and max amounts only apply to open-amount links")
+	}
+	if r.MaxAmount != 0 && r.MinAmount > r.MaxAmount {
+		return fmt.Errorf("min amount %.2f is above max amount %.2f", r.MinAmount, r.MaxAmount)
+	}
+	if r.MaxUses < 0 {
+		return fmt.Errorf("max uses must not be negative")
+	}
+	return nil
+}
+
+// PaymentLinkRequest identifies a payment link
+type PaymentLinkRequest struct {
+	MerchantNo string `json:"merchant_no"`
+	StoreNo    string `json:"store_no"`
+	LinkID     string `json:"link_id"`
+}
+
+// UpdatePaymentLinkRequest represents changes to a payment link. Zero fields
+// are left unchanged, so an update cannot remove the expiry or usage limit of
+// a link: deactivate it and create a new link instead. The amount of a link
+// cannot be changed once created.
+type UpdatePaymentLinkRequest struct {
+	MerchantNo  string        `json:"merchant_no"`
+	StoreNo     string        `json:"store_no"`
+	LinkID      string        `json:"link_id"`
+	Title       string        `json:"title,omitempty"`
+	Description string        `json:"description,omitempty"`
+	Expires     int64         `json:"expires,omitempty"`
+	ExpiresAt   time.Time     `json:"-"` // Optional: new expiry; sets Expires
+	ExpiresIn   time.Duration `json:"-"` // Optional: new expiry relative to now; sets Expires
+	MaxUses     int           `json:"max_uses,omitempty"`
+	Status      LinkStatus    `json:"status,omitempty"` // Optional: ACTIVE or INACTIVE
+	Metadata    Metadata      `json:"metadata,omitempty"`
+}
+
+// PaymentLink represents a payment link as stored by the gateway
+type PaymentLink struct {
+	LinkID        string     `json:"link_id"`
+	LinkURL       string     `json:"link_url"`
+	MerchantNo    string     `json:"merchant_no"`
+	StoreNo       string     `json:"store_no"`
+	Title         string     `json:"title"`
+	Description   string     `json:"description,omitempty"`
+	PriceCurrency string     `json:"price_currency"`
+	Amount        float64    `json:"amount,omitempty"`
+	MinAmount     float64    `json:"min_amount,omitempty"`
+	MaxAmount     float64    `json:"max_amount,omitempty"`
+	Expires       int64      `json:"expires,omitempty"`
+	MaxUses       int        `json:"max_uses,omitempty"`
+	UseCount      int        `json:"use_count"`
+	Status        LinkStatus `json:"status"`
+	Metadata      Metadata   `json:"metadata,omitempty"`
+	CreateTime    int64      `json:"create_time"`
+}
+
+// OpenAmount reports whether the customer chooses the amount to pay
+func (l PaymentLink) OpenAmount() bool {
+	return l.Amount == 0
+}
+
+// RemainingUses returns how many more payments the link accepts, or -1 if unlimited
+func (l PaymentLink) RemainingUses() int {
+	if l.MaxUses == 0 {
+		return -1
+	}
+	if l.UseCount >= l.MaxUses {
+		return 0
+	}
+	return l.MaxUses - l.UseCount
+}
+
+// Payable reports whether the link accepts a payment at now
+func (l PaymentLink) Payable(now time.Time) bool {
+	if l.Status != LinkStatusActive || l.RemainingUses() == 0 {
+		return false
+	}
+	return l.Expires == 0 || now.Before(time.Unix(l.Expires, 0))
+}
+
+// ListLinkPaymentsRequest represents one page of the payments made through a link
+type ListLinkPaymentsRequest struct {
+	MerchantNo string `json:"merchant_no"`
+	StoreNo    string `json:"store_no"`
+	LinkID     string `json:"link_id"`
+	PageNo     int    `json:"page_no"`
+	PageSize   int    `json:"page_size"`
+}
@@ -0,0 +1,42 @@
+package types
+
+import "strings"
+
+// PaymentStatus is an order status normalised across the names the gateway uses
+type PaymentStatus string
+
+const (
+	PaymentPaid      PaymentStatus = "paid"
+	PaymentPending   PaymentStatus = "pending"
+	PaymentFailed    PaymentStatus = "failed"
+	PaymentCancelled PaymentStatus = "cancelled"
+	PaymentExpired   PaymentStatus = "expired"
+	PaymentRefunded  PaymentStatus = "refunded"
+	PaymentUnknown   PaymentStatus = "unknown"
+)
+
+// ParsePaymentStatus maps a gateway order status to a PaymentStatus
+func ParsePaymentStatus(orderStatus string) PaymentStatus {
+	switch strings.ToUpper(orderStatus) {
+	case "PAID", "SUCCESS", "SUCCEEDED", "COMPLETED":
+		return PaymentPaid
+	case "PENDING", "PROCESSING", "CREATED", "WAIT_PAY", "WAITING":
+		return PaymentPending
+	case "FAILED", "FAIL", "DECLINED":
+		return PaymentFailed
+	case "CANCELLED", "CANCELED", "CLOSED":
+		return PaymentCancelled
+	case "EXPIRED", "TIMEOUT":
+		return PaymentExpired
+	case "REFUNDED", "PARTIALLY_REFUNDED":
+		return PaymentRefunded
+	default:
+		return PaymentUnknown
+	}
+}
+
+// Final reports whether the order has reached an outcome. Pending and
+// unrecognised statuses are not final.
+func (s PaymentStatus) Final() bool {
+	return s != PaymentPending && s != PaymentUnknown
+}
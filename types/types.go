@@ -1,6 +1,11 @@
 package types
 
-import "time"
+import (
+	"crypto"
+	"crypto/rsa"
+	"regexp"
+	"time"
+)
 
 // Logger is a simple logging interface that can be implemented by any logger
 type Logger interface {
@@ -10,29 +15,56 @@ type Logger interface {
 	Error(msg string, keysAndValues ...interface{})
 }
 
+// GatewayKeys holds the trusted gateway public keys; *auth.KeySet implements it
+type GatewayKeys interface {
+	// Verify checks a base64 SHA256WithRSA signature and returns the ID of the key that matched
+	Verify(data []byte, signature string) (string, error)
+	// PublicKey returns the first key valid at t
+	PublicKey(t time.Time) (*rsa.PublicKey, bool)
+}
+
+// RedactRule masks one kind of sensitive value in logs and errors. The redact
+// package uses it as redact.Rule.
+type RedactRule struct {
+	Name    string              // identifies the rule, e.g. "pan"
+	Keys    []string            // Optional: field names whose whole value is masked, matched case-insensitively
+	Pattern *regexp.Regexp      // Optional: matches the value anywhere in free text
+	Mask    func(string) string // Optional: replaces a matched value, Full when nil
+}
+
 // Config represents the configuration for AddPay client
 type Config struct {
-	AppID              string
-	GatewayURL         string
-	MerchantPrivateKey []byte
-	GatewayPublicKey   []byte
-	Timeout            time.Duration
-	Logger             Logger // Optional: uses default slog logger if nil
+	AppID                     string
+	Environment               Environment // Optional: fills GatewayURL from the named preset when empty
+	GatewayURL                string
+	FailoverURLs              []string // Optional: regional endpoints tried in order when GatewayURL is unavailable
+	MerchantPrivateKey        []byte
+	MerchantKeyPassphrase     []byte                 // Optional: passphrase for an encrypted PKCS#8 PEM or PKCS#12 MerchantPrivateKey
+	MerchantKeyPassphraseFunc func() ([]byte, error) // Optional: supplies the passphrase on demand; takes precedence over MerchantKeyPassphrase
+	MerchantSigner            crypto.Signer          // Optional: signs with an external key (KMS, HSM) instead of MerchantPrivateKey
+	GatewayPublicKey          []byte
+	GatewayKeySet             GatewayKeys // Optional: trusted gateway keys for rotation, such as an *auth.KeySet; takes precedence over GatewayPublicKey
+	MerchantNo                string      // Optional: default merchant number for requests
+	StoreNo                   string      // Optional: default store number for requests
+	Timeout                   time.Duration
+	Logger                    Logger       // Optional: logs through slog.Default() if nil
+	RedactRules               []RedactRule // Optional: masks further values in logs and errors, on top of redact.DefaultRules()
 }
 
-
 // CheckoutRequest represents a hosted checkout request
 type CheckoutRequest struct {
-	MerchantNo      string  `json:"merchant_no"`
-	StoreNo         string  `json:"store_no"`
-	MerchantOrderNo string  `json:"merchant_order_no"`
-	PriceCurrency   string  `json:"price_currency"`
-	OrderAmount     float64 `json:"order_amount"`
-	Expires         int64   `json:"expires"`
-	NotifyURL       string  `json:"notify_url"`
-	ReturnURL       string  `json:"return_url"`
-	Description     string  `json:"description,omitempty"`
-	Geolocation     string  `json:"geolocation,omitempty"`
+	MerchantNo      string        `json:"merchant_no"`
+	StoreNo         string        `json:"store_no"`
+	MerchantOrderNo string        `json:"merchant_order_no"`
+	PriceCurrency   string        `json:"price_currency"`
+	OrderAmount     float64       `json:"order_amount"`
+	Expires         int64         `json:"expires"` // Unix time in seconds the checkout expires at; prefer ExpiresAt or ExpiresIn
+	ExpiresAt       time.Time     `json:"-"`       // Optional: when the checkout expires; sets Expires
+	ExpiresIn       time.Duration `json:"-"`       // Optional: how long the checkout stays open once sent, on the gateway clock; sets Expires
+	NotifyURL       string        `json:"notify_url"`
+	ReturnURL       string        `json:"return_url"`
+	Description     string        `json:"description,omitempty"`
+	Geolocation     string        `json:"geolocation,omitempty"`
 }
 
 // CheckoutResponse represents the response from hosted checkout
@@ -92,6 +124,158 @@ type DebitCheckResponse struct {
 	MandateStatus string `json:"mandate_status"`
 }
 
+// QueryOrderRequest represents an order query request
+type QueryOrderRequest struct {
+	MerchantNo      string `json:"merchant_no"`
+	StoreNo         string `json:"store_no"`
+	MerchantOrderNo string `json:"merchant_order_no"`
+	TransactionID   string `json:"transaction_id,omitempty"`
+}
+
+// QueryOrderResponse represents the response from order query
+type QueryOrderResponse struct {
+	MerchantOrderNo string  `json:"merchant_order_no"`
+	TransactionID   string  `json:"transaction_id"`
+	OrderStatus     string  `json:"order_status"`
+	PriceCurrency   string  `json:"price_currency"`
+	OrderAmount     float64 `json:"order_amount"`
+	PaidAmount      float64 `json:"paid_amount,omitempty"`
+	PayMethod       string  `json:"pay_method,omitempty"`
+}
+
+// RefundRequest represents a refund request
+type RefundRequest struct {
+	MerchantNo      string  `json:"merchant_no"`
+	StoreNo         string  `json:"store_no"`
+	MerchantOrderNo string  `json:"merchant_order_no"`
+	RefundNo        string  `json:"refund_no"`
+	RefundAmount    float64 `json:"refund_amount"`
+	Reason          string  `json:"reason,omitempty"`
+	NotifyURL       string  `json:"notify_url,omitempty"`
+}
+
+// RefundResponse represents the response from refund
+type RefundResponse struct {
+	RefundNo     string `json:"refund_no"`
+	RefundID     string `json:"refund_id"`
+	RefundStatus string `json:"refund_status"`
+}
+
+// QueryRefundRequest represents a refund query request
+type QueryRefundRequest struct {
+	MerchantNo      string `json:"merchant_no"`
+	StoreNo         string `json:"store_no"`
+	MerchantOrderNo string `json:"merchant_order_no"`
+	RefundNo        string `json:"refund_no"`
+}
+
+// TransactionFilter selects the transactions returned by ListTransactions
+type TransactionFilter struct {
+	MerchantNo string    // Optional: defaults to the configured merchant
+	StoreNo    string    // Optional: defaults to the configured store
+	Status     string    // Optional: only transactions with this order status
+	PayMethod  string    // Optional: only transactions paid with this method
+	From       time.Time // Optional: earliest creation time, inclusive
+	To         time.Time // Optional: latest creation time, exclusive
+	PageSize   int       // Optional: transactions fetched per request, default 100
+}
+
+// ListTransactionsRequest represents one page of a transaction listing
+type ListTransactionsRequest struct {
+	MerchantNo  string `json:"merchant_no"`
+	StoreNo     string `json:"store_no"`
+	OrderStatus string `json:"order_status,omitempty"`
+	PayMethod   string `json:"pay_method,omitempty"`
+	StartTime   int64  `json:"start_time,omitempty"`
+	EndTime     int64  `json:"end_time,omitempty"`
+	PageNo      int    `json:"page_no"`
+	PageSize    int    `json:"page_size"`
+}
+
+// ListTransactionsResponse represents one page of transactions
+type ListTransactionsResponse struct {
+	Transactions []Transaction `json:"transactions"`
+	Total        int           `json:"total"`
+	PageNo       int           `json:"page_no"`
+	PageSize     int           `json:"page_size"`
+}
+
+// Transaction represents a payment in a transaction listing
+type Transaction struct {
+	MerchantNo      string  `json:"merchant_no"`
+	StoreNo         string  `json:"store_no"`
+	MerchantOrderNo string  `json:"merchant_order_no"`
+	TransactionID   string  `json:"transaction_id"`
+	OrderStatus     string  `json:"order_status"`
+	PriceCurrency   string  `json:"price_currency"`
+	OrderAmount     float64 `json:"order_amount"`
+	PaidAmount      float64 `json:"paid_amount,omitempty"`
+	PayMethod       string  `json:"pay_method,omitempty"`
+	CreateTime      int64   `json:"create_time"`
+	PayTime         int64   `json:"pay_time,omitempty"`
+}
+
+// QROrderRequest represents a dynamic QR code order for in-store payment
+type QROrderRequest struct {
+	MerchantNo      string        `json:"merchant_no"`
+	StoreNo         string        `json:"store_no"`
+	MerchantOrderNo string        `json:"merchant_order_no"`
+	PriceCurrency   string        `json:"price_currency"`
+	OrderAmount     float64       `json:"order_amount"`
+	Expires         int64         `json:"expires,omitempty"` // Optional: Unix time the QR code stops accepting payment
+	ExpiresAt       time.Time     `json:"-"`                 // Optional: when the QR code stops accepting payment; sets Expires
+	ExpiresIn       time.Duration `json:"-"`                 // Optional: how long the QR code accepts payment once sent; sets Expires
+	NotifyURL       string        `json:"notify_url,omitempty"`
+	TerminalNo      string        `json:"terminal_no,omitempty"` // Optional: POS terminal that displays the code
+	Description     string        `json:"description,omitempty"`
+}
+
+// QROrderResponse represents the response from QR order creation
+type QROrderResponse struct {
+	MerchantOrderNo string `json:"merchant_order_no"`
+	TransactionID   string `json:"transaction_id"`
+	QRCode          string `json:"qr_code"` // payload to render as a QR code
+	ExpiresAt       int64  `json:"expires_at,omitempty"`
+}
+
+// CancelOrderRequest represents a request to cancel an unpaid order
+type CancelOrderRequest struct {
+	MerchantNo      string `json:"merchant_no"`
+	StoreNo         string `json:"store_no"`
+	MerchantOrderNo string `json:"merchant_order_no"`
+	Reason          string `json:"reason,omitempty"`
+}
+
+// CancelOrderResponse represents the response from order cancellation
+type CancelOrderResponse struct {
+	MerchantOrderNo string `json:"merchant_order_no"`
+	OrderStatus     string `json:"order_status"`
+}
+
+// SettlementReportRequest represents a settlement report download request
+type SettlementReportRequest struct {
+	MerchantNo     string `json:"merchant_no"`
+	StoreNo        string `json:"store_no"`
+	SettlementDate string `json:"settlement_date"` // YYYY-MM-DD
+}
+
+// Notification represents a payment or refund callback sent to NotifyURL
+type Notification struct {
+	NotifyID        string  `json:"notify_id,omitempty"`
+	NotifyType      string  `json:"notify_type,omitempty"`
+	MerchantNo      string  `json:"merchant_no"`
+	StoreNo         string  `json:"store_no"`
+	MerchantOrderNo string  `json:"merchant_order_no"`
+	TransactionID   string  `json:"transaction_id,omitempty"`
+	RefundNo        string  `json:"refund_no,omitempty"`
+	OrderStatus     string  `json:"order_status"`
+	PriceCurrency   string  `json:"price_currency"`
+	OrderAmount     float64 `json:"order_amount"`
+	PaidAmount      float64 `json:"paid_amount,omitempty"`
+	PayMethod       string  `json:"pay_method,omitempty"`
+	Timestamp       int64   `json:"timestamp"`
+}
+
 // APIError represents an API error response
 type APIError struct {
 	Code    string `json:"code"`
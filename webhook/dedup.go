@@ -0,0 +1,289 @@
+package webhook
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/mdwt/addpay-go/logger"
+	"github.com/mdwt/addpay-go/sqlbind"
+	"github.com/mdwt/addpay-go/types"
+)
+
+// ErrStaleNotification is returned for notifications outside the freshness window
+var ErrStaleNotification = errors.New("notification timestamp is outside the freshness window")
+
+// ErrInProgress is returned for a notification whose event another delivery
+// is processing, so the gateway retries it later
+var ErrInProgress = errors.New("notification is being processed")
+
+// claimLease is how long a claimed event is reserved for its handler. An
+// event whose handler crashed can be processed again once it ends.
+const claimLease = 5 * time.Minute
+
+// ClaimResult is the outcome of claiming an event key
+type ClaimResult int
+
+const (
+	ClaimAcquired   ClaimResult = iota // the caller holds the lease and processes the event
+	ClaimInProgress                    // another caller holds an unexpired lease
+	ClaimDone                          // the event was processed
+)
+
+// Store records the business events that have been processed so resent and
+// replayed notifications are handled once
+type Store interface {
+	// Claim leases key to the caller until leaseUntil unless the key is done
+	// or leased to another caller whose lease has not ended
+	Claim(ctx context.Context, key string, leaseUntil time.Time) (ClaimResult, error)
+	// Complete marks a claimed key processed. Done keys are kept at least
+	// until expiresAt; a zero expiresAt keeps them forever.
+	Complete(ctx context.Context, key string, expiresAt time.Time) error
+	// Release forgets key so a notification that failed can be retried
+	Release(ctx context.Context, key string) error
+}
+
+// EventKey identifies the business event a notification reports: the
+// gateway notification ID when present, otherwise the order number, refund
+// number and status
+func EventKey(n types.Notification) string {
+	if n.NotifyID != "" {
+		return "notify:" + n.NotifyID
+	}
+	key := "order:" + n.MerchantNo + ":" + n.MerchantOrderNo
+	if n.RefundNo != "" {
+		key += ":refund:" + n.RefundNo
+	}
+	return key + ":" + n.OrderStatus
+}
+
+// CheckFreshness returns ErrStaleNotification when the notification timestamp
+// is missing or further than window from now
+func CheckFreshness(n types.Notification, window time.Duration, now time.Time) error {
+	if n.Timestamp == 0 {
+		return fmt.Errorf("%w: no timestamp", ErrStaleNotification)
+	}
+	age := now.Sub(time.Unix(n.Timestamp, 0))
+	if age > window || age < -window {
+		return fmt.Errorf("%w: sent %s ago", ErrStaleNotification, age.Round(time.Second))
+	}
+	return nil
+}
+
+// Deduplicate returns a copy of the handler that rejects notifications older
+// than window and calls the handler function once per EventKey. The key is
+// marked done only after the handler succeeds: duplicates of a done event are
+// acknowledged without being processed, a failed event is released so the
+// gateway's retry is processed, and an event whose handler crashed is
+// processed again once its lease ends. A zero window disables the timestamp
+// check and keeps keys forever.
+func (h Handler) Deduplicate(store Store, window time.Duration) Handler {
+	next := h.handle
+	h.handle = func(ctx context.Context, n types.Notification) error {
+		log := logger.WithContext(h.logger, ctx)
+		var expiresAt time.Time
+		if window > 0 {
+			if err := CheckFreshness(n, window, time.Now()); err != nil {
+				return rejected{err}
+			}
+			// Once the window has passed the timestamp check rejects the
+			// event, so the key is no longer needed
+			expiresAt = time.Unix(n.Timestamp, 0).Add(window)
+		}
+
+		key := EventKey(n)
+		claim, err := store.Claim(ctx, key, time.Now().Add(claimLease))
+		if err != nil {
+			return fmt.Errorf("failed to claim notification: %w", err)
+		}
+		switch claim {
+		case ClaimDone:
+			log.Info("Duplicate notification ignored", "event_key", key)
+			return nil
+		case ClaimInProgress:
+			return fmt.Errorf("%w: %s", ErrInProgress, key)
+		}
+
+		if err := next(ctx, n); err != nil {
+			if releaseErr := store.Release(ctx, key); releaseErr != nil {
+				log.Error("Failed to release notification", "event_key", key, "error", releaseErr)
+			}
+			return err
+		}
+		if err := store.Complete(ctx, key, expiresAt); err != nil {
+			// The event was processed; a resend after the lease ends runs it again
+			log.Error("Failed to mark notification processed", "event_key", key, "error", err)
+		}
+		return nil
+	}
+	return h
+}
+
+// rejected marks a handler error as a bad notification rather than a
+// processing failure
+type rejected struct {
+	err error
+}
+
+func (r rejected) Error() string { return r.err.Error() }
+
+func (r rejected) Unwrap() error { return r.err }
+
+// MemoryStore is an in-process Store for single instance deployments and tests
+type MemoryStore struct {
+	mu   sync.Mutex
+	keys map[string]memoryKey
+}
+
+// memoryKey is the state of one key and when it ends: the lease of an event
+// in progress, or the expiry of a done event
+type memoryKey struct {
+	done  bool
+	until time.Time
+}
+
+// NewMemoryStore creates an empty in-memory store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{keys: make(map[string]memoryKey)}
+}
+
+// Claim leases key to the caller
+func (s *MemoryStore) Claim(ctx context.Context, key string, leaseUntil time.Time) (ClaimResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	for k, state := range s.keys {
+		if !state.until.IsZero() && !state.until.After(now) {
+			delete(s.keys, k)
+		}
+	}
+
+	if state, ok := s.keys[key]; ok {
+		if state.done {
+			return ClaimDone, nil
+		}
+		return ClaimInProgress, nil
+	}
+	s.keys[key] = memoryKey{until: leaseUntil}
+	return ClaimAcquired, nil
+}
+
+// Complete marks key processed
+func (s *MemoryStore) Complete(ctx context.Context, key string, expiresAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.keys[key] = memoryKey{done: true, until: expiresAt}
+	return nil
+}
+
+// Release forgets key
+func (s *MemoryStore) Release(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.keys, key)
+	return nil
+}
+
+// SQLStore is a Store backed by a database table, shared by every instance
+// of the service. The table needs a unique event_key column, a state column
+// and an integer expires_at column holding Unix seconds: the end of the lease
+// of an event in progress, or the expiry of a done event (0 for never).
+// CreateTable creates it.
+type SQLStore struct {
+	db    *sql.DB
+	table string
+	style sqlbind.Style
+}
+
+// Key states stored in the state column
+const (
+	stateProcessing = "processing"
+	stateDone       = "done"
+)
+
+// NewSQLStore creates a store using table in db with "?" placeholders
+func NewSQLStore(db *sql.DB, table string) (SQLStore, error) {
+	if err := sqlbind.CheckIdentifier(table); err != nil {
+		return SQLStore{}, err
+	}
+	return SQLStore{db: db, table: table, style: sqlbind.Question}, nil
+}
+
+// WithBindStyle returns a copy of the store that uses the driver's placeholder style
+func (s SQLStore) WithBindStyle(style sqlbind.Style) SQLStore {
+	s.style = style
+	return s
+}
+
+// CreateTable creates the table if it does not exist
+func (s SQLStore) CreateTable(ctx context.Context) error {
+	_, err := s.db.ExecContext(ctx, "CREATE TABLE IF NOT EXISTS "+s.table+
+		" (event_key VARCHAR(255) NOT NULL PRIMARY KEY, state VARCHAR(16) NOT NULL, expires_at BIGINT NOT NULL)")
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", s.table, err)
+	}
+	return nil
+}
+
+// Claim inserts key as in progress. A done key that expired or a lease that
+// ended is replaced.
+func (s SQLStore) Claim(ctx context.Context, key string, leaseUntil time.Time) (ClaimResult, error) {
+	now := time.Now().Unix()
+	if _, err := s.db.ExecContext(ctx, s.style.Rebind("DELETE FROM "+s.table+
+		" WHERE event_key = ? AND expires_at > 0 AND expires_at <= ?"), key, now); err != nil {
+		return 0, fmt.Errorf("failed to expire notification key: %w", err)
+	}
+
+	_, insertErr := s.db.ExecContext(ctx, s.style.Rebind("INSERT INTO "+s.table+
+		" (event_key, state, expires_at) VALUES (?, ?, ?)"), key, stateProcessing, leaseUntil.Unix())
+	if insertErr == nil {
+		return ClaimAcquired, nil
+	}
+
+	// Unique violations are reported differently by every driver, so read
+	// the existing key instead of inspecting the error
+	var state string
+	err := s.db.QueryRowContext(ctx, s.style.Rebind("SELECT state FROM "+s.table+
+		" WHERE event_key = ?"), key).Scan(&state)
+	switch {
+	case err != nil:
+		return 0, fmt.Errorf("failed to claim notification key: %w", insertErr)
+	case state == stateDone:
+		return ClaimDone, nil
+	}
+	return ClaimInProgress, nil
+}
+
+// Complete marks key done until expiresAt
+func (s SQLStore) Complete(ctx context.Context, key string, expiresAt time.Time) error {
+	var expires int64
+	if !expiresAt.IsZero() {
+		expires = expiresAt.Unix()
+	}
+	if _, err := s.db.ExecContext(ctx, s.style.Rebind("UPDATE "+s.table+
+		" SET state = ?, expires_at = ? WHERE event_key = ?"), stateDone, expires, key); err != nil {
+		return fmt.Errorf("failed to complete notification key: %w", err)
+	}
+	return nil
+}
+
+// Release deletes key
+func (s SQLStore) Release(ctx context.Context, key string) error {
+	if _, err := s.db.ExecContext(ctx, s.style.Rebind("DELETE FROM "+s.table+" WHERE event_key = ?"), key); err != nil {
+		return fmt.Errorf("failed to release notification key: %w", err)
+	}
+	return nil
+}
+
+// Purge deletes expired keys and ended leases
+func (s SQLStore) Purge(ctx context.Context) error {
+	if _, err := s.db.ExecContext(ctx, s.style.Rebind("DELETE FROM "+s.table+
+		" WHERE expires_at > 0 AND expires_at <= ?"), time.Now().Unix()); err != nil {
+		return fmt.Errorf("failed to purge notification keys: %w", err)
+	}
+	return nil
+}
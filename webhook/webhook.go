@@ -0,0 +1,205 @@
+// Package webhook verifies and decodes the notifications AddPay sends to a
+// request's NotifyURL.
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/mdwt/addpay-go/auth"
+	"github.com/mdwt/addpay-go/logger"
+	"github.com/mdwt/addpay-go/types"
+)
+
+// maxBodySize bounds the notification body read from a request
+const maxBodySize = 1 << 20
+
+// ErrMissingSignature is returned when a notification carries no sign parameter
+var ErrMissingSignature = errors.New("notification has no sign parameter")
+
+// Verifier checks notification signatures against the trusted gateway keys
+type Verifier struct {
+	keys types.GatewayKeys
+}
+
+// NewVerifier creates a verifier for notifications signed by any of keys
+func NewVerifier(keys types.GatewayKeys) Verifier {
+	return Verifier{keys: keys}
+}
+
+// Verify checks the signature of params and decodes them into a notification
+func (v Verifier) Verify(params map[string]interface{}) (types.Notification, error) {
+	signature, _ := params["sign"].(string)
+	if signature == "" {
+		return types.Notification{}, ErrMissingSignature
+	}
+	if v.keys == nil {
+		return types.Notification{}, fmt.Errorf("no gateway keys configured")
+	}
+	if _, err := v.keys.Verify([]byte(auth.SignString(params)), signature); err != nil {
+		return types.Notification{}, fmt.Errorf("failed to verify notification: %w", err)
+	}
+	return Decode(params)
+}
+
+// ReadParams reads the parameters of a notification request. The gateway
+// posts form data, but JSON bodies are accepted as well.
+func ReadParams(r *http.Request) (map[string]interface{}, error) {
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxBodySize))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read notification: %w", err)
+	}
+	return ParseBody(r.Header.Get("Content-Type"), body)
+}
+
+// ParseBody parses a form-urlencoded or JSON notification body
+func ParseBody(contentType string, body []byte) (map[string]interface{}, error) {
+	params := make(map[string]interface{})
+
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	if mediaType == "application/json" || (mediaType == "" && bytes.HasPrefix(bytes.TrimSpace(body), []byte("{"))) {
+		// Keep numbers as written so the sign string matches the gateway's
+		decoder := json.NewDecoder(bytes.NewReader(body))
+		decoder.UseNumber()
+		if err := decoder.Decode(&params); err != nil {
+			return nil, fmt.Errorf("failed to parse notification: %w", err)
+		}
+		return params, nil
+	}
+
+	values, err := url.ParseQuery(string(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse notification: %w", err)
+	}
+	for key := range values {
+		params[key] = values.Get(key)
+	}
+	return params, nil
+}
+
+// Decode converts notification parameters into a typed notification without
+// checking the signature
+func Decode(params map[string]interface{}) (types.Notification, error) {
+	get := func(key string) string {
+		if value, ok := params[key]; ok && value != nil {
+			return fmt.Sprintf("%v", value)
+		}
+		return ""
+	}
+
+	n := types.Notification{
+		NotifyID:        get("notify_id"),
+		NotifyType:      get("notify_type"),
+		MerchantNo:      get("merchant_no"),
+		StoreNo:         get("store_no"),
+		MerchantOrderNo: get("merchant_order_no"),
+		TransactionID:   get("transaction_id"),
+		RefundNo:        get("refund_no"),
+		OrderStatus:     get("order_status"),
+		PriceCurrency:   get("price_currency"),
+		PayMethod:       get("pay_method"),
+	}
+
+	var err error
+	if n.OrderAmount, err = parseFloat(get("order_amount")); err != nil {
+		return types.Notification{}, fmt.Errorf("invalid order_amount: %w", err)
+	}
+	if n.PaidAmount, err = parseFloat(get("paid_amount")); err != nil {
+		return types.Notification{}, fmt.Errorf("invalid paid_amount: %w", err)
+	}
+	if timestamp := get("timestamp"); timestamp != "" {
+		if n.Timestamp, err = strconv.ParseInt(timestamp, 10, 64); err != nil {
+			return types.Notification{}, fmt.Errorf("invalid timestamp: %w", err)
+		}
+	}
+	return n, nil
+}
+
+// parseFloat parses an optional decimal amount
+func parseFloat(value string) (float64, error) {
+	if value == "" {
+		return 0, nil
+	}
+	return strconv.ParseFloat(value, 64)
+}
+
+// HandlerFunc processes a verified notification. Returning an error makes the
+// handler answer with a server error so the gateway retries delivery.
+type HandlerFunc func(ctx context.Context, notification types.Notification) error
+
+// Handler is an http.Handler that verifies notifications before passing them on
+type Handler struct {
+	verifier Verifier
+	handle   HandlerFunc
+	logger   types.Logger
+}
+
+// NewHandler creates a notification endpoint that calls handle for every
+// notification with a valid signature
+func NewHandler(verifier Verifier, handle HandlerFunc) Handler {
+	return Handler{
+		verifier: verifier,
+		handle:   handle,
+		logger:   logger.NewNoOpLogger(),
+	}
+}
+
+// SetLogger returns a copy of the handler that logs with l
+func (h Handler) SetLogger(l types.Logger) Handler {
+	h.logger = l
+	return h
+}
+
+// ServeHTTP verifies the notification, runs the handler and acknowledges it
+func (h Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	log := logger.WithContext(h.logger, r.Context())
+
+	params, err := ReadParams(r)
+	if err != nil {
+		log.Warn("Rejected notification", "error", err)
+		http.Error(w, "invalid notification", http.StatusBadRequest)
+		return
+	}
+
+	notification, err := h.verifier.Verify(params)
+	if err != nil {
+		log.Warn("Rejected notification", "error", err)
+		http.Error(w, "invalid notification", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.handle(r.Context(), notification); err != nil {
+		var reject rejected
+		if errors.As(err, &reject) {
+			log.Warn("Rejected notification",
+				"merchant_order_no", notification.MerchantOrderNo,
+				"error", err)
+			http.Error(w, "invalid notification", http.StatusBadRequest)
+			return
+		}
+		log.Error("Notification handler failed",
+			"merchant_order_no", notification.MerchantOrderNo,
+			"order_status", notification.OrderStatus,
+			"error", err)
+		http.Error(w, "notification not processed", http.StatusInternalServerError)
+		return
+	}
+
+	log.Info("Notification processed",
+		"merchant_order_no", notification.MerchantOrderNo,
+		"order_status", notification.OrderStatus)
+	io.WriteString(w, "success")
+}